@@ -58,5 +58,10 @@ bash .automount.sh
 
 sync
 
+# Продолжение прогона crycaller, прерванного перезагрузкой (reboot_required)
+if [[ -f progs/.crycaller_resume ]]; then
+    bash progs/.crycaller_resume
+fi
+
 cd progs/
 bash .after_breath.sh
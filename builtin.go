@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ================= BUILTIN TESTS =================
+// Тесты с type: "builtin" выполняются внутри crycaller без PTY.
+// Имя проверки задаётся полем builtin, параметры – полем params.
+// Относительные пути считаются от cwd теста, команды выполняются с его
+// env, cwd и user/group. Stop/Abort отменяют ctx проверки.
+
+type builtinFunc func(ctx context.Context, proc ProcOptions, params map[string]string) ([]string, error)
+
+var builtinTests = map[string]builtinFunc{
+	"file_exists":            builtinFileExists,
+	"sysfs_equals":           builtinSysfsEquals,
+	"pci_device_present":     builtinPCIDevicePresent,
+	"usb_device_present":     builtinUSBDevicePresent,
+	"kernel_module_loaded":   builtinKernelModuleLoaded,
+	"command_output_matches": builtinCommandOutputMatches,
+}
+
+// runBuiltin выполняет встроенную проверку и возвращает строки лога
+func runBuiltin(ctx context.Context, name string, proc ProcOptions, params map[string]string) ([]string, error) {
+	fn, ok := builtinTests[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown builtin test %q", name)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return fn(ctx, proc, params)
+}
+
+// pathParam читает обязательный путь; относительный путь – от cwd теста
+func pathParam(proc ProcOptions, params map[string]string, name string) (string, error) {
+	path, err := requireParam(params, name)
+	if err != nil {
+		return "", err
+	}
+	if proc.Cwd != "" && !filepath.IsAbs(path) {
+		path = filepath.Join(os.ExpandEnv(proc.Cwd), path)
+	}
+	return path, nil
+}
+
+func requireParam(params map[string]string, name string) (string, error) {
+	v := strings.TrimSpace(params[name])
+	if v == "" {
+		return "", fmt.Errorf("missing required parameter %q", name)
+	}
+	return v, nil
+}
+
+// minCountParam читает параметр count (минимальное число найденных устройств, по умолчанию 1)
+func minCountParam(params map[string]string) (int, error) {
+	v := strings.TrimSpace(params["count"])
+	if v == "" {
+		return 1, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid count %q", v)
+	}
+	return n, nil
+}
+
+// file_exists: path, type (file|dir|any, по умолчанию any)
+func builtinFileExists(_ context.Context, proc ProcOptions, params map[string]string) ([]string, error) {
+	path, err := pathParam(proc, params, "path")
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	switch params["type"] {
+	case "", "any":
+	case "file":
+		if !info.Mode().IsRegular() {
+			return nil, fmt.Errorf("%s exists but is not a regular file (%s)", path, info.Mode().Type())
+		}
+	case "dir":
+		if !info.IsDir() {
+			return nil, fmt.Errorf("%s exists but is not a directory", path)
+		}
+	default:
+		return nil, fmt.Errorf("invalid type %q (expected file, dir or any)", params["type"])
+	}
+	return []string{fmt.Sprintf("%s exists (%s, %d bytes)", path, info.Mode(), info.Size())}, nil
+}
+
+// sysfs_equals: path, value – содержимое файла (без пробелов по краям) должно совпасть с value
+func builtinSysfsEquals(_ context.Context, proc ProcOptions, params map[string]string) ([]string, error) {
+	path, err := pathParam(proc, params, "path")
+	if err != nil {
+		return nil, err
+	}
+	expected, ok := params["value"]
+	if !ok {
+		return nil, fmt.Errorf("missing required parameter %q", "value")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	got := strings.TrimSpace(string(data))
+	if got != strings.TrimSpace(expected) {
+		return nil, fmt.Errorf("%s = %q, expected %q", path, got, strings.TrimSpace(expected))
+	}
+	return []string{fmt.Sprintf("%s = %q", path, got)}, nil
+}
+
+// parseVidPid разбирает "8086:15b8" или отдельные параметры vendor/device
+func parseVidPid(params map[string]string, vendorKey, deviceKey string) (string, string, error) {
+	vendor, device := params[vendorKey], params[deviceKey]
+	if id := strings.TrimSpace(params["id"]); id != "" {
+		parts := strings.SplitN(id, ":", 2)
+		vendor = parts[0]
+		if len(parts) == 2 {
+			device = parts[1]
+		}
+	}
+	vendor = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(vendor), "0x"))
+	device = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(device), "0x"))
+	if vendor == "" {
+		return "", "", fmt.Errorf("missing required parameter %q (or %q)", "id", vendorKey)
+	}
+	return vendor, device, nil
+}
+
+func readSysHex(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(string(data)), "0x"))
+}
+
+// pci_device_present: id "vvvv:dddd" (или vendor/device), count
+func builtinPCIDevicePresent(_ context.Context, _ ProcOptions, params map[string]string) ([]string, error) {
+	vendor, device, err := parseVidPid(params, "vendor", "device")
+	if err != nil {
+		return nil, err
+	}
+	minCount, err := minCountParam(params)
+	if err != nil {
+		return nil, err
+	}
+	devs, err := filepath.Glob("/sys/bus/pci/devices/*")
+	if err != nil {
+		return nil, err
+	}
+	var found []string
+	for _, dev := range devs {
+		if readSysHex(filepath.Join(dev, "vendor")) != vendor {
+			continue
+		}
+		if device != "" && readSysHex(filepath.Join(dev, "device")) != device {
+			continue
+		}
+		found = append(found, filepath.Base(dev))
+	}
+	if len(found) < minCount {
+		return nil, fmt.Errorf("PCI device %s:%s found %d time(s), expected at least %d", vendor, device, len(found), minCount)
+	}
+	return []string{fmt.Sprintf("PCI device %s:%s found at %s", vendor, device, strings.Join(found, ", "))}, nil
+}
+
+// usb_device_present: id "vvvv:pppp" (или vendor/product), count
+func builtinUSBDevicePresent(_ context.Context, _ ProcOptions, params map[string]string) ([]string, error) {
+	vendor, product, err := parseVidPid(params, "vendor", "product")
+	if err != nil {
+		return nil, err
+	}
+	minCount, err := minCountParam(params)
+	if err != nil {
+		return nil, err
+	}
+	devs, err := filepath.Glob("/sys/bus/usb/devices/*")
+	if err != nil {
+		return nil, err
+	}
+	var found []string
+	for _, dev := range devs {
+		if readSysHex(filepath.Join(dev, "idVendor")) != vendor {
+			continue
+		}
+		if product != "" && readSysHex(filepath.Join(dev, "idProduct")) != product {
+			continue
+		}
+		found = append(found, filepath.Base(dev))
+	}
+	if len(found) < minCount {
+		return nil, fmt.Errorf("USB device %s:%s found %d time(s), expected at least %d", vendor, product, len(found), minCount)
+	}
+	return []string{fmt.Sprintf("USB device %s:%s found at %s", vendor, product, strings.Join(found, ", "))}, nil
+}
+
+// kernel_module_loaded: name – модуль в /proc/modules или встроенный в ядро (/sys/module)
+func builtinKernelModuleLoaded(_ context.Context, _ ProcOptions, params map[string]string) ([]string, error) {
+	name, err := requireParam(params, "name")
+	if err != nil {
+		return nil, err
+	}
+	name = strings.ReplaceAll(name, "-", "_")
+	f, err := os.Open("/proc/modules")
+	if err == nil {
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) > 0 && fields[0] == name {
+				return []string{fmt.Sprintf("module %s is loaded", name)}, nil
+			}
+		}
+	}
+	if _, err := os.Stat(filepath.Join("/sys/module", name)); err == nil {
+		return []string{fmt.Sprintf("module %s is built into the kernel", name)}, nil
+	}
+	return nil, fmt.Errorf("module %s is not loaded", name)
+}
+
+// command_output_matches: command (выполняется через sh -c), pattern (regexp),
+// timeout (по умолчанию 30s), ignore_exit ("true" – не учитывать код возврата)
+func builtinCommandOutputMatches(ctx context.Context, proc ProcOptions, params map[string]string) ([]string, error) {
+	command, err := requireParam(params, "command")
+	if err != nil {
+		return nil, err
+	}
+	pattern, err := requireParam(params, "pattern")
+	if err != nil {
+		return nil, err
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+	}
+	timeout := 30 * time.Second
+	if v := params["timeout"]; v != "" {
+		if timeout, err = time.ParseDuration(v); err != nil {
+			return nil, fmt.Errorf("invalid timeout %q: %v", v, err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	if err := proc.prepare(cmd); err != nil {
+		return nil, err
+	}
+	// Потомки sh могут держать вывод открытым после отмены
+	cmd.WaitDelay = time.Second
+	out, runErr := cmd.CombinedOutput()
+	lines := strings.Split(strings.TrimRight(string(out), "\n"), "\n")
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		return lines, fmt.Errorf("%q timed out after %v", command, timeout)
+	case context.Canceled:
+		return lines, fmt.Errorf("%q stopped", command)
+	}
+	if runErr != nil && params["ignore_exit"] != "true" {
+		return lines, fmt.Errorf("%q failed: %v", command, runErr)
+	}
+	if !re.Match(out) {
+		return lines, fmt.Errorf("output of %q does not match %q", command, pattern)
+	}
+	return lines, nil
+}
+
+// runBuiltinTest выполняет встроенную проверку фонового теста
+func (b *BgScript) runBuiltinTest(ctx context.Context, notifyFn func()) {
+	lines, err := runBuiltin(ctx, b.Builtin, b.Proc, b.Params)
+	b.RawLog = append(b.RawLog, lines...)
+	if err != nil {
+		b.RawLog = append(b.RawLog, "FAIL: "+err.Error())
+		b.Reason = err.Error()
+		b.Status = StatusFailed
+		b.Code = 1
+	} else {
+		b.RawLog = append(b.RawLog, "PASS")
+		b.Status = StatusPassed
+		b.Code = 0
+	}
+	if b.aborted {
+		b.Status = StatusAborted
+	}
+	b.EndTime = time.Now()
+	b.Duration = b.EndTime.Sub(b.StartTime) - b.PausedTotal
+	b.FinishedAt = time.Now()
+	runJournal.record(b.Key, b.Path, b.Status, b.Code, b.Duration)
+	notifyFn()
+}
+
+// runBuiltinTest выполняет встроенную проверку интерактивного теста
+func (i *IntScript) runBuiltinTest(ctx context.Context, notifyFn func()) {
+	lines, err := runBuiltin(ctx, i.Builtin, i.Proc, i.Params)
+	i.RawLog = append(i.RawLog, lines...)
+	if err != nil {
+		i.RawLog = append(i.RawLog, "FAIL: "+err.Error())
+		i.Reason = err.Error()
+		i.Status = StatusFailed
+		i.Code = 1
+	} else {
+		i.RawLog = append(i.RawLog, "PASS")
+		i.Status = StatusPassed
+		i.Code = 0
+	}
+	if i.aborted {
+		i.Status = StatusAborted
+	}
+	i.EndTime = time.Now()
+	i.Duration = i.EndTime.Sub(i.StartTime) - i.PausedTotal
+	i.FinishedAt = time.Now()
+	runJournal.record(i.Key, i.Path, i.Status, i.Code, i.Duration)
+	notifyFn()
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuiltinChecks(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "state"), []byte("up\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	inDir := ProcOptions{Cwd: dir}
+
+	for _, c := range []struct {
+		name    string
+		builtin string
+		proc    ProcOptions
+		params  map[string]string
+		wantErr string
+	}{
+		{"file exists", "file_exists", ProcOptions{}, map[string]string{"path": filepath.Join(dir, "state"), "type": "file"}, ""},
+		{"file is not a dir", "file_exists", ProcOptions{}, map[string]string{"path": filepath.Join(dir, "state"), "type": "dir"}, "not a directory"},
+		{"dir is not a file", "file_exists", ProcOptions{}, map[string]string{"path": filepath.Join(dir, "sub"), "type": "file"}, "not a regular file"},
+		{"missing file", "file_exists", ProcOptions{}, map[string]string{"path": filepath.Join(dir, "none")}, "no such file"},
+		{"bad type", "file_exists", ProcOptions{}, map[string]string{"path": dir, "type": "link"}, "invalid type"},
+		{"no path", "file_exists", ProcOptions{}, map[string]string{}, "missing required parameter"},
+		{"path relative to cwd", "file_exists", inDir, map[string]string{"path": "sub", "type": "dir"}, ""},
+		{"sysfs equals", "sysfs_equals", inDir, map[string]string{"path": "state", "value": " up "}, ""},
+		{"sysfs differs", "sysfs_equals", inDir, map[string]string{"path": "state", "value": "down"}, `expected "down"`},
+		{"sysfs no value", "sysfs_equals", inDir, map[string]string{"path": "state"}, "missing required parameter"},
+		{"no such module", "kernel_module_loaded", ProcOptions{}, map[string]string{"name": "crycaller-no-such-module"}, "not loaded"},
+		{"bad pci count", "pci_device_present", ProcOptions{}, map[string]string{"id": "8086:15b8", "count": "0"}, "invalid count"},
+		{"no usb id", "usb_device_present", ProcOptions{}, map[string]string{}, "missing required parameter"},
+		{"output matches", "command_output_matches", ProcOptions{}, map[string]string{"command": "echo link up", "pattern": "link (up|down)"}, ""},
+		{"output differs", "command_output_matches", ProcOptions{}, map[string]string{"command": "echo link down", "pattern": "up$"}, "does not match"},
+		{"command fails", "command_output_matches", ProcOptions{}, map[string]string{"command": "echo up; exit 3", "pattern": "up"}, "failed"},
+		{"exit ignored", "command_output_matches", ProcOptions{}, map[string]string{"command": "echo up; exit 3", "pattern": "up", "ignore_exit": "true"}, ""},
+		{"command timeout", "command_output_matches", ProcOptions{}, map[string]string{"command": "sleep 5", "pattern": ".", "timeout": "50ms"}, "timed out"},
+		{"bad pattern", "command_output_matches", ProcOptions{}, map[string]string{"command": "true", "pattern": "("}, "invalid pattern"},
+		{"command env", "command_output_matches", ProcOptions{Env: map[string]string{"LINK": "up"}}, map[string]string{"command": "echo $LINK", "pattern": "^up\n"}, ""},
+		{"command cwd", "command_output_matches", inDir, map[string]string{"command": "cat state", "pattern": "^up\n"}, ""},
+		{"unknown", "no_such_check", ProcOptions{}, nil, "unknown builtin test"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := runBuiltin(context.Background(), c.builtin, c.proc, c.params)
+			switch {
+			case c.wantErr == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case c.wantErr != "" && (err == nil || !strings.Contains(err.Error(), c.wantErr)):
+				t.Errorf("error %v, want %q", err, c.wantErr)
+			}
+		})
+	}
+}
+
+func TestBuiltinStop(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	_, err := runBuiltin(ctx, "command_output_matches", ProcOptions{}, map[string]string{"command": "sleep 5", "pattern": "."})
+	if err == nil || !strings.Contains(err.Error(), "stopped") {
+		t.Errorf("error %v, want stopped", err)
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("stop took %v", d)
+	}
+}
@@ -0,0 +1,19 @@
+package main
+
+import "crycaller/describe"
+
+var describeFlag = describe.Flag()
+
+var manifest = describe.Manifest{
+	Name:        "cam_test",
+	Description: "Opens the camera and runs face detection; in detection mode exits as soon as a face is found",
+	Keys: []describe.Key{
+		{Key: "E", Description: "detection mode: operator rejects the camera (test fails)"},
+		{Key: "any", Description: "normal mode: close the window"},
+	},
+	ExitCodes: []describe.Exit{
+		{Code: 0, Meaning: "face detected (or window closed in normal mode)"},
+		{Code: 1, Meaning: "rejected by the operator, model or camera error"},
+	},
+	Example: "-d -n",
+}
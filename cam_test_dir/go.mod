@@ -1,9 +1,12 @@
 module cam_test
 
-go 1.21
+go 1.23.2
 
-toolchain go1.23.2
-
-require gocv.io/x/gocv v0.40.0
+require (
+	crycaller v0.0.0-00010101000000-000000000000
+	gocv.io/x/gocv v0.40.0
+)
 
 replace github.com/tensorflow/tensorflow => github.com/tensorflow/tensorflow v2.7.0+incompatible
+
+replace crycaller => ../
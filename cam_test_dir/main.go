@@ -11,6 +11,8 @@ import (
     "time"
 
     "gocv.io/x/gocv"
+
+    "crycaller/describe"
 )
 
 func main() {
@@ -24,6 +26,10 @@ func main() {
     noDisplay := flag.Bool("n", false, "Disable camera feed display (silent mode)")
     flag.Parse()
 
+    if *describeFlag {
+        describe.Print(manifest)
+    }
+
     // Check if the model file exists
     if _, err := os.Stat(*modelFile); os.IsNotExist(err) {
         log.Fatalf("Model file '%s' not found", *modelFile)
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// ================= PROCESS TREE CLEANUP =================
+// Каждый тест запускается через pty.Start лидером своей сессии и группы
+// (pgid == sid == pid). Остановка и выход crycaller завершают не только
+// главный процесс, но и всех его потомков в этой сессии – в том числе
+// осиротевших (speaker-test из audio_test, dd из дисковых скриптов).
+
+const stopGrace = 2 * time.Second // время на корректное завершение до SIGKILL
+
+type processGroups struct {
+	mutex sync.Mutex
+	pids  map[int]bool
+}
+
+// liveGroups – сессии запущенных тестов, которые нужно убрать при выходе
+var liveGroups = &processGroups{pids: map[int]bool{}}
+
+func (g *processGroups) add(pid int) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.pids[pid] = true
+}
+
+func (g *processGroups) remove(pid int) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	delete(g.pids, pid)
+}
+
+func (g *processGroups) list() []int {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	var out []int
+	for pid := range g.pids {
+		out = append(out, pid)
+	}
+	sort.Ints(out)
+	return out
+}
+
+// signalSession отправляет сигнал группе и всем процессам сессии sid
+// (потомки могли сменить группу, но не сессию)
+func signalSession(sid int, sig syscall.Signal) {
+	_ = syscall.Kill(-sid, sig)
+	for _, pid := range sessionPids(sid) {
+		_ = syscall.Kill(pid, sig)
+	}
+}
+
+// killTree просит дерево процессов теста завершиться (SIGTERM, SIGCONT для
+// остановленных на паузе), а через stopGrace добивает оставшихся SIGKILL
+func killTree(sid int) {
+	signalSession(sid, syscall.SIGTERM)
+	signalSession(sid, syscall.SIGCONT)
+	time.AfterFunc(stopGrace, func() {
+		// Только по списку сессии: PID лидера к этому времени мог быть переиспользован
+		for _, pid := range sessionPids(sid) {
+			_ = syscall.Kill(pid, syscall.SIGKILL)
+		}
+		liveGroups.remove(sid)
+	})
+}
+
+// reapSession вызывается после выхода главного процесса теста:
+// оставшиеся в сессии процессы завершаются
+func reapSession(sid int, leaked []int) {
+	if len(leaked) == 0 {
+		liveGroups.remove(sid)
+		return
+	}
+	killTree(sid)
+}
+
+// shutdownTests синхронно завершает все тесты перед выходом crycaller
+func shutdownTests() {
+	sids := liveGroups.list()
+	if len(sids) == 0 {
+		return
+	}
+	for _, sid := range sids {
+		signalSession(sid, syscall.SIGTERM)
+		signalSession(sid, syscall.SIGCONT)
+	}
+	deadline := time.Now().Add(stopGrace)
+	for time.Now().Before(deadline) {
+		alive := false
+		for _, sid := range sids {
+			if len(sessionPids(sid)) > 0 {
+				alive = true
+				break
+			}
+		}
+		if !alive {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	for _, sid := range sids {
+		for _, pid := range sessionPids(sid) {
+			bareLog.Printf("Killing pid %d of test session %d", pid, sid)
+			_ = syscall.Kill(pid, syscall.SIGKILL)
+		}
+	}
+}
+
+// ================= SIGNALS =================
+// SIGTERM/SIGHUP/SIGINT завершают Bubble Tea штатно (терминал восстанавливается),
+// после чего main убирает процессы тестов. Если терминал уже недоступен
+// (SIGHUP) и программа не завершилась сама, она принудительно останавливается.
+
+type signalMsg struct{ sig syscall.Signal }
+
+var signalExitCode atomic.Int32
+
+func handleSignals() {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGINT)
+	go func() {
+		s := (<-sigCh).(syscall.Signal)
+		bareLog.Printf("Received %v, shutting down", s)
+		signalExitCode.Store(int32(128 + int(s)))
+		prog.Send(signalMsg{sig: s})
+		time.AfterFunc(3*time.Second, prog.Kill)
+	}()
+}
+
+func handleSignalMsg(m model, msg signalMsg) (tea.Model, tea.Cmd) {
+	m.quitting = true
+	m.exitCode = 128 + int(msg.sig)
+	return m, tea.Quit
+}
@@ -0,0 +1,88 @@
+// Package describe is the --describe protocol between crycaller and the test
+// binaries. A test started with --describe prints a JSON manifest of its
+// parameters, keys and exit codes and exits; crycaller uses it to check the
+// args in config.json, generate a config skeleton and show hints in the TUI.
+// The parameters come from the flags a binary registers; the rest of its
+// Manifest (description, keys, exit codes) is written out in the binary.
+package describe
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// FlagName is the flag that makes a test print its manifest
+const FlagName = "describe"
+
+// Manifest describes a test binary. Params are filled from the registered
+// flags by Print.
+type Manifest struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Curses      bool    `json:"curses"`
+	Params      []Param `json:"params"`
+	Keys        []Key   `json:"keys,omitempty"`
+	ExitCodes   []Exit  `json:"exit_codes"`
+	Example     string  `json:"example,omitempty"`
+}
+
+// Param is a command line flag of the test
+type Param struct {
+	Flag        string `json:"flag"`
+	Type        string `json:"type"` // bool, int, float64, string, duration
+	Default     string `json:"default"`
+	Description string `json:"description"`
+}
+
+// Key is a key the test reacts to while it runs
+type Key struct {
+	Key         string `json:"key"`
+	Description string `json:"description"`
+}
+
+// Exit is the meaning of an exit code
+type Exit struct {
+	Code    int    `json:"code"`
+	Meaning string `json:"meaning"`
+}
+
+// Flag registers --describe on the default flag set
+func Flag() *bool {
+	return flag.Bool(FlagName, false, "Print JSON manifest for crycaller and exit")
+}
+
+// Params lists the flags of fs, except --describe, as manifest parameters
+func Params(fs *flag.FlagSet) []Param {
+	var params []Param
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == FlagName {
+			return
+		}
+		params = append(params, Param{
+			Flag:        "-" + f.Name,
+			Type:        flagType(f),
+			Default:     f.DefValue,
+			Description: f.Usage,
+		})
+	})
+	return params
+}
+
+// Print adds the flags of the default flag set to m, prints it as JSON and
+// exits.
+func Print(m Manifest) {
+	m.Params = append(m.Params, Params(flag.CommandLine)...)
+	out, _ := json.MarshalIndent(m, "", "  ")
+	fmt.Println(string(out))
+	os.Exit(0)
+}
+
+// flagType: *flag.durationValue -> "duration"
+func flagType(f *flag.Flag) string {
+	t := fmt.Sprintf("%T", f.Value)
+	t = strings.TrimPrefix(t, "*flag.")
+	return strings.TrimSuffix(t, "Value")
+}
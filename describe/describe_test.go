@@ -0,0 +1,29 @@
+package describe
+
+import (
+	"flag"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParams(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Bool(FlagName, false, "print the manifest")
+	fs.Bool("T", false, "text mode")
+	fs.Int("n", 3, "count")
+	fs.Float64("level", 0.5, "level")
+	fs.String("dev", "/dev/video0", "device")
+	fs.Duration("timeout", 10*time.Second, "timeout")
+
+	want := []Param{
+		{Flag: "-T", Type: "bool", Default: "false", Description: "text mode"},
+		{Flag: "-dev", Type: "string", Default: "/dev/video0", Description: "device"},
+		{Flag: "-level", Type: "float64", Default: "0.5", Description: "level"},
+		{Flag: "-n", Type: "int", Default: "3", Description: "count"},
+		{Flag: "-timeout", Type: "duration", Default: "10s", Description: "timeout"},
+	}
+	if got := Params(fs); !reflect.DeepEqual(got, want) {
+		t.Errorf("Params = %+v\nwant %+v", got, want)
+	}
+}
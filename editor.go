@@ -0,0 +1,603 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// ================= CONFIG EDITOR (crycaller edit) =================
+// Редактор профиля: список фоновых и интерактивных тестов, добавление
+// найденных в каталоге скриптов/бинарников, удаление, перестановка,
+// правка полей с проверкой и живой предпросмотр раскладки плиток.
+
+type editorMode int
+
+const (
+	edList editorMode = iota
+	edPick
+	edField
+)
+
+var editorSections = []string{"BACKGROUND", "INTERACTIVE"}
+
+var editorFields = []string{"path", "args", "type", "max_logs", "output", "output_res", "keys.focus", "keys.restart", "keys.custom", "describe"}
+
+type editorModel struct {
+	profile *Profile
+	mode    editorMode
+	section int    // 0 – background_scripts, 1 – interactive_scripts
+	cursor  [2]int // выбранный тест в каждой секции
+
+	candidates []string
+	pickIdx    int
+
+	fieldIdx   int
+	fieldInput string
+
+	issues    []string
+	msg       string
+	dirty     bool
+	quitArmed bool
+
+	width, height int
+}
+
+// runEditor – точка входа `crycaller edit [profile]`
+func runEditor(args []string) error {
+	name := "default"
+	if len(args) > 0 {
+		name = args[0]
+	}
+	p, err := loadProfile(name)
+	if os.IsNotExist(err) {
+		// Новый профиль начинаем с текущего config.json, если он есть
+		p = &Profile{Name: name, Vars: map[string]string{}}
+		if cfg, err := loadConfig("config.json"); err == nil && cfg != nil {
+			p.Scripts = *cfg
+		}
+	} else if err != nil {
+		return err
+	}
+	m := editorModel{profile: p, candidates: discoverTests("."), width: 100, height: 30}
+	m.refreshIssues()
+	_, err = tea.NewProgram(m, tea.WithAltScreen()).Run()
+	return err
+}
+
+// discoverTests ищет в каталоге исполняемые файлы и *.sh
+func discoverTests(dir string) []string {
+	self, _ := os.Executable()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var out []string
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		name := e.Name()
+		if filepath.Base(self) == name {
+			continue
+		}
+		if strings.HasSuffix(name, ".sh") || info.Mode()&0111 != 0 {
+			out = append(out, "./"+name)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func (m *editorModel) scripts() *[]ScriptConfig {
+	if m.section == 0 {
+		return &m.profile.Scripts.BackgroundScripts
+	}
+	return &m.profile.Scripts.InteractiveScripts
+}
+
+func (m *editorModel) selected() *ScriptConfig {
+	list := *m.scripts()
+	idx := m.cursor[m.section]
+	if idx < 0 || idx >= len(list) {
+		return nil
+	}
+	return &list[idx]
+}
+
+func (m *editorModel) changed(msg string) {
+	m.dirty = true
+	m.msg = msg
+	m.refreshIssues()
+}
+
+func fieldValue(sc *ScriptConfig, field string) string {
+	switch field {
+	case "path":
+		return sc.Path
+	case "args":
+		return sc.Args
+	case "type":
+		return sc.Type
+	case "max_logs":
+		return strconv.Itoa(sc.MaxLogs)
+	case "output":
+		return strconv.FormatBool(sc.Output)
+	case "output_res":
+		return sc.OutputRes
+	case "keys.focus":
+		return sc.Keys.Focus
+	case "keys.restart":
+		return sc.Keys.Restart
+	case "keys.custom":
+		var pairs []string
+		for k, v := range sc.Keys.Custom {
+			pairs = append(pairs, k+"="+v)
+		}
+		sort.Strings(pairs)
+		return strings.Join(pairs, ",")
+	case "describe":
+		return strconv.FormatBool(sc.Describe)
+	}
+	return ""
+}
+
+// setField применяет значение поля с проверкой
+func setField(sc *ScriptConfig, field, value string) error {
+	value = strings.TrimSpace(value)
+	switch field {
+	case "path":
+		if value == "" {
+			return fmt.Errorf("path is required")
+		}
+		sc.Path = value
+	case "args":
+		sc.Args = value
+	case "type":
+		if err := checkScriptType(value); err != nil {
+			return err
+		}
+		sc.Type = value
+	case "max_logs":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return fmt.Errorf("max_logs must be a non-negative number")
+		}
+		sc.MaxLogs = n
+	case "output", "describe":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s must be true or false", field)
+		}
+		if field == "output" {
+			sc.Output = b
+		} else {
+			sc.Describe = b
+		}
+	case "output_res":
+		if value != "" {
+			if _, _, err := parseOutputRes(value, strings.Contains(strings.ToLower(sc.Type), "curses")); err != nil {
+				return err
+			}
+		}
+		sc.OutputRes = value
+	case "keys.focus", "keys.restart":
+		if err := checkKey(value); err != nil {
+			return err
+		}
+		if field == "keys.focus" {
+			sc.Keys.Focus = value
+		} else {
+			sc.Keys.Restart = value
+		}
+	case "keys.custom":
+		custom := map[string]string{}
+		for _, pair := range strings.Split(value, ",") {
+			if strings.TrimSpace(pair) == "" {
+				continue
+			}
+			k, v, ok := strings.Cut(pair, "=")
+			k, v = strings.TrimSpace(k), strings.TrimSpace(v)
+			if !ok || v == "" {
+				return fmt.Errorf("custom keys are key=value pairs separated by commas")
+			}
+			if err := checkKey(k); err != nil {
+				return err
+			}
+			custom[k] = v
+		}
+		if len(custom) == 0 {
+			custom = nil
+		}
+		sc.Keys.Custom = custom
+	}
+	return nil
+}
+
+// checkScriptType: script|binary|curses|builtin с модификаторами curses/info
+func checkScriptType(t string) error {
+	parts := strings.Split(t, ",")
+	switch strings.TrimSpace(parts[0]) {
+	case "script", "binary", "curses", "builtin":
+	default:
+		return fmt.Errorf("type must start with script, binary, curses or builtin")
+	}
+	for _, p := range parts[1:] {
+		if p := strings.TrimSpace(p); p != "curses" && p != "info" {
+			return fmt.Errorf("unknown type modifier %q (expected curses or info)", p)
+		}
+	}
+	return nil
+}
+
+// reservedKeys – ctrl+<key>, занятые самим crycaller
+var reservedKeys = map[string]string{"q": "quit", "r": "restart all", "e": "restart test", "p": "pause", "x": "abort", "o": "operator", "c": "interrupt"}
+
+func checkKey(k string) error {
+	if k == "" {
+		return nil
+	}
+	if len([]rune(k)) != 1 {
+		return fmt.Errorf("key must be a single character, got %q", k)
+	}
+	if what, ok := reservedKeys[strings.ToLower(k)]; ok {
+		return fmt.Errorf("ctrl+%s is reserved for %s", k, what)
+	}
+	return nil
+}
+
+// refreshIssues пересчитывает предупреждения по всему профилю
+func (m *editorModel) refreshIssues() {
+	m.issues = nil
+	focus := map[string]string{}
+	for s, list := range [][]ScriptConfig{m.profile.Scripts.BackgroundScripts, m.profile.Scripts.InteractiveScripts} {
+		for _, sc := range list {
+			name := fmt.Sprintf("%s %s", strings.ToLower(editorSections[s]), sc.Path)
+			if _, err := os.Stat(sc.Path); err != nil && !strings.HasPrefix(strings.TrimSpace(sc.Type), "builtin") {
+				m.issues = append(m.issues, fmt.Sprintf("%s: %v", name, err))
+			}
+			if err := checkScriptType(sc.Type); err != nil {
+				m.issues = append(m.issues, fmt.Sprintf("%s: %v", name, err))
+			}
+			if sc.OutputRes != "" {
+				if _, _, err := parseOutputRes(sc.OutputRes, strings.Contains(strings.ToLower(sc.Type), "curses")); err != nil {
+					m.issues = append(m.issues, fmt.Sprintf("%s: %v", name, err))
+				}
+			}
+			if f := sc.Keys.Focus; f != "" {
+				if other, dup := focus[f]; dup {
+					m.issues = append(m.issues, fmt.Sprintf("%s: focus key %q already used by %s", name, f, other))
+				}
+				focus[f] = sc.Path
+			}
+			if man := cachedManifest(sc.Path); sc.Describe && man != nil {
+				for _, p := range validateArgs(man, sc.Args) {
+					m.issues = append(m.issues, fmt.Sprintf("%s: %s", name, p))
+				}
+			}
+		}
+	}
+}
+
+func (m editorModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m editorModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		return m, nil
+	case tea.KeyMsg:
+		k := msg.String()
+		if k == "ctrl+q" {
+			return m, tea.Quit
+		}
+		switch m.mode {
+		case edPick:
+			return m.updatePick(k), nil
+		case edField:
+			return m.updateField(msg), nil
+		}
+		return m.updateList(k)
+	}
+	return m, nil
+}
+
+func (m editorModel) updateList(k string) (tea.Model, tea.Cmd) {
+	if k != "q" && k != "esc" {
+		m.quitArmed = false
+	}
+	list := m.scripts()
+	idx := m.cursor[m.section]
+	switch k {
+	case "up", "k":
+		if idx > 0 {
+			m.cursor[m.section]--
+		}
+	case "down", "j":
+		if idx < len(*list)-1 {
+			m.cursor[m.section]++
+		}
+	case "tab":
+		m.section = 1 - m.section
+	case "shift+up", "K":
+		if idx > 0 && idx < len(*list) {
+			(*list)[idx], (*list)[idx-1] = (*list)[idx-1], (*list)[idx]
+			m.cursor[m.section]--
+			m.changed("moved up")
+		}
+	case "shift+down", "J":
+		if idx < len(*list)-1 {
+			(*list)[idx], (*list)[idx+1] = (*list)[idx+1], (*list)[idx]
+			m.cursor[m.section]++
+			m.changed("moved down")
+		}
+	case "a":
+		m.mode = edPick
+		m.pickIdx = 0
+	case "d", "delete":
+		if idx < len(*list) {
+			removed := (*list)[idx].Path
+			*list = append((*list)[:idx], (*list)[idx+1:]...)
+			if m.cursor[m.section] >= len(*list) && m.cursor[m.section] > 0 {
+				m.cursor[m.section]--
+			}
+			m.changed("removed " + removed)
+		}
+	case "enter", "e":
+		if sc := m.selected(); sc != nil {
+			m.mode = edField
+			m.fieldIdx = 0
+			m.fieldInput = fieldValue(sc, editorFields[0])
+		}
+	case "m":
+		// Манифест запрашивается только по явной команде: бинарник без --describe начнёт тест
+		if sc := m.selected(); sc != nil {
+			man, err := loadManifest(sc.Path)
+			if err != nil {
+				m.msg = err.Error()
+				break
+			}
+			sc.Describe = true
+			if sc.Args == "" {
+				sc.Args = man.Example
+			}
+			if man.Curses && !strings.Contains(sc.Type, "curses") {
+				sc.Type = "binary, curses"
+			}
+			m.changed("manifest applied: " + man.Name)
+		}
+	case "s", "ctrl+s":
+		if err := saveProfile(m.profile); err != nil {
+			m.msg = "save failed: " + err.Error()
+		} else {
+			m.dirty = false
+			m.msg = "saved to " + profilePath(m.profile.Name)
+		}
+	case "q", "esc":
+		if m.dirty && !m.quitArmed {
+			m.quitArmed = true
+			m.msg = "unsaved changes – press [s] to save or [q] again to discard"
+			return m, nil
+		}
+		return m, tea.Quit
+	}
+	return m, nil
+}
+
+func (m editorModel) updatePick(k string) editorModel {
+	switch k {
+	case "up", "k":
+		if m.pickIdx > 0 {
+			m.pickIdx--
+		}
+	case "down", "j":
+		if m.pickIdx < len(m.candidates)-1 {
+			m.pickIdx++
+		}
+	case "enter":
+		if m.pickIdx < len(m.candidates) {
+			path := m.candidates[m.pickIdx]
+			sc := ScriptConfig{Path: path, Type: "binary", MaxLogs: 5}
+			if strings.HasSuffix(path, ".sh") {
+				sc.Type = "script"
+			}
+			if m.section == 1 {
+				sc.Output = true
+			}
+			list := m.scripts()
+			*list = append(*list, sc)
+			m.cursor[m.section] = len(*list) - 1
+			m.mode = edList
+			m.changed("added " + path)
+		}
+	case "esc":
+		m.mode = edList
+	}
+	return m
+}
+
+func (m editorModel) updateField(msg tea.KeyMsg) editorModel {
+	sc := m.selected()
+	if sc == nil {
+		m.mode = edList
+		return m
+	}
+	selectField := func(idx int) {
+		m.fieldIdx = (idx + len(editorFields)) % len(editorFields)
+		m.fieldInput = fieldValue(sc, editorFields[m.fieldIdx])
+	}
+	switch msg.Type {
+	case tea.KeyUp, tea.KeyShiftTab:
+		selectField(m.fieldIdx - 1)
+	case tea.KeyDown, tea.KeyTab:
+		selectField(m.fieldIdx + 1)
+	case tea.KeyEnter:
+		field := editorFields[m.fieldIdx]
+		if err := setField(sc, field, m.fieldInput); err != nil {
+			m.msg = field + ": " + err.Error()
+			return m
+		}
+		m.changed(field + " updated")
+		selectField(m.fieldIdx + 1)
+	case tea.KeyEsc:
+		m.mode = edList
+	case tea.KeyBackspace:
+		if r := []rune(m.fieldInput); len(r) > 0 {
+			m.fieldInput = string(r[:len(r)-1])
+		}
+	case tea.KeyCtrlW:
+		m.fieldInput = ""
+	case tea.KeyRunes, tea.KeySpace:
+		m.fieldInput += string(msg.Runes)
+	}
+	return m
+}
+
+func (m editorModel) View() string {
+	clear := "\033[2J\033[H"
+	title := fmt.Sprintf("crycaller edit – profile %q (%s)", m.profile.Name, profilePath(m.profile.Name))
+	if m.dirty {
+		title += " *"
+	}
+	leftWidth := m.width * 40 / 100
+	if leftWidth < 30 {
+		leftWidth = 30
+	}
+	left := lipgloss.NewStyle().Width(leftWidth).Render(m.renderList())
+	var right string
+	if m.mode == edPick {
+		right = m.renderPicker()
+	} else {
+		right = m.renderDetails()
+	}
+	right = lipgloss.NewStyle().Width(m.width - leftWidth - 7).Render(right)
+	body := lipgloss.JoinHorizontal(lipgloss.Top, left, " | ", right)
+
+	var issues string
+	if len(m.issues) > 0 {
+		issues = failedStyle.Render("Problems:\n  " + strings.Join(m.issues, "\n  "))
+	} else {
+		issues = passedStyle.Render("No problems found")
+	}
+	hint := footerStyle.Render("[↑/↓] select | [Tab] section | [K/J] move | [a] add | [d] delete | [Enter] edit | [m] fetch manifest | [s] save | [q] quit")
+	if m.mode == edField {
+		hint = footerStyle.Render("[↑/↓/Tab] field | type to edit | [Enter] apply | [ctrl+w] clear | [ESC] back")
+	} else if m.mode == edPick {
+		hint = footerStyle.Render("[↑/↓] select | [Enter] add to " + strings.ToLower(editorSections[m.section]) + " | [ESC] back")
+	}
+	parts := []string{title, "", body, "", asciiSep("TILE PREVIEW"), m.renderPreview(), "", issues}
+	if m.msg != "" {
+		parts = append(parts, focusStyle.Render(m.msg))
+	}
+	parts = append(parts, hint)
+	return clear + mainBorder.Render(strings.Join(parts, "\n"))
+}
+
+func (m editorModel) renderList() string {
+	var lines []string
+	for s, list := range [][]ScriptConfig{m.profile.Scripts.BackgroundScripts, m.profile.Scripts.InteractiveScripts} {
+		header := asciiSep(editorSections[s])
+		if s == m.section {
+			header = focusStyle.Render(header)
+		}
+		lines = append(lines, header)
+		if len(list) == 0 {
+			lines = append(lines, "  (empty)")
+		}
+		for idx, sc := range list {
+			cursor := "  "
+			if s == m.section && idx == m.cursor[s] {
+				cursor = focusStyle.Render("> ")
+			}
+			lines = append(lines, fmt.Sprintf("%s%s %s", cursor, sc.Path, footerStyle.Render(sc.Args)))
+		}
+		lines = append(lines, "")
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (m editorModel) renderPicker() string {
+	lines := []string{asciiSep("ADD TEST")}
+	if len(m.candidates) == 0 {
+		lines = append(lines, "No scripts or binaries found in the current directory")
+	}
+	for idx, c := range m.candidates {
+		cursor := "  "
+		if idx == m.pickIdx {
+			cursor = focusStyle.Render("> ")
+		}
+		lines = append(lines, cursor+c)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (m editorModel) renderDetails() string {
+	sc := m.selected()
+	if sc == nil {
+		return "No test selected – press [a] to add one"
+	}
+	lines := []string{asciiSep("TEST")}
+	for idx, f := range editorFields {
+		val := fieldValue(sc, f)
+		line := fmt.Sprintf("  %-13s %s", f, val)
+		if m.mode == edField && idx == m.fieldIdx {
+			line = focusStyle.Render(fmt.Sprintf("> %-13s %s_", f, m.fieldInput))
+		}
+		lines = append(lines, line)
+	}
+	if man := cachedManifest(sc.Path); man != nil {
+		lines = append(lines, "", manifestUsage(man))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// renderPreview рисует плитки в том же порядке, что и основной экран:
+// сначала интерактивные, затем фоновые тесты с output: true (в масштабе 1:2)
+func (m editorModel) renderPreview() string {
+	var boxes []string
+	for _, list := range [][]ScriptConfig{m.profile.Scripts.InteractiveScripts, m.profile.Scripts.BackgroundScripts} {
+		for _, sc := range list {
+			if !sc.Output {
+				continue
+			}
+			h, w, err := parseOutputRes(sc.OutputRes, strings.Contains(strings.ToLower(sc.Type), "curses"))
+			if err != nil || w == 0 {
+				w = 40
+			}
+			boxW, boxH := clamp(w/2, 12, 40), clamp(h/2, 1, 8)
+			label := fmt.Sprintf("%s\n%s", filepath.Base(sc.Path), footerStyle.Render(sc.OutputRes))
+			boxes = append(boxes, lipgloss.NewStyle().
+				Border(lipgloss.NormalBorder()).
+				BorderForeground(lipgloss.Color("240")).
+				Width(boxW).Height(boxH).
+				Render(label))
+		}
+	}
+	if len(boxes) == 0 {
+		return "(no tests with output: true)"
+	}
+	// Переносим плитки по ширине экрана
+	var rows []string
+	var row []string
+	rowWidth := 0
+	for _, b := range boxes {
+		w := lipgloss.Width(b)
+		if rowWidth+w > m.width-4 && len(row) > 0 {
+			rows = append(rows, lipgloss.JoinHorizontal(lipgloss.Top, row...))
+			row, rowWidth = nil, 0
+		}
+		row = append(row, b)
+		rowWidth += w
+	}
+	rows = append(rows, lipgloss.JoinHorizontal(lipgloss.Top, row...))
+	return strings.Join(rows, "\n")
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// ================= TAGS & FILTERED RUNS =================
+// Тесты помечаются tags в config.json. Фильтр задаётся флагами
+// -only/-skip/-test или выбирается на экране перед запуском. Отфильтрованные
+// тесты в прогон не попадают, а сам фильтр пишется в журнал и отчёт,
+// чтобы частичный прогон нельзя было принять за полный.
+
+type RunFilter struct {
+	Only  []string `json:"only,omitempty"`  // хотя бы один из тегов
+	Skip  []string `json:"skip,omitempty"`  // ни одного из тегов
+	Tests []string `json:"tests,omitempty"` // только тесты с этими именами
+}
+
+var runFilter RunFilter
+
+func splitList(s string) []string {
+	var out []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func (f RunFilter) Active() bool {
+	return len(f.Only) > 0 || len(f.Skip) > 0 || len(f.Tests) > 0
+}
+
+func (f RunFilter) String() string {
+	var parts []string
+	if len(f.Only) > 0 {
+		parts = append(parts, "only="+strings.Join(f.Only, ","))
+	}
+	if len(f.Skip) > 0 {
+		parts = append(parts, "skip="+strings.Join(f.Skip, ","))
+	}
+	if len(f.Tests) > 0 {
+		parts = append(parts, "test="+strings.Join(f.Tests, ","))
+	}
+	return strings.Join(parts, " ")
+}
+
+// testNames – имена, по которым тест выбирается через -test:
+// путь, имя файла и имя без расширения (./RAM_test.sh -> RAM_test)
+func testNames(sc ScriptConfig) []string {
+	base := filepath.Base(sc.Path)
+	names := []string{sc.Path, base, strings.TrimSuffix(base, filepath.Ext(base))}
+	if sc.Builtin != "" {
+		names = append(names, sc.Builtin)
+	}
+	return names
+}
+
+func containsAny(list, values []string) bool {
+	for _, a := range list {
+		for _, b := range values {
+			if strings.EqualFold(a, b) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (f RunFilter) Match(sc ScriptConfig) bool {
+	if len(f.Tests) > 0 && !containsAny(f.Tests, testNames(sc)) {
+		return false
+	}
+	if len(f.Only) > 0 && !containsAny(f.Only, sc.Tags) {
+		return false
+	}
+	return !containsAny(f.Skip, sc.Tags)
+}
+
+// filterScripts оставляет только тесты, подходящие под фильтр
+func filterScripts(f RunFilter, bgs []*BgScript, ints []*IntScript) ([]*BgScript, []*IntScript) {
+	if !f.Active() {
+		return bgs, ints
+	}
+	var outBg []*BgScript
+	for _, b := range bgs {
+		if f.Match(globalConfig.BackgroundScripts[b.ConfigIndex]) {
+			outBg = append(outBg, b)
+		}
+	}
+	var outInt []*IntScript
+	for _, i := range ints {
+		if f.Match(globalConfig.InteractiveScripts[i.ConfigIndex]) {
+			outInt = append(outInt, i)
+		}
+	}
+	return outBg, outInt
+}
+
+// skippedTests – тесты конфига, не попавшие в прогон из-за фильтра
+func skippedTests(cfg *Config, f RunFilter) []string {
+	if !f.Active() {
+		return nil
+	}
+	var out []string
+	for _, sc := range cfg.BackgroundScripts {
+		if !f.Match(sc) {
+			out = append(out, "bg:"+sc.Path)
+		}
+	}
+	for _, sc := range cfg.InteractiveScripts {
+		if !f.Match(sc) {
+			out = append(out, "int:"+sc.Path)
+		}
+	}
+	return out
+}
+
+// matchCount – сколько тестов конфига подходит под фильтр
+func matchCount(cfg *Config, f RunFilter) int {
+	n := 0
+	for _, scs := range [][]ScriptConfig{cfg.BackgroundScripts, cfg.InteractiveScripts} {
+		for _, sc := range scs {
+			if f.Match(sc) {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func allTags(cfg *Config) []string {
+	seen := map[string]bool{}
+	var tags []string
+	for _, scs := range [][]ScriptConfig{cfg.BackgroundScripts, cfg.InteractiveScripts} {
+		for _, sc := range scs {
+			for _, t := range sc.Tags {
+				if !seen[t] {
+					seen[t] = true
+					tags = append(tags, t)
+				}
+			}
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// filterLine – строка об активном фильтре для левой панели и финального экрана
+func filterLine() string {
+	if !runFilter.Active() {
+		return ""
+	}
+	return pausedStyle.Render("PARTIAL RUN – filter: " + runFilter.String())
+}
+
+// ================= FILTER PICKER =================
+// Каждый тег переключается пробелом: не задан -> only -> skip.
+
+const (
+	tagNone = iota
+	tagOnly
+	tagSkip
+)
+
+func pickerFilter(tags []string, state map[string]int) RunFilter {
+	f := RunFilter{Tests: runFilter.Tests}
+	for _, t := range tags {
+		switch state[t] {
+		case tagOnly:
+			f.Only = append(f.Only, t)
+		case tagSkip:
+			f.Skip = append(f.Skip, t)
+		}
+	}
+	return f
+}
+
+func handleFilterKey(m model, msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	tags := allTags(globalConfig)
+	switch msg.String() {
+	case "up", "k":
+		if m.filterIdx > 0 {
+			m.filterIdx--
+		}
+	case "down", "j":
+		if m.filterIdx < len(tags)-1 {
+			m.filterIdx++
+		}
+	case " ":
+		if m.filterIdx < len(tags) {
+			t := tags[m.filterIdx]
+			m.filterState[t] = (m.filterState[t] + 1) % 3
+		}
+	case "ctrl+w":
+		m.filterState = map[string]int{}
+	case "enter":
+		f := pickerFilter(tags, m.filterState)
+		if matchCount(globalConfig, f) == 0 {
+			// Пустой прогон не запускаем – оператор должен поправить выбор
+			return m, nil
+		}
+		runFilter = f
+		m.bgScripts, m.intScripts = filterScripts(runFilter, m.bgScripts, m.intScripts)
+		m.rebootStage = hasWaitingReboot(m.bgScripts, m.intScripts)
+		runJournal.setFilter(runFilter)
+		m.filterPicked = true
+		bareLog.Printf("Filter selected: %q", runFilter.String())
+		m = beginRun(m)
+		return m, startCmd(m)
+	case "esc":
+		m.quitting = true
+		return m, tea.Quit
+	}
+	return m, nil
+}
+
+func renderFilterScreen(m model) string {
+	clear := "\033[2J\033[H"
+	tags := allTags(globalConfig)
+	f := pickerFilter(tags, m.filterState)
+	selected := matchCount(globalConfig, f)
+	total := len(globalConfig.BackgroundScripts) + len(globalConfig.InteractiveScripts)
+	lines := []string{
+		asciiBannerMain(),
+		identityLine(),
+		"",
+		asciiSep("SELECT TESTS"),
+	}
+	if len(tags) == 0 {
+		lines = append(lines, "No tags in config – all tests will run")
+	}
+	for idx, t := range tags {
+		mark := "[ ]"
+		switch m.filterState[t] {
+		case tagOnly:
+			mark = passedStyle.Render("[+]")
+		case tagSkip:
+			mark = failedStyle.Render("[-]")
+		}
+		cursor := "  "
+		if idx == m.filterIdx {
+			cursor = focusStyle.Render("> ")
+		}
+		lines = append(lines, fmt.Sprintf("%s%s %s", cursor, mark, t))
+	}
+	summary := fmt.Sprintf("Tests selected: %d of %d", selected, total)
+	if f.Active() {
+		summary += " (filter: " + f.String() + ")"
+	}
+	if selected == 0 {
+		summary = failedStyle.Render(summary + " – nothing to run")
+	}
+	lines = append(lines,
+		"",
+		summary,
+		footerStyle.Render("\n[Space] none/only/skip | [ctrl+w] clear | [Enter] start | Press [ESC] or [ctrl+q] to quit"),
+	)
+	return clear + mainBorder.Render(lipgloss.NewStyle().Width(m.width-4).Render(strings.Join(lines, "\n")))
+}
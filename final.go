@@ -0,0 +1,459 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// ================= FINAL SCREEN =================
+// Финальный экран: сначала упавшие тесты с причиной, затем остальные.
+// Стрелками выбирается строка, Enter открывает полный лог теста.
+// Порядок тестов в модели не меняется – строки строятся по снимку.
+// Отсюда же можно перезапустить упавшие или отмеченные тесты: результаты
+// добавляются в текущую сессию, предыдущие попытки попадают в историю.
+
+const finalErrorLines = 3 // сколько последних строк лога показывать под упавшим тестом
+
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]`)
+
+type finalRow struct {
+	Key      string
+	Kind     string
+	Path     string
+	Args     string
+	Info     bool
+	Status   ScriptStatus
+	Code     int
+	Duration time.Duration
+	Reason   string
+	CutOff   bool
+	Log      []string
+	Attempts int
+	Usage    ResourceUsage
+}
+
+func (r finalRow) failed() bool {
+	return r.Status == StatusFailed || r.Status == StatusAborted
+}
+
+// group задаёт порядок вывода: основные падения, падения info, остальные, прерванные info
+func (r finalRow) group() int {
+	switch {
+	case r.CutOff:
+		return 3
+	case r.failed() && !r.Info:
+		return 0
+	case r.failed():
+		return 1
+	default:
+		return 2
+	}
+}
+
+func (r finalRow) name() string {
+	name := r.Path
+	if r.Args != "" {
+		name += " " + r.Args
+	}
+	if r.Info {
+		name += " (info)"
+	}
+	return name
+}
+
+// reason – краткое объяснение неудачи для таблицы
+func (r finalRow) reason() string {
+	reason := r.failReason()
+	if n := len(r.Usage.Leaked); n > 0 {
+		leak := fmt.Sprintf("leaked %d process(es)", n)
+		if reason == "" {
+			return leak
+		}
+		return reason + "; " + leak
+	}
+	return reason
+}
+
+func (r finalRow) failReason() string {
+	switch {
+	case r.CutOff:
+		return "cut off when main tests finished"
+	case r.Status == StatusAborted:
+		return "aborted by operator"
+	case r.Reason != "":
+		return r.Reason
+	case r.Status == StatusFailed:
+		return fmt.Sprintf("exit code %d", r.Code)
+	}
+	return ""
+}
+
+// lastLines возвращает последние непустые строки лога без ANSI-последовательностей
+func (r finalRow) lastLines(n int) []string {
+	var out []string
+	for idx := len(r.Log) - 1; idx >= 0 && len(out) < n; idx-- {
+		line := strings.TrimSpace(ansiEscape.ReplaceAllString(r.Log[idx], ""))
+		if line != "" {
+			out = append([]string{line}, out...)
+		}
+	}
+	return out
+}
+
+func scriptLog(raw []string, vt *VirtualTerminalBuffer) []string {
+	if vt != nil {
+		return strings.Split(vt.RenderVisible(), "\n")
+	}
+	return append([]string(nil), raw...)
+}
+
+// finalRows строит отсортированный снимок результатов
+func finalRows(bgs []*BgScript, ints []*IntScript) []finalRow {
+	var rows []finalRow
+	for _, b := range bgs {
+		rows = append(rows, finalRow{
+			Key: b.Key, Kind: "bg", Path: b.Path, Args: b.Args, Info: b.Info,
+			Status: b.Status, Code: b.Code, Duration: b.Duration,
+			Reason: b.Reason, CutOff: b.CutOff, Log: scriptLog(b.RawLog, b.vtBuffer),
+			Attempts: len(b.Attempts) + 1, Usage: b.Usage,
+		})
+	}
+	for _, i := range ints {
+		rows = append(rows, finalRow{
+			Key: i.Key, Kind: "int", Path: i.Path, Args: i.Args, Info: i.Info,
+			Status: i.Status, Code: i.Code, Duration: i.Duration,
+			Reason: i.Reason, CutOff: i.CutOff, Log: scriptLog(i.RawLog, i.vtBuffer),
+			Attempts: len(i.Attempts) + 1, Usage: i.Usage,
+		})
+	}
+	sort.SliceStable(rows, func(a, b int) bool {
+		if ga, gb := rows[a].group(), rows[b].group(); ga != gb {
+			return ga < gb
+		}
+		return rows[a].Duration < rows[b].Duration
+	})
+	return rows
+}
+
+func finalTotals(rows []finalRow) string {
+	var passed, failed, aborted, cut, leaked int
+	var cpu time.Duration
+	var peak int64
+	for _, r := range rows {
+		cpu += r.Usage.CPUTime
+		if r.Usage.PeakRSS > peak {
+			peak = r.Usage.PeakRSS
+		}
+		if len(r.Usage.Leaked) > 0 {
+			leaked++
+		}
+		switch {
+		case r.CutOff:
+			cut++
+		case r.Status == StatusPassed:
+			passed++
+		case r.Status == StatusFailed:
+			failed++
+		case r.Status == StatusAborted:
+			aborted++
+		}
+	}
+	return fmt.Sprintf("Total: %d | %s | %s | %s | Info cut off: %d | Leaking: %d\nCPU time: %v | Max peak RSS: %s",
+		len(rows),
+		passedStyle.Render(fmt.Sprintf("Passed: %d", passed)),
+		failedStyle.Render(fmt.Sprintf("Failed: %d", failed)),
+		abortedStyle.Render(fmt.Sprintf("Aborted: %d", aborted)),
+		cut, leaked, cpu.Truncate(100*time.Millisecond), formatBytes(peak))
+}
+
+func renderFinalScreen(m model) string {
+	rows := finalRows(m.bgScripts, m.intScripts)
+	if m.logView && m.finalIdx < len(rows) {
+		return renderFinalLog(m, rows[m.finalIdx])
+	}
+
+	clear := "\033[2J\033[H"
+	banner := asciiBannerFinal()
+	if id := identityLine(); id != "" {
+		banner += "\n" + id
+	}
+	if u := unitLine(); u != "" {
+		banner += "\n" + u
+	}
+	if f := filterLine(); f != "" {
+		banner += "\n" + f
+	}
+	if sl := soakLine(); sl != "" {
+		banner += "\n" + sl
+	}
+	if m.reportPath != "" {
+		banner += "\nReport: " + m.reportPath
+	}
+	if rb := reloadBanner(m); rb != "" {
+		banner += "\n" + rb
+	}
+
+	// Ширина колонки имени подстраивается под самый длинный путь
+	nameWidth := len("SCRIPT")
+	for _, r := range rows {
+		if w := lipgloss.Width(r.name()) + 4; w > nameWidth {
+			nameWidth = w
+		}
+	}
+	if limit := m.width - 70; limit > 20 && nameWidth > limit {
+		nameWidth = limit
+	}
+	sep := strings.Repeat("=", nameWidth+70)
+	lines := []string{
+		sep,
+		fmt.Sprintf("    %s | %s | %s | %s | %s | %s", padRight("SCRIPT", nameWidth), padRight("STATUS", 12), padRight("TIME", 8),
+			padRight("CPU", 8), padRight("PEAK RSS", 8), "REASON"),
+		sep,
+	}
+	for idx, r := range rows {
+		name := r.name()
+		if r.Attempts > 1 {
+			name += fmt.Sprintf(" #%d", r.Attempts)
+		}
+		name = truncateLeft(name, nameWidth)
+		cursor := "  "
+		if idx == m.finalIdx {
+			cursor = focusStyle.Render("> ")
+		}
+		if m.finalSelected[r.Key] {
+			cursor += focusStyle.Render("*")
+		} else {
+			cursor += " "
+		}
+		status := statusColor(r.Status, r.Code)
+		if r.CutOff {
+			status = pausedStyle.Render("[CUT OFF]")
+		} else if r.Status == StatusWaiting {
+			status = "[NOT RUN]"
+		}
+		tm := fmt.Sprintf("%v", r.Duration.Truncate(100*time.Millisecond))
+		cpu, rss := "-", "-"
+		if r.Usage.PeakProcs > 0 || r.Usage.CPUTime > 0 {
+			cpu = fmt.Sprintf("%v", r.Usage.CPUTime.Truncate(100*time.Millisecond))
+			rss = formatBytes(r.Usage.PeakRSS)
+		}
+		lines = append(lines, fmt.Sprintf("%s %s | %s | %s | %s | %s | %s",
+			cursor, padRight(name, nameWidth), padRight(status, 12), padRight(tm, 8),
+			padRight(cpu, 8), padRight(rss, 8), r.reason()))
+		if r.failed() && !r.CutOff {
+			for _, l := range r.lastLines(finalErrorLines) {
+				lines = append(lines, footerStyle.Render("       "+l))
+			}
+		}
+	}
+	lines = append(lines, sep, finalTotals(rows))
+
+	var cut []string
+	for _, r := range rows {
+		if r.CutOff {
+			cut = append(cut, r.Path)
+		}
+	}
+	if len(cut) > 0 {
+		lines = append(lines, "Info tests cut off: "+strings.Join(cut, ", "))
+	}
+
+	info := fmt.Sprintf("\nSession: %s\n[↑/↓] select | [Enter] open log | [Space] mark | [r] rerun marked | [f] rerun failed\nPress [ctrl+q] or [ESC] to quit (exitCode=%d) | Press [ctrl+r] to restart ALL tests\n", runJournal.SessionID, m.exitCode)
+	return clear + strings.Join([]string{banner, "", strings.Join(lines, "\n"), info}, "\n")
+}
+
+// finalLogHeight – сколько строк лога помещается на экран
+func finalLogHeight(m model) int {
+	if h := m.height - 6; h > 5 {
+		return h
+	}
+	return 20
+}
+
+func renderFinalLog(m model, r finalRow) string {
+	clear := "\033[2J\033[H"
+	height := finalLogHeight(m)
+	start := m.logOffset
+	if start > len(r.Log)-height {
+		start = len(r.Log) - height
+	}
+	if start < 0 {
+		start = 0
+	}
+	end := start + height
+	if end > len(r.Log) {
+		end = len(r.Log)
+	}
+	title := fmt.Sprintf("%s %s", r.name(), statusColor(r.Status, r.Code))
+	if reason := r.reason(); reason != "" {
+		title += " – " + reason
+	}
+	lines := []string{
+		asciiSep("LOG"),
+		title,
+		fmt.Sprintf("Lines %d-%d of %d", start+1, end, len(r.Log)),
+		"",
+	}
+	lines = append(lines, r.Log[start:end]...)
+	lines = append(lines, footerStyle.Render("\n[↑/↓/PgUp/PgDn/Home/End] scroll | [ESC], [q] or [Enter] back to results"))
+	return clear + strings.Join(lines, "\n")
+}
+
+func handleFinalKey(m model, msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	rows := finalRows(m.bgScripts, m.intScripts)
+	k := msg.String()
+
+	if m.logView {
+		if m.finalIdx >= len(rows) {
+			m.logView = false
+			return m, nil
+		}
+		height := finalLogHeight(m)
+		maxOffset := len(rows[m.finalIdx].Log) - height
+		if maxOffset < 0 {
+			maxOffset = 0
+		}
+		switch k {
+		case "esc", "q", "enter":
+			m.logView = false
+		case "up", "k":
+			m.logOffset--
+		case "down", "j":
+			m.logOffset++
+		case "pgup":
+			m.logOffset -= height
+		case "pgdown", " ":
+			m.logOffset += height
+		case "home", "g":
+			m.logOffset = 0
+		case "end", "G":
+			m.logOffset = maxOffset
+		}
+		if m.logOffset > maxOffset {
+			m.logOffset = maxOffset
+		}
+		if m.logOffset < 0 {
+			m.logOffset = 0
+		}
+		return m, nil
+	}
+
+	switch k {
+	case "up", "k":
+		if m.finalIdx > 0 {
+			m.finalIdx--
+		}
+	case "down", "j":
+		if m.finalIdx < len(rows)-1 {
+			m.finalIdx++
+		}
+	case "enter":
+		if m.finalIdx < len(rows) {
+			// Лог открывается на последних строках – там обычно причина падения
+			m.logView = true
+			m.logOffset = len(rows[m.finalIdx].Log) - finalLogHeight(m)
+			if m.logOffset < 0 {
+				m.logOffset = 0
+			}
+		}
+	case " ":
+		if m.finalIdx < len(rows) {
+			key := rows[m.finalIdx].Key
+			if m.finalSelected[key] {
+				delete(m.finalSelected, key)
+			} else {
+				m.finalSelected[key] = true
+			}
+		}
+	case "r":
+		// Отмеченные тесты, а если ничего не отмечено – тест под курсором
+		selected := m.finalSelected
+		if len(selected) == 0 && m.finalIdx < len(rows) {
+			selected = map[string]bool{rows[m.finalIdx].Key: true}
+		}
+		rerunTests(&m, func(key string, _ ScriptStatus, _ bool) bool { return selected[key] })
+	case "f":
+		rerunTests(&m, func(_ string, st ScriptStatus, cutOff bool) bool {
+			return !cutOff && (st == StatusFailed || st == StatusAborted)
+		})
+	case "esc":
+		m.quitting = true
+		return m, tea.Quit
+	}
+	return m, nil
+}
+
+// ================= SELECTIVE RERUN =================
+
+func (b *BgScript) attempt() TestAttempt {
+	return TestAttempt{Status: b.Status.String(), Code: b.Code, Duration: b.Duration, Reason: b.Reason, FinishedAt: b.FinishedAt}
+}
+
+func (i *IntScript) attempt() TestAttempt {
+	return TestAttempt{Status: i.Status.String(), Code: i.Code, Duration: i.Duration, Reason: i.Reason, FinishedAt: i.FinishedAt}
+}
+
+// rerunTests пересоздаёт выбранные тесты с историей попыток и запускает только их.
+// Остальные результаты и сессия сохраняются; отчёт перезапишется при завершении.
+func rerunTests(m *model, pick func(key string, st ScriptStatus, cutOff bool) bool) {
+	count := 0
+	for idx, b := range m.bgScripts {
+		if b.ConfigIndex < 0 || !pick(b.Key, b.Status, b.CutOff) {
+			continue
+		}
+		newTest := newBgScript(globalConfig.BackgroundScripts[b.ConfigIndex], b.ConfigIndex)
+		newTest.Attempts = append(append([]TestAttempt(nil), b.Attempts...), b.attempt())
+		m.bgScripts[idx] = newTest
+		count++
+	}
+	for idx, i := range m.intScripts {
+		if i.ConfigIndex < 0 || !pick(i.Key, i.Status, i.CutOff) {
+			continue
+		}
+		newTest := newIntScript(globalConfig.InteractiveScripts[i.ConfigIndex], i.ConfigIndex)
+		newTest.Attempts = append(append([]TestAttempt(nil), i.Attempts...), i.attempt())
+		m.intScripts[idx] = newTest
+		count++
+	}
+	if count == 0 {
+		return
+	}
+	bareLog.Printf("Rerunning %d test(s) in session %s", count, runJournal.SessionID)
+
+	m.mode = modeMain
+	m.exitCode = 0
+	m.outputTiles = []outputTile{}
+	m.selectedTileIdx = 0
+	m.finalIdx = 0
+	m.logView = false
+	m.finalSelected = map[string]bool{}
+
+	runJournal.setStage(stageRunning)
+	m.rebootStage = hasWaitingReboot(m.bgScripts, m.intScripts)
+	launchScripts(m.bgScripts, m.intScripts, notifyFor(m.bgScripts, m.intScripts))
+}
+
+// truncateLeft обрезает s слева до ширины width на экране, сохраняя конец
+// (имя теста) и ставя "…" в начале. Широкие символы (CJK) занимают две колонки.
+func truncateLeft(s string, width int) string {
+	if lipgloss.Width(s) <= width {
+		return s
+	}
+	runes := []rune(s)
+	tail, w := len(runes), 0
+	for tail > 0 {
+		rw := lipgloss.Width(string(runes[tail-1]))
+		if w+rw > width-1 {
+			break
+		}
+		w += rw
+		tail--
+	}
+	return "…" + string(runes[tail:])
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+func TestTruncateLeft(t *testing.T) {
+	for _, c := range []struct {
+		s     string
+		width int
+		want  string
+	}{
+		{"./mem_test", 20, "./mem_test"},
+		{"./tests/audio/mic_test", 10, "…/mic_test"},
+		{"./тесты/микрофон", 9, "…микрофон"},
+		{"./测试/麦克风测试", 9, "…克风测试"},
+		{"./测试/麦克风测试", 8, "…风测试"},
+		{"麦克风", 2, "…"},
+	} {
+		got := truncateLeft(c.s, c.width)
+		if got != c.want {
+			t.Errorf("truncateLeft(%q, %d) = %q, want %q", c.s, c.width, got, c.want)
+		}
+		if w := lipgloss.Width(got); w > c.width {
+			t.Errorf("truncateLeft(%q, %d) is %d columns wide", c.s, c.width, w)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+// Package dmi parses dmidecode output. It is shared by the provisioning tool
+// and its tests, which feed it canned output instead of running dmidecode.
+package dmi
+
+import (
+	"bufio"
+	"strings"
+)
+
+// Section represents a section from dmidecode output
+type Section struct {
+	Handle     string                 `json:"handle,omitempty"`
+	Title      string                 `json:"title,omitempty"`
+	Properties map[string]interface{} `json:"properties,omitempty"`
+}
+
+// Parse splits dmidecode output into sections. Lines before the first
+// "Handle" line become a "Header" section; a section without a title is
+// named after its handle.
+func Parse(output string) ([]Section, error) {
+	var sections []Section
+	var currentSection *Section
+	expectingTitle := false
+	var currentPropKey string
+
+	// Collect header lines (until the first line starting with "Handle")
+	headerLines := []string{}
+	inHeader := true
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+
+		if inHeader {
+			if strings.HasPrefix(line, "Handle") {
+				// If the header is not empty, add it as a section with "Header" title
+				if len(headerLines) > 0 {
+					headerSection := Section{
+						Title: "Header",
+						Properties: map[string]interface{}{
+							"Content": strings.Join(headerLines, "\n"),
+						},
+					}
+					sections = append(sections, headerSection)
+				}
+				inHeader = false
+				// Process the current line as the beginning of a section
+			} else {
+				headerLines = append(headerLines, line)
+				continue
+			}
+		}
+
+		// Start a new section
+		if strings.HasPrefix(line, "Handle") {
+			if currentSection != nil {
+				// If title is empty, use handle value as title
+				if currentSection.Title == "" {
+					currentSection.Title = currentSection.Handle
+				}
+				sections = append(sections, *currentSection)
+			}
+			currentSection = &Section{
+				Handle:     strings.TrimPrefix(line, "Handle "),
+				Properties: make(map[string]interface{}),
+			}
+			expectingTitle = true
+			currentPropKey = ""
+			continue
+		}
+
+		// If title is expected, assign the current line as section title
+		if expectingTitle {
+			currentSection.Title = trimmed
+			expectingTitle = false
+			continue
+		}
+
+		// Process lines with properties
+		if colonIndex := strings.Index(trimmed, ":"); colonIndex != -1 {
+			key := strings.TrimSpace(trimmed[:colonIndex])
+			value := strings.TrimSpace(trimmed[colonIndex+1:])
+			if existing, ok := currentSection.Properties[key]; ok {
+				// If the property already exists, convert it to an array
+				switch v := existing.(type) {
+				case []string:
+					currentSection.Properties[key] = append(v, value)
+				case string:
+					currentSection.Properties[key] = []string{v, value}
+				default:
+					currentSection.Properties[key] = value
+				}
+			} else {
+				currentSection.Properties[key] = value
+			}
+			currentPropKey = key
+		} else {
+			// If the line does not contain a colon, assume it is a continuation of the previous property
+			if currentPropKey != "" {
+				if existing, ok := currentSection.Properties[currentPropKey]; ok {
+					if str, ok2 := existing.(string); ok2 {
+						currentSection.Properties[currentPropKey] = str + " " + trimmed
+					} else if arr, ok2 := existing.([]string); ok2 {
+						if len(arr) > 0 {
+							arr[len(arr)-1] = arr[len(arr)-1] + " " + trimmed
+							currentSection.Properties[currentPropKey] = arr
+						} else {
+							currentSection.Properties[currentPropKey] = trimmed
+						}
+					}
+				}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if currentSection != nil {
+		// If title is empty, use handle value as title
+		if currentSection.Title == "" {
+			currentSection.Title = currentSection.Handle
+		}
+		sections = append(sections, *currentSection)
+	}
+	return sections, nil
+}
+
+// SystemInfo groups sections by title for the JSON log. Repeated titles
+// (several memory devices, processors) become arrays.
+func SystemInfo(sections []Section) map[string]interface{} {
+	systemInfo := make(map[string]interface{})
+	for _, sec := range sections {
+		key := sec.Title
+		if key == "" {
+			key = sec.Handle // Use handle if title is empty
+		}
+
+		sectionData := make(map[string]interface{})
+		if sec.Handle != "" {
+			sectionData["handle"] = sec.Handle
+		}
+
+		// Only include properties if they are not empty
+		if len(sec.Properties) > 0 {
+			sectionData["properties"] = sec.Properties
+		}
+
+		// If such a key already exists, convert value to an array or add to existing array
+		if existing, exists := systemInfo[key]; exists {
+			switch v := existing.(type) {
+			case []interface{}:
+				systemInfo[key] = append(v, sectionData)
+			default:
+				systemInfo[key] = []interface{}{v, sectionData}
+			}
+		} else {
+			systemInfo[key] = sectionData
+		}
+	}
+	return systemInfo
+}
+
+// Value returns the first "key: value" property found in the output of
+// `dmidecode -t <type>`, e.g. Value(out, "Serial Number").
+func Value(output, key string) (string, bool) {
+	for _, line := range strings.Split(output, "\n") {
+		k, v, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if ok && strings.TrimSpace(k) == key {
+			return strings.TrimSpace(v), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,94 @@
+package dmi
+
+import (
+	"reflect"
+	"testing"
+)
+
+const sample = `# dmidecode 3.6
+Getting SMBIOS data from sysfs.
+SMBIOS 3.2.0 present.
+
+Handle 0x0001, DMI type 1, 27 bytes
+System Information
+	Manufacturer: Default string
+	Product Name: Silver
+	Serial Number: INF00A441241919
+
+Handle 0x0002, DMI type 2, 15 bytes
+Base Board Information
+	Manufacturer: Default string
+	Serial Number: INF00A340242149
+	Features:
+		Board is a hosting board
+		Board is replaceable
+
+Handle 0x0011, DMI type 17, 40 bytes
+Memory Device
+	Size: 8 GB
+	Locator: DIMM0
+
+Handle 0x0012, DMI type 17, 40 bytes
+Memory Device
+	Size: 8 GB
+	Locator: DIMM1
+`
+
+func TestParse(t *testing.T) {
+	sections, err := Parse(sample)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sections) != 5 {
+		t.Fatalf("got %d sections, want 5: %+v", len(sections), sections)
+	}
+	if sections[0].Title != "Header" {
+		t.Errorf("first section = %q, want Header", sections[0].Title)
+	}
+	board := sections[2]
+	if board.Title != "Base Board Information" || board.Handle != "0x0002, DMI type 2, 15 bytes" {
+		t.Errorf("board section = %+v", board)
+	}
+	if got := board.Properties["Serial Number"]; got != "INF00A340242149" {
+		t.Errorf("board serial = %v", got)
+	}
+	// Lines without a colon continue the previous property
+	if got := board.Properties["Features"]; got != " Board is a hosting board Board is replaceable" {
+		t.Errorf("board features = %q", got)
+	}
+}
+
+func TestSystemInfoGroupsRepeatedTitles(t *testing.T) {
+	sections, err := Parse(sample)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := SystemInfo(sections)
+	mem, ok := info["Memory Device"].([]interface{})
+	if !ok || len(mem) != 2 {
+		t.Fatalf("Memory Device = %#v, want two entries", info["Memory Device"])
+	}
+	if _, ok := info["System Information"].(map[string]interface{}); !ok {
+		t.Fatalf("System Information = %#v", info["System Information"])
+	}
+}
+
+func TestValue(t *testing.T) {
+	cases := []struct {
+		key, want string
+		ok        bool
+	}{
+		{"Product Name", "Silver", true},
+		{"Serial Number", "INF00A441241919", true}, // first match wins
+		{"Asset Tag", "", false},
+	}
+	for _, c := range cases {
+		got, ok := Value(sample, c.key)
+		if got != c.want || ok != c.ok {
+			t.Errorf("Value(%q) = %q, %v; want %q, %v", c.key, got, ok, c.want, c.ok)
+		}
+	}
+	if !reflect.DeepEqual(SystemInfo(nil), map[string]interface{}{}) {
+		t.Error("SystemInfo(nil) is not empty")
+	}
+}
@@ -0,0 +1,310 @@
+// Package efivarfs reads, writes, lists and deletes UEFI variables through
+// the efivarfs file system, without the efivar and chattr binaries.
+//
+// Every variable is a file named <Name>-<GUID>. Its content is a 4-byte
+// little-endian attribute mask followed by the payload. Writes must be a
+// single write(2) of header and payload. The kernel marks most variable files
+// immutable, so the flag has to be cleared before a file can be rewritten or removed.
+package efivarfs
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// DefaultDir is where efivarfs is mounted on Linux.
+const DefaultDir = "/sys/firmware/efi/efivars"
+
+// Attributes is the EFI_VARIABLE_* attribute mask stored in the file header.
+type Attributes uint32
+
+const (
+	NonVolatile                       Attributes = 0x00000001
+	BootserviceAccess                 Attributes = 0x00000002
+	RuntimeAccess                     Attributes = 0x00000004
+	HardwareErrorRecord               Attributes = 0x00000008
+	AuthenticatedWriteAccess          Attributes = 0x00000010
+	TimeBasedAuthenticatedWriteAccess Attributes = 0x00000020
+	AppendWrite                       Attributes = 0x00000040
+
+	// DefaultAttributes is what `efivar --attributes=7` used to set.
+	DefaultAttributes = NonVolatile | BootserviceAccess | RuntimeAccess
+)
+
+var attributeNames = []struct {
+	bit  Attributes
+	name string
+}{
+	{NonVolatile, "NV"},
+	{BootserviceAccess, "BS"},
+	{RuntimeAccess, "RT"},
+	{HardwareErrorRecord, "HR"},
+	{AuthenticatedWriteAccess, "AW"},
+	{TimeBasedAuthenticatedWriteAccess, "AT"},
+	{AppendWrite, "AP"},
+}
+
+// String returns the short form used by efivar, e.g. "NV|BS|RT".
+func (a Attributes) String() string {
+	var parts []string
+	for _, n := range attributeNames {
+		if a&n.bit != 0 {
+			parts = append(parts, n.name)
+			a &^= n.bit
+		}
+	}
+	if a != 0 {
+		parts = append(parts, fmt.Sprintf("%#x", uint32(a)))
+	}
+	if len(parts) == 0 {
+		return "0"
+	}
+	return strings.Join(parts, "|")
+}
+
+// GUID is an EFI_GUID in its in-memory layout: the first three fields are
+// little-endian, the last eight bytes are stored as-is.
+type GUID [16]byte
+
+// ParseGUID parses the canonical 8-4-4-4-12 hex form, case-insensitively.
+func ParseGUID(s string) (GUID, error) {
+	var g GUID
+	if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return g, fmt.Errorf("invalid GUID %q", s)
+	}
+	raw, err := hex.DecodeString(s[0:8] + s[9:13] + s[14:18] + s[19:23] + s[24:36])
+	if err != nil {
+		return g, fmt.Errorf("invalid GUID %q: %v", s, err)
+	}
+	binary.LittleEndian.PutUint32(g[0:4], binary.BigEndian.Uint32(raw[0:4]))
+	binary.LittleEndian.PutUint16(g[4:6], binary.BigEndian.Uint16(raw[4:6]))
+	binary.LittleEndian.PutUint16(g[6:8], binary.BigEndian.Uint16(raw[6:8]))
+	copy(g[8:], raw[8:])
+	return g, nil
+}
+
+// MustParseGUID is like ParseGUID but panics on error. It is meant for constants.
+func MustParseGUID(s string) GUID {
+	g, err := ParseGUID(s)
+	if err != nil {
+		panic(err)
+	}
+	return g
+}
+
+// String formats the GUID the way efivarfs names files: lowercase 8-4-4-4-12.
+func (g GUID) String() string {
+	return fmt.Sprintf("%08x-%04x-%04x-%x-%x",
+		binary.LittleEndian.Uint32(g[0:4]),
+		binary.LittleEndian.Uint16(g[4:6]),
+		binary.LittleEndian.Uint16(g[6:8]),
+		g[8:10], g[10:16])
+}
+
+// uuid returns the RFC 4122 big-endian byte order of g.
+func (g GUID) uuid() [16]byte {
+	var b [16]byte
+	binary.BigEndian.PutUint32(b[0:4], binary.LittleEndian.Uint32(g[0:4]))
+	binary.BigEndian.PutUint16(b[4:6], binary.LittleEndian.Uint16(g[4:6]))
+	binary.BigEndian.PutUint16(b[6:8], binary.LittleEndian.Uint16(g[6:8]))
+	copy(b[8:], g[8:])
+	return b
+}
+
+func fromUUID(b [16]byte) GUID {
+	var g GUID
+	binary.LittleEndian.PutUint32(g[0:4], binary.BigEndian.Uint32(b[0:4]))
+	binary.LittleEndian.PutUint16(g[4:6], binary.BigEndian.Uint16(b[4:6]))
+	binary.LittleEndian.PutUint16(g[6:8], binary.BigEndian.Uint16(b[6:8]))
+	copy(g[8:], b[8:])
+	return g
+}
+
+// NameGUID returns the name-based (version 5, SHA-1) UUID of name in the
+// given namespace. The same namespace and name always give the same GUID.
+func NameGUID(namespace GUID, name string) GUID {
+	ns := namespace.uuid()
+	h := sha1.New()
+	h.Write(ns[:])
+	h.Write([]byte(name))
+	var b [16]byte
+	copy(b[:], h.Sum(nil))
+	b[6] = b[6]&0x0f | 0x50 // version 5
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+	return fromUUID(b)
+}
+
+// VarID identifies a variable.
+type VarID struct {
+	Name string
+	GUID GUID
+}
+
+// FileName returns the efivarfs file name, <Name>-<GUID>.
+func (v VarID) FileName() string {
+	return v.Name + "-" + v.GUID.String()
+}
+
+func (v VarID) String() string {
+	return v.FileName()
+}
+
+// ParseFileName splits an efivarfs file name into name and GUID.
+func ParseFileName(fileName string) (VarID, error) {
+	if len(fileName) < 38 || fileName[len(fileName)-37] != '-' {
+		return VarID{}, fmt.Errorf("invalid efivarfs name %q", fileName)
+	}
+	g, err := ParseGUID(fileName[len(fileName)-36:])
+	if err != nil {
+		return VarID{}, err
+	}
+	return VarID{Name: fileName[:len(fileName)-37], GUID: g}, nil
+}
+
+// ErrShortVariable is returned when a variable file is missing its attribute header.
+var ErrShortVariable = errors.New("efivarfs: variable shorter than the attribute header")
+
+// FS is an efivarfs mount. Tests point Dir at a plain directory.
+type FS struct {
+	Dir string
+}
+
+// New returns an FS rooted at dir.
+func New(dir string) *FS {
+	return &FS{Dir: dir}
+}
+
+// Default returns the FS at DefaultDir.
+func Default() *FS {
+	return New(DefaultDir)
+}
+
+// String returns the mount directory.
+func (fs *FS) String() string {
+	return fs.Dir
+}
+
+func (fs *FS) path(v VarID) string {
+	return filepath.Join(fs.Dir, v.FileName())
+}
+
+// Read returns the attributes and payload of a variable.
+func (fs *FS) Read(v VarID) (Attributes, []byte, error) {
+	data, err := os.ReadFile(fs.path(v))
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(data) < 4 {
+		return 0, nil, fmt.Errorf("%s: %w", v, ErrShortVariable)
+	}
+	return Attributes(binary.LittleEndian.Uint32(data[:4])), data[4:], nil
+}
+
+// Write creates or replaces a variable. An existing file has its immutable
+// flag cleared first.
+func (fs *FS) Write(v VarID, attrs Attributes, data []byte) error {
+	path := fs.path(v)
+	if err := clearImmutable(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	buf := make([]byte, 4+len(data))
+	binary.LittleEndian.PutUint32(buf[:4], uint32(attrs))
+	copy(buf[4:], data)
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	// efivarfs rejects a header and payload split across several writes
+	n, err := f.Write(buf)
+	if err == nil && n != len(buf) {
+		err = fmt.Errorf("%s: short write (%d of %d bytes)", v, n, len(buf))
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Delete clears the immutable flag and removes the variable.
+func (fs *FS) Delete(v VarID) error {
+	path := fs.path(v)
+	if err := clearImmutable(path); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// List returns all variables in the mount, sorted by file name. Entries that
+// are not <Name>-<GUID> files are skipped.
+func (fs *FS) List() ([]VarID, error) {
+	entries, err := os.ReadDir(fs.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var vars []VarID
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		v, err := ParseFileName(e.Name())
+		if err != nil {
+			continue
+		}
+		vars = append(vars, v)
+	}
+	sort.Slice(vars, func(a, b int) bool { return vars[a].FileName() < vars[b].FileName() })
+	return vars, nil
+}
+
+// ListName returns all variables called name, whatever their GUID.
+func (fs *FS) ListName(name string) ([]VarID, error) {
+	all, err := fs.List()
+	if err != nil {
+		return nil, err
+	}
+	var vars []VarID
+	for _, v := range all {
+		if v.Name == name {
+			vars = append(vars, v)
+		}
+	}
+	return vars, nil
+}
+
+// fsImmutableFL is FS_IMMUTABLE_FL from linux/fs.h.
+const fsImmutableFL = 0x00000010
+
+// clearImmutable drops FS_IMMUTABLE_FL, like `chattr -i`. File systems that
+// do not support inode flags (for example a test directory on tmpfs) are
+// treated as having no immutable flag.
+func clearImmutable(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	flags, err := unix.IoctlGetUint32(int(f.Fd()), unix.FS_IOC_GETFLAGS)
+	if err != nil {
+		if errors.Is(err, unix.ENOTTY) || errors.Is(err, unix.EOPNOTSUPP) || errors.Is(err, unix.EINVAL) {
+			return nil
+		}
+		return fmt.Errorf("%s: get inode flags: %v", path, err)
+	}
+	if flags&fsImmutableFL == 0 {
+		return nil
+	}
+	if err := unix.IoctlSetPointerInt(int(f.Fd()), unix.FS_IOC_SETFLAGS, int(flags&^fsImmutableFL)); err != nil {
+		return fmt.Errorf("%s: set inode flags: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package efivarfs
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Global variable GUID (EFI_GLOBAL_VARIABLE); its byte layout is documented in the UEFI spec.
+const globalGUID = "8be4df61-93ca-11d2-aa0d-00e098032b8c"
+
+func TestParseGUID(t *testing.T) {
+	g, err := ParseGUID(globalGUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := GUID{0x61, 0xdf, 0xe4, 0x8b, 0xca, 0x93, 0xd2, 0x11, 0xaa, 0x0d, 0x00, 0xe0, 0x98, 0x03, 0x2b, 0x8c}
+	if g != want {
+		t.Fatalf("ParseGUID(%q) = %x, want %x", globalGUID, g[:], want[:])
+	}
+	if s := g.String(); s != globalGUID {
+		t.Fatalf("String() = %q, want %q", s, globalGUID)
+	}
+	upper, err := ParseGUID("8BE4DF61-93CA-11D2-AA0D-00E098032B8C")
+	if err != nil || upper != g {
+		t.Fatalf("upper-case GUID: %v, %x", err, upper[:])
+	}
+}
+
+func TestParseGUIDInvalid(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"8be4df61-93ca-11d2-aa0d-00e098032b8",   // short
+		"8be4df61-93ca-11d2-aa0d-00e098032b8c0", // long
+		"8be4df6193ca-11d2-aa0d-00e098032b8c-",  // dashes misplaced
+		"8be4df61-93ca-11d2-aa0d-00e098032bzz",  // not hex
+	} {
+		if _, err := ParseGUID(s); err == nil {
+			t.Errorf("ParseGUID(%q) succeeded", s)
+		}
+	}
+}
+
+func TestNameGUID(t *testing.T) {
+	// uuid.uuid5(uuid.NAMESPACE_DNS, "python.org") from the Python documentation
+	dns := MustParseGUID("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	if got := NameGUID(dns, "python.org").String(); got != "886313e1-3b8a-5372-9b90-0c9aee199e5d" {
+		t.Fatalf("NameGUID = %s", got)
+	}
+	if NameGUID(dns, "Silver") == NameGUID(dns, "IFMBH610MTPR") {
+		t.Fatal("different names gave the same GUID")
+	}
+}
+
+func TestParseFileName(t *testing.T) {
+	v, err := ParseFileName("Serial-Number-" + globalGUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Name != "Serial-Number" || v.GUID.String() != globalGUID {
+		t.Fatalf("ParseFileName = %+v", v)
+	}
+	if v.FileName() != "Serial-Number-"+globalGUID {
+		t.Fatalf("FileName() = %q", v.FileName())
+	}
+	for _, name := range []string{globalGUID, "Boot0000", "x" + globalGUID} {
+		if _, err := ParseFileName(name); err == nil {
+			t.Errorf("ParseFileName(%q) succeeded", name)
+		}
+	}
+}
+
+func TestAttributesString(t *testing.T) {
+	cases := map[Attributes]string{
+		0:                         "0",
+		DefaultAttributes:         "NV|BS|RT",
+		NonVolatile | 0x1000:      "NV|0x1000",
+		AppendWrite | NonVolatile: "NV|AP",
+	}
+	for a, want := range cases {
+		if got := a.String(); got != want {
+			t.Errorf("Attributes(%#x).String() = %q, want %q", uint32(a), got, want)
+		}
+	}
+}
+
+func newFake(t *testing.T) *FS {
+	t.Helper()
+	return New(t.TempDir())
+}
+
+func TestWriteRead(t *testing.T) {
+	fs := newFake(t)
+	v := VarID{Name: "SerialNumber", GUID: MustParseGUID(globalGUID)}
+	if err := fs.Write(v, DefaultAttributes, []byte("INF00A340242149")); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := os.ReadFile(filepath.Join(fs.Dir, "SerialNumber-"+globalGUID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := append([]byte{7, 0, 0, 0}, "INF00A340242149"...); !bytes.Equal(raw, want) {
+		t.Fatalf("file content = %q, want %q", raw, want)
+	}
+
+	attrs, data, err := fs.Read(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attrs != DefaultAttributes || string(data) != "INF00A340242149" {
+		t.Fatalf("Read = %v %q", attrs, data)
+	}
+
+	// A rewrite replaces the whole content
+	if err := fs.Write(v, NonVolatile, []byte("X")); err != nil {
+		t.Fatal(err)
+	}
+	attrs, data, err = fs.Read(v)
+	if err != nil || attrs != NonVolatile || string(data) != "X" {
+		t.Fatalf("Read after rewrite = %v %q %v", attrs, data, err)
+	}
+}
+
+func TestReadShortAndMissing(t *testing.T) {
+	fs := newFake(t)
+	v := VarID{Name: "Broken", GUID: MustParseGUID(globalGUID)}
+	if err := os.WriteFile(filepath.Join(fs.Dir, v.FileName()), []byte{7, 0}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := fs.Read(v); !errors.Is(err, ErrShortVariable) {
+		t.Fatalf("Read short file: %v", err)
+	}
+	missing := VarID{Name: "Missing", GUID: v.GUID}
+	if _, _, err := fs.Read(missing); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Read missing: %v", err)
+	}
+	if err := fs.Delete(missing); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Delete missing: %v", err)
+	}
+}
+
+func TestListAndDelete(t *testing.T) {
+	fs := newFake(t)
+	g1 := MustParseGUID(globalGUID)
+	g2 := MustParseGUID("12345678-0000-4000-8000-0123456789ab")
+	vars := []VarID{
+		{Name: "SerialNumber", GUID: g2},
+		{Name: "SerialNumber", GUID: g1},
+		{Name: "HexMac", GUID: g1},
+	}
+	for _, v := range vars {
+		if err := fs.Write(v, DefaultAttributes, []byte(v.Name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Unrelated files and directories are not listed
+	if err := os.WriteFile(filepath.Join(fs.Dir, "README"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(fs.Dir, "Dir-"+globalGUID), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := fs.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 3 || all[0].Name != "HexMac" {
+		t.Fatalf("List = %v", all)
+	}
+
+	serials, err := fs.ListName("SerialNumber")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(serials) != 2 {
+		t.Fatalf("ListName = %v", serials)
+	}
+	for _, v := range serials {
+		if err := fs.Delete(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	all, err = fs.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 || all[0].Name != "HexMac" || all[0].GUID != g1 {
+		t.Fatalf("List after delete = %v", all)
+	}
+}
+
+func TestListMissingDir(t *testing.T) {
+	fs := New(filepath.Join(t.TempDir(), "absent"))
+	if _, err := fs.List(); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("List on missing dir: %v", err)
+	}
+}
@@ -0,0 +1,165 @@
+// Package history indexes the operation logs that serial_to_uefi writes (one
+// JSON file per run under logs/) so that a serial number or MAC address that
+// was already provisioned on another unit can be found before flashing.
+package history
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Record is the part of an operation log the history needs.
+type Record struct {
+	File      string `json:"-"`
+	Timestamp string `json:"timestamp"`
+	Product   string `json:"product_name"`
+	MbSN      string `json:"mb_serial_number"`
+	IoSN      string `json:"io_serial_number"`
+	MAC       string `json:"mac_address"`
+	Action    string `json:"action_performed"`
+	Success   bool   `json:"success"`
+	Operator  string `json:"operator"`
+	StationID string `json:"station_id"`
+	UUID      string `json:"-"` // DMI system UUID of the board, if logged
+}
+
+// DB is the history of provisioned units, oldest record first.
+type DB struct {
+	Records []Record
+}
+
+// Load reads every *.json file in dirs. Files that are not operation logs,
+// such as configuration files next to emergency logs, are skipped; a missing
+// directory is an empty history.
+func Load(dirs ...string) (*DB, error) {
+	db := &DB{}
+	for _, dir := range dirs {
+		files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			var log struct {
+				Record
+				SystemInfo map[string]json.RawMessage `json:"system_info"`
+			}
+			if json.Unmarshal(data, &log) != nil || log.MbSN == "" || log.Timestamp == "" {
+				continue
+			}
+			r := log.Record
+			r.File = file
+			r.UUID = systemUUID(log.SystemInfo)
+			db.Records = append(db.Records, r)
+		}
+	}
+	sort.SliceStable(db.Records, func(i, j int) bool {
+		return db.Records[i].Timestamp < db.Records[j].Timestamp
+	})
+	return db, nil
+}
+
+// ByMAC returns the successful runs that left mac on a unit. MACs are
+// compared without separators and case.
+func (db *DB) ByMAC(mac string) []Record {
+	want := NormalizeMAC(mac)
+	var found []Record
+	for _, r := range db.Records {
+		if r.Success && r.MAC != "" && NormalizeMAC(r.MAC) == want {
+			found = append(found, r)
+		}
+	}
+	return found
+}
+
+// MACConflicts returns the successful runs that left mac on a unit other
+// than mbSN.
+func (db *DB) MACConflicts(mac, mbSN string) []Record {
+	var found []Record
+	for _, r := range db.ByMAC(mac) {
+		if r.MbSN != mbSN {
+			found = append(found, r)
+		}
+	}
+	return found
+}
+
+// SerialConflicts returns the successful runs that put sn (as mbSN or ioSN)
+// on another board. The board is told by its DMI system UUID and, where
+// either run lacks it, by a MAC: the run's MAC must be one of macs, the MACs
+// known to be on this board. A run that logged neither is counted as another
+// board.
+func (db *DB) SerialConflicts(sn, uuid string, macs []string) []Record {
+	var found []Record
+	for _, r := range db.Records {
+		if !r.Success || (r.MbSN != sn && r.IoSN != sn) {
+			continue
+		}
+		if !sameBoard(r, uuid, macs) {
+			found = append(found, r)
+		}
+	}
+	return found
+}
+
+func sameBoard(r Record, uuid string, macs []string) bool {
+	if validUUID(r.UUID) && validUUID(uuid) {
+		return strings.EqualFold(r.UUID, uuid)
+	}
+	if r.MAC == "" {
+		return false
+	}
+	for _, mac := range macs {
+		if mac != "" && NormalizeMAC(r.MAC) == NormalizeMAC(mac) {
+			return true
+		}
+	}
+	return false
+}
+
+// validUUID filters out the placeholders that boards without a programmed
+// UUID report.
+func validUUID(uuid string) bool {
+	u := strings.ToLower(strings.TrimSpace(uuid))
+	switch u {
+	case "", "not settable", "not present", "00000000-0000-0000-0000-000000000000", "ffffffff-ffff-ffff-ffff-ffffffffffff", "03000200-0400-0500-0006-000700080009":
+		return false
+	}
+	return true
+}
+
+// systemUUID finds the UUID of the "System Information" section of a log's
+// system_info; the section is an object or, with several handles, a list.
+func systemUUID(info map[string]json.RawMessage) string {
+	type section struct {
+		Properties map[string]string `json:"properties"`
+	}
+	raw, ok := info["System Information"]
+	if !ok {
+		return ""
+	}
+	var one section
+	if json.Unmarshal(raw, &one) == nil {
+		return one.Properties["UUID"]
+	}
+	var many []section
+	if json.Unmarshal(raw, &many) == nil {
+		for _, s := range many {
+			if u := s.Properties["UUID"]; u != "" {
+				return u
+			}
+		}
+	}
+	return ""
+}
+
+// NormalizeMAC returns mac in lower case without ':' and '-' separators.
+func NormalizeMAC(mac string) string {
+	return strings.ToLower(strings.NewReplacer(":", "", "-", "").Replace(strings.TrimSpace(mac)))
+}
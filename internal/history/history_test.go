@@ -0,0 +1,82 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeLog(t *testing.T, dir, name, data string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	logs, cwd := t.TempDir(), t.TempDir()
+	writeLog(t, logs, "Silver_A-250228101127.json", `{"timestamp": "2025-02-28T10:11:27", "mb_serial_number": "A", "mac_address": "00:E0:4C:68:2D:2C", "success": true}`)
+	writeLog(t, logs, "Silver_A-250228100602.json", `{"timestamp": "2025-02-28T10:06:02", "mb_serial_number": "A", "mac_address": "00:E0:4C:68:2D:2C", "success": false}`)
+	writeLog(t, logs, "broken.json", `{"timestamp": `)
+	writeLog(t, cwd, "Silver_B-250301090000.json", `{"timestamp": "2025-03-01T09:00:00", "mb_serial_number": "B", "mac_address": "00e04c682d2c", "success": true}`)
+	writeLog(t, cwd, "unit_rules.json", `{"products": []}`)
+
+	db, err := Load(logs, cwd, filepath.Join(cwd, "missing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(db.Records) != 3 {
+		t.Fatalf("%d records, want 3: %+v", len(db.Records), db.Records)
+	}
+	if db.Records[0].Timestamp != "2025-02-28T10:06:02" || db.Records[2].MbSN != "B" {
+		t.Errorf("records are not sorted by time: %+v", db.Records)
+	}
+
+	if got := db.ByMAC("00-E0-4C-68-2D-2C"); len(got) != 2 {
+		t.Errorf("ByMAC: %d successful records, want 2", len(got))
+	}
+	if got := db.MACConflicts("00:e0:4c:68:2d:2c", "A"); len(got) != 1 || got[0].MbSN != "B" {
+		t.Errorf("MACConflicts for A = %+v", got)
+	}
+	if got := db.MACConflicts("00:E0:4C:68:2D:2D", "A"); len(got) != 0 {
+		t.Errorf("MACConflicts for an unused MAC = %+v", got)
+	}
+}
+
+func TestSerialConflicts(t *testing.T) {
+	dir := t.TempDir()
+	const uuid, other = "a951b880-d54c-11ee-a727-0af5daed9b00", "b951b880-d54c-11ee-a727-0af5daed9b00"
+	writeLog(t, dir, "1.json", `{"timestamp": "2025-02-28T10:06:02", "mb_serial_number": "A", "io_serial_number": "IO1", "mac_address": "00:E0:4C:68:2D:2C", "success": true,
+		"system_info": {"System Information": {"properties": {"UUID": "`+uuid+`"}}}}`)
+	writeLog(t, dir, "2.json", `{"timestamp": "2025-03-01T09:00:00", "mb_serial_number": "B", "mac_address": "00:E0:4C:68:2D:2D", "success": true,
+		"system_info": {"System Information": [{"properties": {"UUID": "03000200-0400-0500-0006-000700080009"}}]}}`)
+	writeLog(t, dir, "3.json", `{"timestamp": "2025-03-02T09:00:00", "mb_serial_number": "C", "success": false}`)
+	db, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.Records[0].UUID != uuid || db.Records[1].UUID == "" {
+		t.Fatalf("UUIDs not read: %+v", db.Records)
+	}
+
+	for _, c := range []struct {
+		sn, uuid  string
+		macs      []string
+		conflicts int
+	}{
+		{"A", uuid, nil, 0},                                         // same board
+		{"A", other, nil, 1},                                        // another board
+		{"IO1", other, nil, 1},                                      // the IO board serial
+		{"A", "", []string{"00:e0:4c:68:2d:2c"}, 0},                 // no UUID, same MAC
+		{"A", "", []string{"00:e0:4c:00:00:01", "00e04c682d2c"}, 0}, // no UUID, the MAC on a second port
+		{"A", "", []string{"00:e0:4c:00:00:01"}, 1},                 // no UUID, another MAC
+		{"B", other, []string{"00e04c682d2d"}, 0},                   // placeholder UUID, same MAC
+		{"B", "", nil, 1},                                           // nothing to tell
+		{"C", "", nil, 0},                                           // failed run
+		{"D", "", nil, 0},
+	} {
+		if got := db.SerialConflicts(c.sn, c.uuid, c.macs); len(got) != c.conflicts {
+			t.Errorf("SerialConflicts(%q, %q, %q) = %d records, want %d", c.sn, c.uuid, c.macs, len(got), c.conflicts)
+		}
+	}
+}
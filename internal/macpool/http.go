@@ -0,0 +1,115 @@
+package macpool
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HTTP is a remote allocator, e.g. the MES or a small service in front of a
+// shared database. Every call is a POST of a JSON body:
+//
+//	/reserve {"unit": "...", "mac": ""}  -> {"lease": "...", "mac": "...", "unit": "...", "state": "reserved"}
+//
+// A reserve answers "committed" when the MAC is already burned into the unit
+// (a rerun); an empty state means "reserved".
+//
+//	/commit  {"lease": "...", ...}       -> 2xx
+//	/release {"lease": "...", ...}       -> 2xx
+//	/retire  {"lease": "...", "unit": "unit that has the MAC", ...} -> 2xx
+//
+// 409 Conflict means the MAC is taken, 410 Gone that the pool is exhausted
+// and 404 that the lease is unknown.
+type HTTP struct {
+	URL    string
+	Pool   Pool
+	Client *http.Client
+}
+
+// NewHTTP returns a remote allocator for the service at url.
+func NewHTTP(url string, pool Pool) *HTTP {
+	return &HTTP{URL: strings.TrimSuffix(url, "/"), Pool: pool, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Reserve implements Allocator.
+func (h *HTTP) Reserve(unit, mac string) (Lease, error) {
+	if mac != "" {
+		if err := h.Pool.Validate(mac); err != nil {
+			return Lease{}, err
+		}
+	}
+	var lease Lease
+	if err := h.post("reserve", Lease{Unit: unit, MAC: mac}, &lease); err != nil {
+		return Lease{}, err
+	}
+	// Do not trust the service: the address must be in our range
+	if err := h.Pool.Validate(lease.MAC); err != nil {
+		return Lease{}, fmt.Errorf("allocator returned %q: %v", lease.MAC, err)
+	}
+	if lease.ID == "" {
+		return Lease{}, fmt.Errorf("allocator returned no lease for %s", lease.MAC)
+	}
+	switch lease.State {
+	case "":
+		lease.State = StateReserved
+	case StateReserved, StateCommitted:
+	default:
+		return Lease{}, fmt.Errorf("allocator returned %s in state %q", lease.MAC, lease.State)
+	}
+	v, _ := ParseMAC(lease.MAC)
+	lease.MAC, lease.Unit = FormatMAC(v), unit
+	return lease, nil
+}
+
+// Commit implements Allocator.
+func (h *HTTP) Commit(l Lease) error {
+	return h.post("commit", l, nil)
+}
+
+// Release implements Allocator.
+func (h *HTTP) Release(l Lease) error {
+	return h.post("release", l, nil)
+}
+
+// Retire implements Allocator.
+func (h *HTTP) Retire(l Lease) error {
+	return h.post("retire", l, nil)
+}
+
+func (h *HTTP) post(op string, body Lease, out *Lease) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	resp, err := h.Client.Post(h.URL+"/"+op, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+
+	var sentinel error
+	switch resp.StatusCode {
+	case http.StatusConflict:
+		sentinel = ErrTaken
+	case http.StatusGone:
+		sentinel = ErrExhausted
+	case http.StatusNotFound:
+		sentinel = ErrUnknownLease
+	}
+	switch {
+	case sentinel != nil:
+		return fmt.Errorf("%s: %w: %s", op, sentinel, strings.TrimSpace(string(msg)))
+	case resp.StatusCode/100 != 2:
+		return fmt.Errorf("%s: %s: %s", op, resp.Status, strings.TrimSpace(string(msg)))
+	case out != nil:
+		if err := json.Unmarshal(msg, out); err != nil {
+			return fmt.Errorf("%s: parse response: %v", op, err)
+		}
+	}
+	return nil
+}
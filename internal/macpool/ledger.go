@@ -0,0 +1,222 @@
+package macpool
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Ledger is a local allocator: a JSON file with one entry per reserved or
+// committed address. Stations that share the file (e.g. over NFS) serialise
+// on a lock file next to it.
+type Ledger struct {
+	Path string
+	Pool Pool
+	TTL  time.Duration // reservations older than this are dropped
+
+	now func() time.Time // tests
+}
+
+// ledgerEntry is one allocated address.
+type ledgerEntry struct {
+	Lease
+	Time time.Time `json:"time"`
+}
+
+type ledgerFile struct {
+	Entries []ledgerEntry `json:"entries"`
+}
+
+// Reserve implements Allocator.
+func (l *Ledger) Reserve(unit, mac string) (Lease, error) {
+	var lease Lease
+	err := l.update(func(f *ledgerFile) error {
+		want := uint64(0)
+		if mac != "" {
+			v, err := ParseMAC(mac)
+			if err != nil {
+				return err
+			}
+			if err := l.Pool.Validate(mac); err != nil {
+				return err
+			}
+			want = v
+		}
+
+		used := map[uint64]bool{}
+		for i := range f.Entries {
+			e := &f.Entries[i]
+			v, err := ParseMAC(e.MAC)
+			if err != nil {
+				return fmt.Errorf("ledger entry %q: %v", e.MAC, err)
+			}
+			used[v] = true
+			switch {
+			case mac != "" && v == want && (e.Unit != unit || e.State == StateRetired):
+				return fmt.Errorf("%w: %s is %s for %s", ErrTaken, e.MAC, e.State, e.Unit)
+			case e.Unit == unit && e.State != StateRetired && (mac == "" || v == want):
+				// A repeated run for the same unit gets the same address
+				if e.State == StateReserved {
+					e.Time = l.time()
+				}
+				lease = e.Lease
+				return nil
+			}
+		}
+
+		if mac == "" {
+			for v := l.Pool.First; ; v++ {
+				if !used[v] {
+					want = v
+					break
+				}
+				if v == l.Pool.Last {
+					return fmt.Errorf("%w: %s", ErrExhausted, l.Pool)
+				}
+			}
+		}
+		lease = Lease{ID: newLeaseID(), MAC: FormatMAC(want), Unit: unit, State: StateReserved}
+		f.Entries = append(f.Entries, ledgerEntry{Lease: lease, Time: l.time()})
+		return nil
+	})
+	return lease, err
+}
+
+// Commit marks the lease's address as burned into the unit.
+func (l *Ledger) Commit(lease Lease) error {
+	return l.update(func(f *ledgerFile) error {
+		for i := range f.Entries {
+			e := &f.Entries[i]
+			if e.ID == lease.ID {
+				e.State, e.Time = StateCommitted, l.time()
+				return nil
+			}
+		}
+		// The reservation expired but the address is burned: record it if still free
+		for _, e := range f.Entries {
+			if e.MAC == lease.MAC {
+				return fmt.Errorf("%w: %s is %s for %s", ErrTaken, e.MAC, e.State, e.Unit)
+			}
+		}
+		lease.State = StateCommitted
+		f.Entries = append(f.Entries, ledgerEntry{Lease: lease, Time: l.time()})
+		return nil
+	})
+}
+
+// Release frees a reserved address; committed and retired addresses stay
+// allocated.
+func (l *Ledger) Release(lease Lease) error {
+	return l.update(func(f *ledgerFile) error {
+		for i, e := range f.Entries {
+			if e.ID != lease.ID {
+				continue
+			}
+			if e.State != StateReserved {
+				return fmt.Errorf("%s is %s for %s and cannot be released", e.MAC, e.State, e.Unit)
+			}
+			f.Entries = append(f.Entries[:i], f.Entries[i+1:]...)
+			return nil
+		}
+		return fmt.Errorf("%w %s", ErrUnknownLease, lease.ID)
+	})
+}
+
+// Retire implements Allocator: the entry stays in the ledger as retired for
+// l.Unit, so the address is never handed out again.
+func (l *Ledger) Retire(lease Lease) error {
+	return l.update(func(f *ledgerFile) error {
+		for i := range f.Entries {
+			e := &f.Entries[i]
+			if e.ID == lease.ID {
+				e.Unit, e.State, e.Time = lease.Unit, StateRetired, l.time()
+				return nil
+			}
+		}
+		for _, e := range f.Entries {
+			if e.MAC == lease.MAC {
+				return fmt.Errorf("%w: %s is %s for %s", ErrTaken, e.MAC, e.State, e.Unit)
+			}
+		}
+		lease.State = StateRetired
+		f.Entries = append(f.Entries, ledgerEntry{Lease: lease, Time: l.time()})
+		return nil
+	})
+}
+
+// update runs fn on the ledger under the lock, with expired reservations
+// dropped, and writes the result back atomically.
+func (l *Ledger) update(fn func(f *ledgerFile) error) error {
+	lock, err := os.OpenFile(l.Path+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+	if err := unix.Flock(int(lock.Fd()), unix.LOCK_EX); err != nil {
+		return fmt.Errorf("lock %s: %v", l.Path, err)
+	}
+	defer unix.Flock(int(lock.Fd()), unix.LOCK_UN)
+
+	var f ledgerFile
+	data, err := os.ReadFile(l.Path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return err
+	default:
+		if err := json.Unmarshal(data, &f); err != nil {
+			return fmt.Errorf("parse %s: %v", l.Path, err)
+		}
+	}
+
+	kept := f.Entries[:0]
+	for _, e := range f.Entries {
+		if e.State == StateReserved && l.TTL > 0 && l.time().Sub(e.Time) > l.TTL {
+			continue
+		}
+		kept = append(kept, e)
+	}
+	f.Entries = kept
+
+	if err := fn(&f); err != nil {
+		return err
+	}
+	if data, err = json.MarshalIndent(f, "", "  "); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(l.Path), filepath.Base(l.Path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), l.Path)
+}
+
+func (l *Ledger) time() time.Time {
+	if l.now != nil {
+		return l.now()
+	}
+	return time.Now()
+}
+
+func newLeaseID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,204 @@
+// Package macpool hands out MAC addresses from a managed range so that the
+// same address is never flashed onto two units.
+//
+// An address is first reserved for a unit, then committed once it is burned
+// into the NIC, or released if the run failed before that. Reservations
+// that are never settled, e.g. because the station lost power, expire. The
+// allocator is either a local ledger file or a remote HTTP service.
+package macpool
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultFile is the pool configuration next to the tool.
+const DefaultFile = "mac_pool.json"
+
+// Lease states.
+const (
+	StateReserved  = "reserved"
+	StateCommitted = "committed"
+	StateReleased  = "released"
+	StateRetired   = "retired" // burned into a unit outside the pool's records
+)
+
+var (
+	// ErrTaken means the MAC is reserved for or committed to another unit.
+	ErrTaken = errors.New("MAC address is already allocated to another unit")
+	// ErrExhausted means every MAC of the range is allocated.
+	ErrExhausted = errors.New("MAC pool is exhausted")
+	// ErrUnknownLease means the lease does not exist, e.g. it has expired.
+	ErrUnknownLease = errors.New("unknown lease")
+)
+
+// Lease is a MAC address reserved for a unit.
+type Lease struct {
+	ID    string `json:"lease"`
+	MAC   string `json:"mac"`
+	Unit  string `json:"unit"`
+	State string `json:"state"`
+}
+
+// Allocator reserves, commits and releases MAC addresses. Reserve with an
+// empty mac allocates the next free address; with a mac it claims that
+// address for unit. Reserving again for a unit that already holds an
+// address returns the same lease. Retire takes a reserved address out of
+// the pool for good because it turned out to be burned into l.Unit already,
+// e.g. flashed by hand before the pool existed.
+type Allocator interface {
+	Reserve(unit, mac string) (Lease, error)
+	Commit(l Lease) error
+	Release(l Lease) error
+	Retire(l Lease) error
+}
+
+// Config is the pool configuration file.
+type Config struct {
+	OUI        string `json:"oui"`                   // e.g. "00:E0:4C"
+	First      string `json:"first"`                 // first MAC of the range
+	Last       string `json:"last"`                  // last MAC of the range
+	Ledger     string `json:"ledger,omitempty"`      // local ledger file, relative to the tool
+	URL        string `json:"url,omitempty"`         // remote allocator; wins over the ledger
+	ReserveTTL string `json:"reserve_ttl,omitempty"` // how long a reservation is kept, e.g. "30m"
+}
+
+// LoadConfig reads a pool configuration file.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Config
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("parse %s: %v", path, err)
+	}
+	return &c, nil
+}
+
+// Pool returns the validated range of the configuration.
+func (c *Config) Pool() (Pool, error) {
+	return NewPool(c.OUI, c.First, c.Last)
+}
+
+// Allocator returns the configured allocator. A relative ledger path is
+// taken relative to dir.
+func (c *Config) Allocator(dir string) (Allocator, error) {
+	pool, err := c.Pool()
+	if err != nil {
+		return nil, err
+	}
+	if c.URL != "" {
+		return NewHTTP(c.URL, pool), nil
+	}
+	ttl := 30 * time.Minute
+	if c.ReserveTTL != "" {
+		if ttl, err = time.ParseDuration(c.ReserveTTL); err != nil {
+			return nil, fmt.Errorf("reserve_ttl: %v", err)
+		}
+	}
+	path := c.Ledger
+	if path == "" {
+		path = "mac_ledger.json"
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	return &Ledger{Path: path, Pool: pool, TTL: ttl}, nil
+}
+
+// Pool is a range of MAC addresses inside one OUI.
+type Pool struct {
+	OUI         uint64 // upper 24 bits of every address
+	First, Last uint64
+}
+
+// NewPool parses and validates a range: both ends must be unicast addresses
+// of oui and first must not be after last.
+func NewPool(oui, first, last string) (Pool, error) {
+	o, err := parseHex(oui, 3)
+	if err != nil {
+		return Pool{}, fmt.Errorf("oui: %v", err)
+	}
+	if o&0x010000 != 0 {
+		return Pool{}, fmt.Errorf("oui %s is a multicast prefix", oui)
+	}
+	p := Pool{OUI: o}
+	if p.First, err = ParseMAC(first); err != nil {
+		return Pool{}, fmt.Errorf("first: %v", err)
+	}
+	if p.Last, err = ParseMAC(last); err != nil {
+		return Pool{}, fmt.Errorf("last: %v", err)
+	}
+	for _, v := range []uint64{p.First, p.Last} {
+		if v>>24 != o {
+			return Pool{}, fmt.Errorf("%s is outside OUI %s", FormatMAC(v), FormatOUI(o))
+		}
+	}
+	if p.First > p.Last {
+		return Pool{}, fmt.Errorf("first %s is after last %s", FormatMAC(p.First), FormatMAC(p.Last))
+	}
+	return p, nil
+}
+
+// Validate reports whether mac belongs to the pool.
+func (p Pool) Validate(mac string) error {
+	v, err := ParseMAC(mac)
+	if err != nil {
+		return err
+	}
+	if v>>24 != p.OUI {
+		return fmt.Errorf("%s is not in OUI %s", FormatMAC(v), FormatOUI(p.OUI))
+	}
+	if v < p.First || v > p.Last {
+		return fmt.Errorf("%s is outside the pool %s-%s", FormatMAC(v), FormatMAC(p.First), FormatMAC(p.Last))
+	}
+	return nil
+}
+
+// String returns the range, e.g. "00:E0:4C:68:00:00-00:E0:4C:68:FF:FF".
+func (p Pool) String() string {
+	return FormatMAC(p.First) + "-" + FormatMAC(p.Last)
+}
+
+// ParseMAC parses a MAC address written with ':' or '-' separators or none.
+func ParseMAC(mac string) (uint64, error) {
+	return parseHex(mac, 6)
+}
+
+func parseHex(s string, bytes int) (uint64, error) {
+	hex := strings.NewReplacer(":", "", "-", "").Replace(strings.TrimSpace(s))
+	if len(hex) != bytes*2 {
+		return 0, fmt.Errorf("invalid address %q", s)
+	}
+	v, err := strconv.ParseUint(hex, 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid address %q", s)
+	}
+	return v, nil
+}
+
+// FormatMAC returns v as upper-case hex pairs separated by ':', the form the
+// operators scan.
+func FormatMAC(v uint64) string {
+	return formatHex(v, 6)
+}
+
+// FormatOUI returns the upper 24 bits as hex pairs separated by ':'.
+func FormatOUI(oui uint64) string {
+	return formatHex(oui, 3)
+}
+
+func formatHex(v uint64, bytes int) string {
+	parts := make([]string, bytes)
+	for i := range parts {
+		parts[i] = fmt.Sprintf("%02X", (v>>(8*(bytes-1-i)))&0xff)
+	}
+	return strings.Join(parts, ":")
+}
@@ -0,0 +1,241 @@
+package macpool
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testPool(t *testing.T) Pool {
+	t.Helper()
+	p, err := NewPool("00:E0:4C", "00:E0:4C:68:00:00", "00:E0:4C:68:00:02")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestParseMAC(t *testing.T) {
+	for _, s := range []string{"00:E0:4C:68:2D:2C", "00-e0-4c-68-2d-2c", "00E04C682D2C"} {
+		v, err := ParseMAC(s)
+		if err != nil || FormatMAC(v) != "00:E0:4C:68:2D:2C" {
+			t.Errorf("ParseMAC(%q) = %x, %v", s, v, err)
+		}
+	}
+	for _, s := range []string{"", "00:E0:4C:68:2D", "00:E0:4C:68:2D:2C:00", "00:E0:4C:68:2D:ZZ"} {
+		if _, err := ParseMAC(s); err == nil {
+			t.Errorf("ParseMAC(%q) succeeded", s)
+		}
+	}
+}
+
+func TestNewPool(t *testing.T) {
+	for _, c := range [][3]string{
+		{"00:E0", "00:E0:4C:68:00:00", "00:E0:4C:68:00:02"},    // short OUI
+		{"01:E0:4C", "01:E0:4C:68:00:00", "01:E0:4C:68:00:02"}, // multicast
+		{"00:E0:4C", "00:E0:4D:68:00:00", "00:E0:4C:68:00:02"}, // first outside the OUI
+		{"00:E0:4C", "00:E0:4C:68:00:02", "00:E0:4C:68:00:00"}, // reversed
+	} {
+		if _, err := NewPool(c[0], c[1], c[2]); err == nil {
+			t.Errorf("NewPool%q succeeded", c)
+		}
+	}
+
+	p := testPool(t)
+	if err := p.Validate("00:e0:4c:68:00:01"); err != nil {
+		t.Error(err)
+	}
+	for _, mac := range []string{"00:E0:4C:68:00:03", "00:E0:4D:68:00:01", "bad"} {
+		if err := p.Validate(mac); err == nil {
+			t.Errorf("Validate(%q) succeeded", mac)
+		}
+	}
+}
+
+func TestLedger(t *testing.T) {
+	now := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	l := &Ledger{Path: filepath.Join(t.TempDir(), "ledger.json"), Pool: testPool(t), TTL: time.Hour, now: func() time.Time { return now }}
+
+	a, err := l.Reserve("A", "")
+	if err != nil || a.MAC != "00:E0:4C:68:00:00" || a.State != StateReserved {
+		t.Fatalf("Reserve(A) = %+v, %v", a, err)
+	}
+	if again, err := l.Reserve("A", ""); err != nil || again.ID != a.ID {
+		t.Fatalf("second Reserve(A) = %+v, %v; want %+v", again, err, a)
+	}
+	b, err := l.Reserve("B", "")
+	if err != nil || b.MAC != "00:E0:4C:68:00:01" {
+		t.Fatalf("Reserve(B) = %+v, %v", b, err)
+	}
+
+	// A scanned MAC: taken by another unit or outside the pool is an error
+	if _, err := l.Reserve("C", "00:e0:4c:68:00:00"); !errors.Is(err, ErrTaken) {
+		t.Fatalf("claiming A's MAC: %v", err)
+	}
+	if _, err := l.Reserve("C", "00:E0:4C:68:00:09"); err == nil {
+		t.Fatal("claimed a MAC outside the pool")
+	}
+	c, err := l.Reserve("C", "00-e0-4c-68-00-02")
+	if err != nil || c.MAC != "00:E0:4C:68:00:02" {
+		t.Fatalf("Reserve(C, mac) = %+v, %v", c, err)
+	}
+	if _, err := l.Reserve("D", ""); !errors.Is(err, ErrExhausted) {
+		t.Fatalf("full pool: %v", err)
+	}
+
+	if err := l.Commit(a); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Release(a); err == nil {
+		t.Fatal("released a committed MAC")
+	}
+	if err := l.Release(b); err != nil {
+		t.Fatal(err)
+	}
+	if d, err := l.Reserve("D", ""); err != nil || d.MAC != b.MAC {
+		t.Fatalf("Reserve(D) after release = %+v, %v; want %s", d, err, b.MAC)
+	}
+
+	// An expired reservation is freed; committing it afterwards records the MAC again
+	now = now.Add(2 * time.Hour)
+	e, err := l.Reserve("E", "")
+	if err != nil || e.MAC != b.MAC {
+		t.Fatalf("Reserve(E) after expiry = %+v, %v; want %s", e, err, b.MAC)
+	}
+	if err := l.Commit(c); err != nil {
+		t.Fatalf("commit of an expired lease: %v", err)
+	}
+	if err := l.Release(c); err == nil {
+		t.Fatal("released a committed MAC")
+	}
+	if got, err := l.Reserve("A", ""); err != nil || got.MAC != a.MAC || got.State != StateCommitted {
+		t.Fatalf("Reserve(A) after commit = %+v, %v", got, err)
+	}
+}
+
+func TestLedgerRetire(t *testing.T) {
+	l := &Ledger{Path: filepath.Join(t.TempDir(), "ledger.json"), Pool: testPool(t)}
+	a, err := l.Reserve("A", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The first MAC is already burned into X: A gets the next one from now on
+	a.Unit = "X"
+	if err := l.Retire(a); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := l.Reserve("A", ""); err != nil || got.MAC != "00:E0:4C:68:00:01" {
+		t.Fatalf("Reserve(A) after retire = %+v, %v", got, err)
+	}
+	if _, err := l.Reserve("X", a.MAC); !errors.Is(err, ErrTaken) {
+		t.Fatalf("claiming a retired MAC: %v", err)
+	}
+	if err := l.Release(a); err == nil {
+		t.Fatal("released a retired MAC")
+	}
+	if got, err := l.Reserve("B", ""); err != nil || got.MAC != "00:E0:4C:68:00:02" {
+		t.Fatalf("Reserve(B) = %+v, %v; the retired MAC must stay out of the pool", got, err)
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	var calls []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var l Lease
+		if err := json.NewDecoder(r.Body).Decode(&l); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		calls = append(calls, r.URL.Path+" "+l.Unit+" "+l.ID)
+		switch {
+		case r.URL.Path == "/reserve" && l.Unit == "taken":
+			http.Error(w, "in use", http.StatusConflict)
+		case r.URL.Path == "/reserve" && l.Unit == "rerun":
+			json.NewEncoder(w).Encode(Lease{ID: "l0", MAC: "00:E0:4C:68:00:02", State: StateCommitted})
+		case r.URL.Path == "/reserve" && l.Unit == "odd":
+			json.NewEncoder(w).Encode(Lease{ID: "l9", MAC: "00:E0:4C:68:00:03", State: StateReleased})
+		case r.URL.Path == "/reserve" && l.Unit == "foreign":
+			json.NewEncoder(w).Encode(Lease{ID: "x", MAC: "02:00:00:00:00:01"})
+		case r.URL.Path == "/reserve":
+			json.NewEncoder(w).Encode(Lease{ID: "l1", MAC: "00e04c680001"})
+		case r.URL.Path == "/release":
+			http.Error(w, "no such lease", http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	h := NewHTTP(srv.URL+"/", testPool(t))
+	l, err := h.Reserve("A", "")
+	if err != nil || l.ID != "l1" || l.MAC != "00:E0:4C:68:00:01" || l.Unit != "A" || l.State != StateReserved {
+		t.Fatalf("Reserve = %+v, %v", l, err)
+	}
+	if err := h.Commit(l); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Release(l); !errors.Is(err, ErrUnknownLease) {
+		t.Fatalf("Release: %v", err)
+	}
+	if _, err := h.Reserve("taken", ""); !errors.Is(err, ErrTaken) {
+		t.Fatalf("409: %v", err)
+	}
+	if _, err := h.Reserve("foreign", ""); err == nil {
+		t.Fatal("accepted a MAC outside the pool")
+	}
+	if _, err := h.Reserve("A", "00:E0:4C:68:00:09"); err == nil {
+		t.Fatal("sent a MAC outside the pool")
+	}
+	// The MAC is already on the unit: the lease stays committed
+	if l, err := h.Reserve("rerun", ""); err != nil || l.State != StateCommitted {
+		t.Fatalf("Reserve(rerun) = %+v, %v", l, err)
+	}
+	if _, err := h.Reserve("odd", ""); err == nil {
+		t.Fatal("accepted a released lease")
+	}
+	if len(calls) != 7 || calls[1] != "/commit A l1" {
+		t.Fatalf("calls %q", calls)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, DefaultFile)
+	write := func(data string) {
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(`{"oui": "00:E0:4C", "first": "00:E0:4C:68:00:00", "last": "00:E0:4C:68:FF:FF", "reserve_ttl": "5m"}`)
+	c, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := c.Allocator(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l, ok := a.(*Ledger); !ok || l.Path != filepath.Join(dir, "mac_ledger.json") || l.TTL != 5*time.Minute {
+		t.Fatalf("allocator %#v", a)
+	}
+
+	c.URL = "http://mes.local/mac"
+	if a, err := c.Allocator(dir); err != nil {
+		t.Fatal(err)
+	} else if _, ok := a.(*HTTP); !ok {
+		t.Fatalf("allocator %#v, want HTTP", a)
+	}
+
+	c.ReserveTTL, c.URL = "soon", ""
+	if _, err := c.Allocator(dir); err == nil {
+		t.Fatal("accepted an invalid reserve_ttl")
+	}
+	write(`{"oui": `)
+	if _, err := LoadConfig(path); err == nil {
+		t.Fatal("parsed broken JSON")
+	}
+}
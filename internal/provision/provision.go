@@ -0,0 +1,108 @@
+// Package provision decides what the provisioning tool has to do with a unit:
+// which identity values differ from what DMI and the network interfaces
+// report, whether the serial number and/or MAC address must be flashed, and
+// through which backends the serial number is handed to the EFI shell flasher.
+// The decision is pure so that every branch can be unit tested.
+package provision
+
+import (
+	"fmt"
+	"strings"
+
+	"crycaller/internal/unitrules"
+)
+
+// Serial backends and DMI sources, as named in the product definitions file.
+const (
+	BackendFile   = unitrules.BackendFile
+	BackendEfivar = unitrules.BackendEfivar
+	BackendBoth   = unitrules.BackendBoth
+
+	DMIBaseboard = unitrules.DMIBaseboard // dmidecode -t baseboard, Serial Number
+	DMISystem    = unitrules.DMISystem    // dmidecode -t system, Serial Number
+)
+
+// Comparison says which scanned field must equal which DMI serial number.
+type Comparison = unitrules.Comparison
+
+// Profile is how a product is provisioned.
+type Profile struct {
+	Backend string
+	Compare []Comparison
+}
+
+// ProfileFor returns the provisioning profile of a product definition.
+func ProfileFor(p *unitrules.Product) Profile {
+	return Profile{Backend: p.Backend, Compare: p.Compare}
+}
+
+// Backends expands the profile's backend into the list to write, in order.
+func (p Profile) Backends() ([]string, error) {
+	switch strings.ToLower(p.Backend) {
+	case BackendFile:
+		return []string{BackendFile}, nil
+	case BackendEfivar:
+		return []string{BackendEfivar}, nil
+	case BackendBoth, "":
+		return []string{BackendEfivar, BackendFile}, nil
+	}
+	return nil, fmt.Errorf("unknown serial backend %q (want %s, %s or %s)", p.Backend, BackendFile, BackendEfivar, BackendBoth)
+}
+
+// Input is what detection found on the unit.
+type Input struct {
+	Values     map[string]string // scanned values by field name (mbSN, ioSN, mac)
+	DMI        map[string]string // serial numbers by DMI source
+	MACPresent bool              // an interface already has the requested MAC
+}
+
+// Action names, as written to the operation log.
+const (
+	ActionNone         = "No changes required"
+	ActionMACOnly      = "MAC address update only"
+	ActionSerialAndMAC = "Serial number and MAC address update"
+	ActionSerialOnly   = "Serial number update only"
+)
+
+// Plan is the decision for one unit.
+type Plan struct {
+	FlashSerial bool
+	FlashMAC    bool
+	Mismatches  []string // human-readable reasons for FlashSerial
+	Backends    []string // serial backends to write when FlashSerial
+	Action      string
+}
+
+// Decide compares the scanned values with the unit and returns the plan.
+func Decide(p Profile, in Input) (Plan, error) {
+	backends, err := p.Backends()
+	if err != nil {
+		return Plan{}, err
+	}
+	plan := Plan{FlashMAC: !in.MACPresent}
+	for _, c := range p.Compare {
+		want, ok := in.Values[c.Field]
+		if !ok {
+			return Plan{}, fmt.Errorf("field %s is compared with DMI %s but was not scanned", c.Field, c.DMI)
+		}
+		if have := in.DMI[c.DMI]; have != want {
+			plan.Mismatches = append(plan.Mismatches, fmt.Sprintf("%s %q != DMI %s serial %q", c.Field, want, c.DMI, have))
+		}
+	}
+	plan.FlashSerial = len(plan.Mismatches) > 0
+	if plan.FlashSerial {
+		plan.Backends = backends
+	}
+
+	switch {
+	case !plan.FlashSerial && !plan.FlashMAC:
+		plan.Action = ActionNone
+	case !plan.FlashSerial:
+		plan.Action = ActionMACOnly
+	case plan.FlashMAC:
+		plan.Action = ActionSerialAndMAC
+	default:
+		plan.Action = ActionSerialOnly
+	}
+	return plan, nil
+}
@@ -0,0 +1,156 @@
+package provision
+
+import (
+	"reflect"
+	"testing"
+
+	"crycaller/internal/unitrules"
+)
+
+const (
+	mbSN = "INF00A340242149"
+	ioSN = "INF00A441241919"
+	mac  = "00:e0:4c:68:2d:2c"
+)
+
+// product returns a built-in product definition.
+func product(t *testing.T, name string) *unitrules.Product {
+	t.Helper()
+	p, ok := unitrules.Default().Product(name)
+	if !ok {
+		t.Fatalf("no built-in product %s", name)
+	}
+	return p
+}
+
+func values() map[string]string {
+	return map[string]string{unitrules.FieldMbSN: mbSN, unitrules.FieldIoSN: ioSN, unitrules.FieldMAC: mac}
+}
+
+func TestDecide(t *testing.T) {
+	ioChecked := Profile{
+		Backend: BackendFile,
+		Compare: []Comparison{
+			{Field: unitrules.FieldMbSN, DMI: DMIBaseboard},
+			{Field: unitrules.FieldIoSN, DMI: DMISystem},
+		},
+	}
+	cases := []struct {
+		name       string
+		profile    Profile
+		dmi        map[string]string
+		macPresent bool
+		want       Plan
+	}{
+		{
+			name:       "nothing to do",
+			profile:    ProfileFor(product(t, "Silver")),
+			dmi:        map[string]string{DMIBaseboard: mbSN, DMISystem: "Default string"},
+			macPresent: true,
+			want:       Plan{Action: ActionNone},
+		},
+		{
+			name:    "MAC only",
+			profile: ProfileFor(product(t, "IFMBH610MTPR")),
+			dmi:     map[string]string{DMIBaseboard: mbSN},
+			want:    Plan{FlashMAC: true, Action: ActionMACOnly},
+		},
+		{
+			name:       "serial only, both backends",
+			profile:    ProfileFor(product(t, "Silver")),
+			dmi:        map[string]string{DMIBaseboard: "Default string"},
+			macPresent: true,
+			want: Plan{
+				FlashSerial: true,
+				Mismatches:  []string{`mbSN "INF00A340242149" != DMI baseboard serial "Default string"`},
+				Backends:    []string{BackendEfivar, BackendFile},
+				Action:      ActionSerialOnly,
+			},
+		},
+		{
+			name:    "serial and MAC, efivar backend",
+			profile: Profile{Backend: BackendEfivar, Compare: []Comparison{{Field: unitrules.FieldMbSN, DMI: DMIBaseboard}}},
+			dmi:     map[string]string{},
+			want: Plan{
+				FlashSerial: true,
+				FlashMAC:    true,
+				Mismatches:  []string{`mbSN "INF00A340242149" != DMI baseboard serial ""`},
+				Backends:    []string{BackendEfivar},
+				Action:      ActionSerialAndMAC,
+			},
+		},
+		{
+			name:       "IO serial compared with system serial, file backend",
+			profile:    ioChecked,
+			dmi:        map[string]string{DMIBaseboard: mbSN, DMISystem: "Default string"},
+			macPresent: true,
+			want: Plan{
+				FlashSerial: true,
+				Mismatches:  []string{`ioSN "INF00A441241919" != DMI system serial "Default string"`},
+				Backends:    []string{BackendFile},
+				Action:      ActionSerialOnly,
+			},
+		},
+		{
+			name:       "IO serial compared and matching",
+			profile:    ioChecked,
+			dmi:        map[string]string{DMIBaseboard: mbSN, DMISystem: ioSN},
+			macPresent: true,
+			want:       Plan{Action: ActionNone},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := Decide(c.profile, Input{Values: values(), DMI: c.dmi, MACPresent: c.macPresent})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Fatalf("Decide =\n%+v\nwant\n%+v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestDecideErrors(t *testing.T) {
+	if _, err := Decide(Profile{Backend: "floppy"}, Input{Values: values()}); err == nil {
+		t.Error("unknown backend accepted")
+	}
+	// ioSN is compared but was not scanned (product without an IO board)
+	p := Profile{Compare: []Comparison{{Field: unitrules.FieldIoSN, DMI: DMISystem}}}
+	if _, err := Decide(p, Input{Values: map[string]string{unitrules.FieldMbSN: mbSN}}); err == nil {
+		t.Error("missing compared field accepted")
+	}
+}
+
+func TestBackends(t *testing.T) {
+	cases := map[string][]string{
+		"":        {BackendEfivar, BackendFile},
+		"both":    {BackendEfivar, BackendFile},
+		"BOTH":    {BackendEfivar, BackendFile},
+		"file":    {BackendFile},
+		"efivar":  {BackendEfivar},
+		"unknown": nil,
+	}
+	for backend, want := range cases {
+		got, err := Profile{Backend: backend}.Backends()
+		if want == nil {
+			if err == nil {
+				t.Errorf("Backends(%q) accepted", backend)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("Backends(%q) = %v, %v; want %v", backend, got, err, want)
+		}
+	}
+}
+
+func TestProfileFor(t *testing.T) {
+	want := Profile{Backend: BackendBoth, Compare: []Comparison{{Field: unitrules.FieldMbSN, DMI: DMIBaseboard}}}
+	for _, name := range []string{"Silver", "IFMBH610MTPR"} {
+		if got := ProfileFor(product(t, name)); !reflect.DeepEqual(got, want) {
+			t.Errorf("ProfileFor(%s) = %+v, want %+v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+// Package safename turns operator IDs, station names and serials into parts
+// of file names. crycaller and serial_to_uefi share it so that their reports
+// and logs are named the same way.
+package safename
+
+import (
+	"regexp"
+	"strings"
+)
+
+var unsafeChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// Clean trims s and replaces every run of characters other than letters,
+// digits, '.', '_' and '-' with a single '-'.
+func Clean(s string) string {
+	return unsafeChars.ReplaceAllString(strings.TrimSpace(s), "-")
+}
+
+// Join cleans the parts and joins the non-empty ones with '_'.
+func Join(parts ...string) string {
+	var out []string
+	for _, p := range parts {
+		if p = Clean(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return strings.Join(out, "_")
+}
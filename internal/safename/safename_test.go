@@ -0,0 +1,27 @@
+package safename
+
+import "testing"
+
+func TestClean(t *testing.T) {
+	for in, want := range map[string]string{
+		"op1":            "op1",
+		" line 2/st 3 ":  "line-2-st-3",
+		"../etc":         "..-etc",
+		"Иванов И.И.":    "-.-.",
+		"SN:0042\\rev.A": "SN-0042-rev.A",
+		"":               "",
+	} {
+		if got := Clean(in); got != want {
+			t.Errorf("Clean(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestJoin(t *testing.T) {
+	if got := Join("bare_log", "st 1", "", "  ", "op/1"); got != "bare_log_st-1_op-1" {
+		t.Errorf("Join = %q", got)
+	}
+	if got := Join("", ""); got != "" {
+		t.Errorf("Join of empty parts = %q", got)
+	}
+}
@@ -0,0 +1,581 @@
+// Package unitrules holds the product definitions file (unit_rules.json). For
+// every product it says how to recognise the board from DMI, which identity
+// strings (motherboard SN, IO SN, MAC) are scanned and how they are validated,
+// which of them must equal which DMI serial number, how the serial number is
+// handed to the EFI shell flasher and which tool flashes the MAC address.
+// The file is shared by crycaller and the provisioning tool so both accept
+// exactly the same input; adding a board needs no recompile.
+package unitrules
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"crycaller/internal/efivarfs"
+)
+
+// DefaultFile is the rule table looked up next to the binary's working directory.
+const DefaultFile = "unit_rules.json"
+
+// Well-known field names.
+const (
+	FieldMbSN = "mbSN"
+	FieldIoSN = "ioSN"
+	FieldMAC  = "mac"
+)
+
+// DMI sources, i.e. the dmidecode -t types a rule can look at.
+const (
+	DMIBaseboard = "baseboard"
+	DMISystem    = "system"
+)
+
+// Serial backends. The EFI shell flasher started by bootctl reads the new
+// serial number either from ctefi/SERIAL or from the SerialNumber EFI variable.
+const (
+	BackendFile   = "file"   // ctefi/SERIAL, copied to the external EFI partition
+	BackendEfivar = "efivar" // SerialNumber-<GUID> EFI variable
+	BackendBoth   = "both"
+)
+
+// MAC flashing tool kinds.
+const (
+	// MACToolRtnicpg is the Realtek rtnicpg utility: conflicting NIC drivers
+	// are unloaded, the pgdrv module is built and loaded from Dir, the binary
+	// is run and the original driver is loaded back.
+	MACToolRtnicpg = "rtnicpg"
+	// MACToolCommand runs Binary with Args and nothing else.
+	MACToolCommand = "command"
+)
+
+// FieldRule describes one identity field of a product.
+type FieldRule struct {
+	Name    string    `json:"name"`
+	Pattern string    `json:"pattern"`
+	Check   string    `json:"check,omitempty"`  // check digit algorithm, see checks
+	Decode  []Segment `json:"decode,omitempty"` // date and plant codes inside the value
+	Env     string    `json:"env,omitempty"`    // variable exported to child tests
+
+	re *regexp.Regexp
+}
+
+// Segment kinds. A segment without a kind is a code that must be one of Codes.
+const (
+	SegmentYear  = "year"  // 2 digits (20xx) or 4 digits, not in the future
+	SegmentMonth = "month" // 01-12
+	SegmentWeek  = "week"  // 01-53
+	SegmentDay   = "day"   // 01-31
+)
+
+// Segment is a fixed-position part of a value, such as the plant code or the
+// production year and week of a serial number.
+type Segment struct {
+	Name  string            `json:"name"`
+	Start int               `json:"start"` // byte offset in the value
+	Len   int               `json:"len"`
+	Kind  string            `json:"kind,omitempty"`
+	Codes map[string]string `json:"codes,omitempty"` // allowed codes and what they mean
+}
+
+// DMIMatch is one condition a board must satisfy to be this product:
+// the Key line of `dmidecode -t DMI` must match Pattern.
+type DMIMatch struct {
+	DMI     string `json:"dmi"`
+	Key     string `json:"key"`
+	Pattern string `json:"pattern"`
+
+	re *regexp.Regexp
+}
+
+// Comparison says which scanned field must equal which DMI serial number.
+// A mismatch means the serial number has to be flashed.
+type Comparison struct {
+	Field string `json:"field"`
+	DMI   string `json:"dmi"`
+}
+
+// MACTool is the program that burns the MAC address into the NIC. In Binary
+// and Args, {arch} is replaced by `uname -m`, {mac} by the MAC without colons
+// and {mac_colon} by the MAC as scanned.
+type MACTool struct {
+	Kind      string   `json:"kind"`
+	Dir       string   `json:"dir,omitempty"` // relative to the working directory
+	Binary    string   `json:"binary"`        // relative to Dir, looked up in PATH without Dir
+	Args      []string `json:"args"`
+	Module    string   `json:"module,omitempty"`    // rtnicpg: kernel module built in Dir
+	Conflicts []string `json:"conflicts,omitempty"` // rtnicpg: drivers unloaded while flashing
+}
+
+// Product is everything known about one board.
+type Product struct {
+	Name string `json:"name"`
+
+	// Match recognises the board from DMI; all conditions must hold.
+	// Default: DMI system "Product Name" equal to Name.
+	Match  []DMIMatch  `json:"match,omitempty"`
+	Fields []FieldRule `json:"fields"`
+
+	// Compare lists the fields checked against DMI to decide whether the
+	// serial number must be flashed. When the key is absent it defaults to
+	// mbSN against the baseboard serial; an empty list disables the check.
+	Compare []Comparison `json:"compare"`
+	// Backend is file, efivar or both (the default).
+	Backend string `json:"backend,omitempty"`
+	// MACTool defaults to DefaultMACTool.
+	MACTool *MACTool `json:"mac_tool,omitempty"`
+
+	// EfiGUID is the vendor GUID of the SerialNumber/HexMac EFI variables.
+	// When empty, the provisioning tool derives one from the product name.
+	EfiGUID string `json:"efi_guid,omitempty"`
+}
+
+// Table is the whole rule set.
+type Table struct {
+	Products []Product `json:"products"`
+}
+
+const macPattern = `^([0-9A-Fa-f]{2}:){5}[0-9A-Fa-f]{2}$`
+
+// DefaultMACTool is the Realtek rtnicpg setup the provisioning tool has always used.
+func DefaultMACTool() *MACTool {
+	return &MACTool{
+		Kind:      MACToolRtnicpg,
+		Dir:       "rtnicpg",
+		Binary:    "rtnicpg-{arch}",
+		Args:      []string{"/efuse", "/nodeid", "{mac}"},
+		Module:    "pgdrv",
+		Conflicts: []string{"r8169", "r8168", "r8125", "r8101"},
+	}
+}
+
+// Default returns the built-in table, identical to the shipped unit_rules.json.
+// It is used when the file does not exist.
+func Default() *Table {
+	// The Silver IO serial is scanned for the logs only: the flasher writes the
+	// motherboard serial, so comparing ioSN with the DMI system serial (as the
+	// old serial_dir tool did) made every Silver unit look unflashed.
+	t := &Table{Products: []Product{
+		{Name: "Silver", Fields: []FieldRule{
+			{Name: FieldMbSN, Pattern: `^INF00A34[0-9]{7}$`, Env: "UNIT_SN"},
+			{Name: FieldIoSN, Pattern: `^INF00A44[0-9]{7}$`, Env: "UNIT_IO_SN"},
+			{Name: FieldMAC, Pattern: macPattern, Env: "UNIT_MAC"},
+		}, Compare: []Comparison{{Field: FieldMbSN, DMI: DMIBaseboard}}},
+		{Name: "IFMBH610MTPR", Fields: []FieldRule{
+			{Name: FieldMbSN, Pattern: `^INF00A95[0-9]{7}$`, Env: "UNIT_SN"},
+			{Name: FieldMAC, Pattern: macPattern, Env: "UNIT_MAC"},
+		}, Compare: []Comparison{{Field: FieldMbSN, DMI: DMIBaseboard}}},
+	}}
+	if err := t.compile(); err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// Load reads and compiles a rule table from path.
+func Load(path string) (*Table, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var t Table
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("parse %s: %v", path, err)
+	}
+	if err := t.compile(); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return &t, nil
+}
+
+// LoadOrDefault behaves like Load but falls back to Default when the file does not exist.
+func LoadOrDefault(path string) (*Table, error) {
+	t, err := Load(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Default(), nil
+	}
+	return t, err
+}
+
+func (t *Table) compile() error {
+	for pi := range t.Products {
+		p := &t.Products[pi]
+		if p.Name == "" {
+			return errors.New("product without a name")
+		}
+		if p.EfiGUID != "" {
+			if _, err := efivarfs.ParseGUID(p.EfiGUID); err != nil {
+				return fmt.Errorf("product %s: efi_guid: %v", p.Name, err)
+			}
+		}
+		for fi := range p.Fields {
+			f := &p.Fields[fi]
+			re, err := regexp.Compile(f.Pattern)
+			if err != nil {
+				return fmt.Errorf("product %s field %s: %v", p.Name, f.Name, err)
+			}
+			f.re = re
+			if f.Check != "" {
+				if _, ok := checks[f.Check]; !ok {
+					return fmt.Errorf("product %s field %s: unknown check %q", p.Name, f.Name, f.Check)
+				}
+			}
+			for _, seg := range f.Decode {
+				if err := seg.validate(); err != nil {
+					return fmt.Errorf("product %s field %s: decode %s: %v", p.Name, f.Name, seg.Name, err)
+				}
+			}
+			if f.Env == "" {
+				f.Env = "UNIT_" + strings.ToUpper(f.Name)
+			}
+		}
+		if err := p.compileProvisioning(); err != nil {
+			return fmt.Errorf("product %s: %v", p.Name, err)
+		}
+	}
+	return nil
+}
+
+// compileProvisioning validates the DMI, comparison, backend and MAC tool
+// sections and fills in their defaults.
+func (p *Product) compileProvisioning() error {
+	if len(p.Match) == 0 {
+		p.Match = []DMIMatch{{DMI: DMISystem, Key: "Product Name", Pattern: "^" + regexp.QuoteMeta(p.Name) + "$"}}
+	}
+	for mi := range p.Match {
+		m := &p.Match[mi]
+		if !validDMI(m.DMI) || m.Key == "" {
+			return fmt.Errorf("match %d: want dmi %s or %s and a key", mi, DMIBaseboard, DMISystem)
+		}
+		re, err := regexp.Compile(m.Pattern)
+		if err != nil {
+			return fmt.Errorf("match %s %q: %v", m.DMI, m.Key, err)
+		}
+		m.re = re
+	}
+
+	if p.Compare == nil {
+		if _, ok := p.Field(FieldMbSN); ok {
+			p.Compare = []Comparison{{Field: FieldMbSN, DMI: DMIBaseboard}}
+		}
+	}
+	for _, c := range p.Compare {
+		if _, ok := p.Field(c.Field); !ok {
+			return fmt.Errorf("compare: unknown field %q", c.Field)
+		}
+		if !validDMI(c.DMI) {
+			return fmt.Errorf("compare %s: unknown dmi %q", c.Field, c.DMI)
+		}
+	}
+
+	p.Backend = strings.ToLower(p.Backend)
+	switch p.Backend {
+	case "":
+		p.Backend = BackendBoth
+	case BackendFile, BackendEfivar, BackendBoth:
+	default:
+		return fmt.Errorf("unknown backend %q (want %s, %s or %s)", p.Backend, BackendFile, BackendEfivar, BackendBoth)
+	}
+
+	if p.MACTool == nil {
+		p.MACTool = DefaultMACTool()
+	}
+	switch p.MACTool.Kind {
+	case MACToolRtnicpg:
+		if p.MACTool.Dir == "" || p.MACTool.Module == "" {
+			return errors.New("mac_tool: rtnicpg needs dir and module")
+		}
+	case MACToolCommand:
+	default:
+		return fmt.Errorf("mac_tool: unknown kind %q (want %s or %s)", p.MACTool.Kind, MACToolRtnicpg, MACToolCommand)
+	}
+	if p.MACTool.Binary == "" {
+		return errors.New("mac_tool: binary is empty")
+	}
+	return nil
+}
+
+func validDMI(source string) bool {
+	return source == DMIBaseboard || source == DMISystem
+}
+
+// Product returns the rules for the given DMI product name.
+func (t *Table) Product(name string) (*Product, bool) {
+	for i := range t.Products {
+		if t.Products[i].Name == name {
+			return &t.Products[i], true
+		}
+	}
+	return nil, false
+}
+
+// Detect returns the first product whose DMI match rules all hold. lookup
+// returns the value of key in `dmidecode -t dmi`.
+func (t *Table) Detect(lookup func(dmi, key string) (string, bool)) (*Product, bool) {
+	for i := range t.Products {
+		p := &t.Products[i]
+		matched := true
+		for _, m := range p.Match {
+			v, ok := lookup(m.DMI, m.Key)
+			if !ok || !m.re.MatchString(v) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// Infer finds the only product that has a field matching input. It is used
+// when the product name cannot be read from DMI.
+func (t *Table) Infer(input string) (*Product, bool) {
+	var found *Product
+	for i := range t.Products {
+		p := &t.Products[i]
+		for _, f := range p.Fields {
+			if f.Name != FieldMAC && f.Match(input) {
+				if found != nil && found != p {
+					return nil, false
+				}
+				found = p
+			}
+		}
+	}
+	return found, found != nil
+}
+
+// Field returns the rule for the named field.
+func (p *Product) Field(name string) (*FieldRule, bool) {
+	for i := range p.Fields {
+		if p.Fields[i].Name == name {
+			return &p.Fields[i], true
+		}
+	}
+	return nil, false
+}
+
+// Classify returns the first field not yet present in provided whose pattern
+// matches input.
+func (p *Product) Classify(input string, provided map[string]string) (string, bool) {
+	for _, f := range p.Fields {
+		if _, ok := provided[f.Name]; ok {
+			continue
+		}
+		if f.Match(input) {
+			return f.Name, true
+		}
+	}
+	return "", false
+}
+
+// Reject explains why Classify did not accept input: the error of the first
+// missing field whose pattern matches, such as a wrong check digit or an
+// unknown plant code. It is nil when no pattern matches at all.
+func (p *Product) Reject(input string, provided map[string]string) error {
+	for _, f := range p.Fields {
+		if _, ok := provided[f.Name]; ok || !f.re.MatchString(input) {
+			continue
+		}
+		if err := f.Validate(input); err != nil {
+			return fmt.Errorf("%s %v", f.Name, err)
+		}
+	}
+	return nil
+}
+
+// Complete reports whether every field of the product has a value.
+func (p *Product) Complete(provided map[string]string) bool {
+	for _, f := range p.Fields {
+		if _, ok := provided[f.Name]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Env returns NAME=value pairs for the provided fields.
+func (p *Product) Env(provided map[string]string) []string {
+	var env []string
+	for _, f := range p.Fields {
+		if v, ok := provided[f.Name]; ok {
+			env = append(env, f.Env+"="+v)
+		}
+	}
+	return env
+}
+
+// Match reports whether value matches the field's pattern, check digit and
+// decode segments.
+func (f *FieldRule) Match(value string) bool {
+	return f.Validate(value) == nil
+}
+
+// Validate is Match with the reason value is rejected.
+func (f *FieldRule) Validate(value string) error {
+	if !f.re.MatchString(value) {
+		return fmt.Errorf("%q does not match %s", value, f.Pattern)
+	}
+	if f.Check != "" && !checks[f.Check](value) {
+		return fmt.Errorf("%q: wrong %s check digit", value, f.Check)
+	}
+	_, err := f.DecodeValue(value)
+	return err
+}
+
+// DecodeValue returns the decode segments of value by name, with a code
+// replaced by its meaning, e.g. {"plant": "Zelenograd", "year": "2024"}.
+func (f *FieldRule) DecodeValue(value string) (map[string]string, error) {
+	if len(f.Decode) == 0 {
+		return nil, nil
+	}
+	decoded := make(map[string]string, len(f.Decode))
+	for _, seg := range f.Decode {
+		v, err := seg.decode(value, timeNow())
+		if err != nil {
+			return nil, fmt.Errorf("%q: %s %v", value, seg.Name, err)
+		}
+		decoded[seg.Name] = v
+	}
+	return decoded, nil
+}
+
+// timeNow is replaced in tests.
+var timeNow = time.Now
+
+func (s Segment) validate() error {
+	if s.Name == "" || s.Start < 0 || s.Len <= 0 {
+		return errors.New("want a name, start >= 0 and len > 0")
+	}
+	switch s.Kind {
+	case "":
+		if len(s.Codes) == 0 {
+			return errors.New("a code segment needs codes")
+		}
+	case SegmentYear:
+		if s.Len != 2 && s.Len != 4 {
+			return errors.New("a year is 2 or 4 digits")
+		}
+	case SegmentMonth, SegmentWeek, SegmentDay:
+		if s.Len != 2 {
+			return fmt.Errorf("a %s is 2 digits", s.Kind)
+		}
+	default:
+		return fmt.Errorf("unknown kind %q", s.Kind)
+	}
+	return nil
+}
+
+func (s Segment) decode(value string, now time.Time) (string, error) {
+	if s.Start+s.Len > len(value) {
+		return "", errors.New("is outside the value")
+	}
+	part := value[s.Start : s.Start+s.Len]
+	if s.Kind == "" {
+		meaning, ok := s.Codes[part]
+		if !ok {
+			return "", fmt.Errorf("code %q is unknown", part)
+		}
+		return meaning, nil
+	}
+
+	n, err := strconv.Atoi(part)
+	if err != nil || n < 0 {
+		return "", fmt.Errorf("%q is not a number", part)
+	}
+	max := map[string]int{SegmentMonth: 12, SegmentWeek: 53, SegmentDay: 31}[s.Kind]
+	if s.Kind == SegmentYear {
+		if s.Len == 2 {
+			n += 2000
+		}
+		if n > now.Year() {
+			return "", fmt.Errorf("%d is in the future", n)
+		}
+		return strconv.Itoa(n), nil
+	}
+	if n < 1 || n > max {
+		return "", fmt.Errorf("%q is not a valid %s", part, s.Kind)
+	}
+	return part, nil
+}
+
+// checks are the check digit algorithms a field can name in "check".
+var checks = map[string]func(string) bool{
+	"luhn":  luhn,
+	"mod11": mod11,
+	"mod97": mod97,
+}
+
+// RegisterCheck adds a check digit algorithm that fields can name in
+// "check". It must be called before the rule table is loaded.
+func RegisterCheck(name string, fn func(value string) bool) {
+	checks[name] = fn
+}
+
+// digits returns the decimal digits of value, skipping letters and
+// separators such as a serial number prefix.
+func digits(value string) []int {
+	var d []int
+	for _, c := range value {
+		if c >= '0' && c <= '9' {
+			d = append(d, int(c-'0'))
+		}
+	}
+	return d
+}
+
+// mod11 validates a mod 11 check digit: the digits before it are weighted
+// 2, 3, ..., 7, 2, ... from the right and the check digit is
+// (11 - sum mod 11) mod 11; values whose check would be 10 are never issued.
+func mod11(value string) bool {
+	d := digits(value)
+	if len(d) < 2 {
+		return false
+	}
+	sum := 0
+	for i, w := len(d)-2, 2; i >= 0; i-- {
+		sum += d[i] * w
+		if w++; w > 7 {
+			w = 2
+		}
+	}
+	return (11-sum%11)%11 == d[len(d)-1]
+}
+
+// mod97 validates ISO 7064 MOD 97-10 (as in IBAN): the digits, read as one
+// number, leave a remainder of 1; the last two are the check digits.
+func mod97(value string) bool {
+	d := digits(value)
+	if len(d) < 3 {
+		return false
+	}
+	r := 0
+	for _, v := range d {
+		r = (r*10 + v) % 97
+	}
+	return r == 1
+}
+
+// luhn validates the Luhn (mod 10) check digit over the digits of value;
+// letters and separators, such as a serial number prefix, are skipped.
+func luhn(value string) bool {
+	d := digits(value)
+	sum := 0
+	for i := range d {
+		v := d[len(d)-1-i]
+		if i%2 == 1 {
+			if v *= 2; v > 9 {
+				v -= 9
+			}
+		}
+		sum += v
+	}
+	return len(d) > 1 && sum%10 == 0
+}
@@ -0,0 +1,207 @@
+package unitrules
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// The shipped unit_rules.json must stay what Default falls back to.
+func TestShippedFileMatchesDefault(t *testing.T) {
+	shipped, err := Load(filepath.Join("..", "..", DefaultFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := json.Marshal(shipped)
+	want, _ := json.Marshal(Default())
+	if string(got) != string(want) {
+		t.Fatalf("unit_rules.json differs from Default():\n%s\n%s", got, want)
+	}
+}
+
+func load(t *testing.T, content string) (*Table, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), DefaultFile)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return Load(path)
+}
+
+func TestDefaults(t *testing.T) {
+	table, err := load(t, `{"products": [
+		{"name": "Old", "fields": [{"name": "mbSN", "pattern": "^A[0-9]+$"}]},
+		{"name": "NoCheck", "compare": [], "fields": [{"name": "mbSN", "pattern": "^B[0-9]+$"}]}
+	]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, _ := table.Product("Old")
+	if old.Backend != BackendBoth || !reflect.DeepEqual(old.MACTool, DefaultMACTool()) {
+		t.Errorf("Old: backend %q, mac tool %+v", old.Backend, old.MACTool)
+	}
+	if want := []Comparison{{Field: FieldMbSN, DMI: DMIBaseboard}}; !reflect.DeepEqual(old.Compare, want) {
+		t.Errorf("Old: compare %+v, want %+v", old.Compare, want)
+	}
+	if len(old.Match) != 1 || old.Match[0].DMI != DMISystem || old.Match[0].Key != "Product Name" {
+		t.Errorf("Old: match %+v", old.Match)
+	}
+	// An explicit empty list turns the serial comparison off
+	noCheck, _ := table.Product("NoCheck")
+	if len(noCheck.Compare) != 0 {
+		t.Errorf("NoCheck: compare %+v", noCheck.Compare)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	cases := map[string]string{
+		"pattern":  `{"name": "P", "fields": [{"name": "mbSN", "pattern": "("}]}`,
+		"check":    `{"name": "P", "fields": [{"name": "mbSN", "pattern": "", "check": "crc99"}]}`,
+		"match":    `{"name": "P", "match": [{"dmi": "chassis", "key": "Type", "pattern": ""}], "fields": []}`,
+		"compare":  `{"name": "P", "fields": [], "compare": [{"field": "ioSN", "dmi": "system"}]}`,
+		"backend":  `{"name": "P", "fields": [], "backend": "floppy"}`,
+		"mac_tool": `{"name": "P", "fields": [], "mac_tool": {"kind": "eeprom", "binary": "x"}}`,
+		"rtnicpg":  `{"name": "P", "fields": [], "mac_tool": {"kind": "rtnicpg", "binary": "x"}}`,
+		"efi_guid": `{"name": "P", "fields": [], "efi_guid": "not-a-guid"}`,
+	}
+	for name, product := range cases {
+		if _, err := load(t, `{"products": [`+product+`]}`); err == nil {
+			t.Errorf("%s: invalid definition accepted", name)
+		}
+	}
+}
+
+func TestDetect(t *testing.T) {
+	table, err := load(t, `{"products": [
+		{"name": "Rev2", "fields": [], "match": [
+			{"dmi": "system", "key": "Product Name", "pattern": "^Board$"},
+			{"dmi": "baseboard", "key": "Version", "pattern": "^2\\."}
+		]},
+		{"name": "Board", "fields": []}
+	]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dmi := func(version string) func(string, string) (string, bool) {
+		values := map[string]string{"system/Product Name": "Board", "baseboard/Version": version}
+		return func(source, key string) (string, bool) {
+			v, ok := values[source+"/"+key]
+			return v, ok
+		}
+	}
+	for version, want := range map[string]string{"2.1": "Rev2", "1.0": "Board"} {
+		p, ok := table.Detect(dmi(version))
+		if !ok || p.Name != want {
+			t.Errorf("Detect(version %s) = %v, %v; want %s", version, p, ok, want)
+		}
+	}
+	if p, ok := table.Detect(func(string, string) (string, bool) { return "", false }); ok {
+		t.Errorf("Detect without DMI = %s", p.Name)
+	}
+}
+
+func TestCheckDigit(t *testing.T) {
+	table, err := load(t, `{"products": [{"name": "P", "fields": [
+		{"name": "mbSN", "pattern": "^SN[0-9]+$", "check": "luhn"}
+	]}]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _ := table.Product("P")
+	f, _ := p.Field(FieldMbSN)
+	if !f.Match("SN79927398713") || !f.Match("SN4539578763621486") {
+		t.Error("valid Luhn serial rejected")
+	}
+	if f.Match("SN79927398710") {
+		t.Error("wrong check digit accepted")
+	}
+	if _, ok := p.Classify("SN79927398710", nil); ok {
+		t.Error("Classify accepted a wrong check digit")
+	}
+}
+
+func TestModChecks(t *testing.T) {
+	for _, c := range []struct {
+		check string
+		good  []string
+		bad   []string
+	}{
+		{"mod11", []string{"INF0242144", "SN1234560"}, []string{"INF0242145", "SN1234561", "SN1"}},
+		{"mod97", []string{"INF024214984", "SN123482"}, []string{"INF024214985", "SN123428", "SN12"}},
+	} {
+		for _, v := range c.good {
+			if !checks[c.check](v) {
+				t.Errorf("%s(%q) = false", c.check, v)
+			}
+		}
+		for _, v := range c.bad {
+			if checks[c.check](v) {
+				t.Errorf("%s(%q) = true", c.check, v)
+			}
+		}
+	}
+
+	RegisterCheck("even", func(v string) bool { return len(v)%2 == 0 })
+	defer delete(checks, "even")
+	table, err := load(t, `{"products": [{"name": "P", "fields": [{"name": "mbSN", "pattern": "^SN", "check": "even"}]}]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, _ := table.Products[0].Field(FieldMbSN)
+	if !f.Match("SN12") || f.Match("SN123") {
+		t.Error("registered check not applied")
+	}
+}
+
+func TestDecode(t *testing.T) {
+	defer func(now func() time.Time) { timeNow = now }(timeNow)
+	timeNow = func() time.Time { return time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC) }
+
+	table, err := load(t, `{"products": [{"name": "P", "fields": [
+		{"name": "mbSN", "pattern": "^INF00A34[0-9]{7}$", "decode": [
+			{"name": "plant", "start": 8, "len": 1, "codes": {"0": "Zelenograd", "1": "Taganrog"}},
+			{"name": "year", "start": 9, "len": 2, "kind": "year"},
+			{"name": "week", "start": 11, "len": 2, "kind": "week"}
+		]}
+	]}]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, _ := table.Products[0].Field(FieldMbSN)
+	got, err := f.DecodeValue("INF00A340242149")
+	if err != nil || got["plant"] != "Zelenograd" || got["year"] != "2024" || got["week"] != "21" {
+		t.Fatalf("DecodeValue = %v, %v", got, err)
+	}
+	for _, v := range []string{
+		"INF00A349242149", // unknown plant
+		"INF00A340262149", // 2026 is in the future
+		"INF00A340245449", // week 54
+	} {
+		if err := f.Validate(v); err == nil {
+			t.Errorf("Validate(%q) succeeded", v)
+		}
+		if _, ok := table.Products[0].Classify(v, nil); ok {
+			t.Errorf("Classify accepted %q", v)
+		}
+		if err := table.Products[0].Reject(v, nil); err == nil {
+			t.Errorf("Reject(%q) gave no reason", v)
+		}
+	}
+	if err := table.Products[0].Reject("garbage", nil); err != nil {
+		t.Errorf("Reject of a value matching no pattern: %v", err)
+	}
+
+	for _, seg := range []string{
+		`{"name": "plant", "start": 0, "len": 1}`,
+		`{"name": "year", "start": 0, "len": 3, "kind": "year"}`,
+		`{"name": "week", "start": 0, "len": 2, "kind": "fortnight"}`,
+		`{"start": 0, "len": 2, "kind": "week"}`,
+	} {
+		if _, err := load(t, `{"products": [{"name": "P", "fields": [{"name": "mbSN", "pattern": ".", "decode": [`+seg+`]}]}]}`); err == nil {
+			t.Errorf("decode %s accepted", seg)
+		}
+	}
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ================= RUN JOURNAL =================
+// Журнал прогона сохраняется на диск после каждого завершённого теста,
+// чтобы после сбоя питания или перезагрузки (reboot_required) можно было
+// продолжить сессию, пропустив уже пройденные тесты.
+
+const (
+	journalFile    = "crycaller_journal.json"
+	autostartFile  = ".crycaller_resume" // выполняется из .automated_script.sh после перезагрузки
+	stageRunning   = "running"
+	stageRebooting = "rebooting"
+	stageFinished  = "finished"
+)
+
+var runJournal *Journal
+
+type JournalEntry struct {
+	Path       string        `json:"path"`
+	Status     string        `json:"status"`
+	Code       int           `json:"code"`
+	Duration   time.Duration `json:"duration_ns"`
+	FinishedAt time.Time     `json:"finished_at"`
+}
+
+type Journal struct {
+	SessionID string                  `json:"session_id"`
+	StartedAt time.Time               `json:"started_at"`
+	UpdatedAt time.Time               `json:"updated_at"`
+	Stage     string                  `json:"stage"`
+	Operator  string                  `json:"operator,omitempty"`
+	StationID string                  `json:"station_id,omitempty"`
+	Product   string                  `json:"product,omitempty"`
+	Unit      map[string]string       `json:"unit,omitempty"`
+	Filter    *RunFilter              `json:"filter,omitempty"`
+	Soak      *SoakRun                `json:"soak,omitempty"`
+	Tests     map[string]JournalEntry `json:"tests"`
+
+	path  string
+	mutex sync.Mutex
+}
+
+func newJournal(path string) *Journal {
+	return &Journal{
+		SessionID: newSessionID(),
+		StartedAt: time.Now(),
+		Stage:     stageRunning,
+		Tests:     map[string]JournalEntry{},
+		path:      path,
+	}
+}
+
+func loadJournal(path string) (*Journal, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var j Journal
+	if err := json.Unmarshal(data, &j); err != nil {
+		return nil, err
+	}
+	if j.Tests == nil {
+		j.Tests = map[string]JournalEntry{}
+	}
+	j.path = path
+	return &j, nil
+}
+
+// newSessionID формирует ID вида 20250301-142530-a1b2
+func newSessionID() string {
+	b := make([]byte, 2)
+	_, _ = rand.Read(b)
+	return time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(b)
+}
+
+// testKey – идентификатор теста, не зависящий от порядка записей в конфиге
+func testKey(kind string, sc ScriptConfig) string {
+	key := strings.TrimSpace(fmt.Sprintf("%s:%s %s", kind, sc.Path, sc.Args))
+	if len(sc.Params) > 0 {
+		// встроенные проверки различаются только параметрами
+		var params []string
+		for k, v := range sc.Params {
+			params = append(params, k+"="+v)
+		}
+		sort.Strings(params)
+		key += " " + strings.Join(params, " ")
+	}
+	return key
+}
+
+// record фиксирует результат теста и сразу сохраняет журнал
+func (j *Journal) record(key, path string, st ScriptStatus, code int, dur time.Duration) {
+	if j == nil {
+		return
+	}
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	j.Tests[key] = JournalEntry{
+		Path:       path,
+		Status:     st.String(),
+		Code:       code,
+		Duration:   dur,
+		FinishedAt: time.Now(),
+	}
+	if err := j.saveLocked(); err != nil {
+		bareLog.Printf("Journal save error: %v", err)
+	}
+}
+
+func (j *Journal) setStage(stage string) {
+	if j == nil {
+		return
+	}
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	j.Stage = stage
+	if err := j.saveLocked(); err != nil {
+		bareLog.Printf("Journal save error: %v", err)
+	}
+}
+
+func (j *Journal) setOperator(operator, station string) {
+	if j == nil {
+		return
+	}
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	j.Operator = operator
+	j.StationID = station
+	if err := j.saveLocked(); err != nil {
+		bareLog.Printf("Journal save error: %v", err)
+	}
+}
+
+func (j *Journal) setUnit(product string, values map[string]string) {
+	if j == nil {
+		return
+	}
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	j.Product = product
+	j.Unit = values
+	if err := j.saveLocked(); err != nil {
+		bareLog.Printf("Journal save error: %v", err)
+	}
+}
+
+func (j *Journal) setFilter(f RunFilter) {
+	if j == nil {
+		return
+	}
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	j.Filter = &f
+	if err := j.saveLocked(); err != nil {
+		bareLog.Printf("Journal save error: %v", err)
+	}
+}
+
+// setSoak сохраняет состояние soak-прогона (циклы и статистику)
+func (j *Journal) setSoak(s *SoakRun) {
+	if j == nil || s == nil {
+		return
+	}
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	j.Soak = s.snapshot()
+	if err := j.saveLocked(); err != nil {
+		bareLog.Printf("Journal save error: %v", err)
+	}
+}
+
+// startSoakCycle сохраняет завершённые циклы и забывает результаты тестов:
+// при продолжении пропускаются только тесты, пройденные в текущем цикле
+func (j *Journal) startSoakCycle(s *SoakRun) {
+	if j == nil {
+		return
+	}
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	j.Soak = s.snapshot()
+	j.Tests = map[string]JournalEntry{}
+	if err := j.saveLocked(); err != nil {
+		bareLog.Printf("Journal save error: %v", err)
+	}
+}
+
+// passed возвращает запись, если тест уже прошёл в этой сессии
+func (j *Journal) passed(key string) (JournalEntry, bool) {
+	if j == nil {
+		return JournalEntry{}, false
+	}
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	e, ok := j.Tests[key]
+	return e, ok && e.Status == StatusPassed.String()
+}
+
+func (j *Journal) passedCount() int {
+	n := 0
+	for _, e := range j.Tests {
+		if e.Status == StatusPassed.String() {
+			n++
+		}
+	}
+	return n
+}
+
+// saveLocked пишет журнал атомарно: временный файл, fsync, rename
+func (j *Journal) saveLocked() error {
+	j.UpdatedAt = time.Now()
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := j.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, j.path)
+}
+
+// applyJournal помечает тесты, уже прошедшие в прерванной сессии, как PASSED,
+// чтобы они не запускались повторно
+func applyJournal(j *Journal, bgs []*BgScript, ints []*IntScript) {
+	for _, b := range bgs {
+		if e, ok := j.passed(b.Key); ok {
+			b.Status = StatusPassed
+			b.Code = 0
+			b.Duration = e.Duration
+			b.Resumed = true
+		}
+	}
+	for _, i := range ints {
+		if e, ok := j.passed(i.Key); ok {
+			i.Status = StatusPassed
+			i.Code = 0
+			i.Duration = e.Duration
+			i.Resumed = true
+		}
+	}
+}
+
+// askResume спрашивает оператора, продолжать ли незавершённую сессию
+func askResume(j *Journal) bool {
+	fmt.Printf("Found interrupted run %s (stage: %s, passed: %d, updated: %s).\n",
+		j.SessionID, j.Stage, j.passedCount(), j.UpdatedAt.Format("2006-01-02 15:04:05"))
+	fmt.Print("Resume it and skip passed tests? (Y/n): ")
+	choice, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	return !strings.EqualFold(strings.TrimSpace(choice), "n")
+}
+
+// ================= REBOOT STAGE =================
+// Тесты с reboot_required запускаются первыми и отдельно от остальных.
+// Если все они прошли, crycaller перезагружает систему, а после загрузки
+// .automated_script.sh выполняет autostartFile и прогон продолжается с --resume.
+
+func hasWaitingReboot(bgs []*BgScript, ints []*IntScript) bool {
+	for _, b := range bgs {
+		if b.RebootRequired && b.Status == StatusWaiting {
+			return true
+		}
+	}
+	for _, i := range ints {
+		if i.RebootRequired && i.Status == StatusWaiting {
+			return true
+		}
+	}
+	return false
+}
+
+// rebootStageDone – все тесты с reboot_required завершились, а остальные ещё ждут запуска
+func rebootStageDone(bgs []*BgScript, ints []*IntScript) bool {
+	waiting := false
+	for _, b := range bgs {
+		if b.RebootRequired && (b.Status == StatusWaiting || b.Status == StatusRunning || b.Status == StatusPaused) {
+			return false
+		}
+		if !b.RebootRequired && b.Status == StatusWaiting {
+			waiting = true
+		}
+	}
+	for _, i := range ints {
+		if i.RebootRequired && (i.Status == StatusWaiting || i.Status == StatusRunning || i.Status == StatusPaused) {
+			return false
+		}
+		if !i.RebootRequired && i.Status == StatusWaiting {
+			waiting = true
+		}
+	}
+	return waiting
+}
+
+func rebootTestsPassed(bgs []*BgScript, ints []*IntScript) bool {
+	for _, b := range bgs {
+		if b.RebootRequired && b.Status != StatusPassed {
+			return false
+		}
+	}
+	for _, i := range ints {
+		if i.RebootRequired && i.Status != StatusPassed {
+			return false
+		}
+	}
+	return true
+}
+
+// armAutostart создаёт скрипт, который .automated_script.sh запустит после перезагрузки
+func armAutostart() error {
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	args := []string{self, "-resume"}
+	for _, a := range os.Args[1:] {
+		if a != "-resume" && a != "--resume" {
+			args = append(args, a)
+		}
+	}
+	for idx, a := range args {
+		args[idx] = "'" + strings.ReplaceAll(a, "'", `'\''`) + "'"
+	}
+	script := fmt.Sprintf("#!/usr/bin/env bash\ncd '%s' && exec %s\n",
+		strings.ReplaceAll(cwd, "'", `'\''`), strings.Join(args, " "))
+	return os.WriteFile(filepath.Join(cwd, autostartFile), []byte(script), 0755)
+}
+
+func disarmAutostart() {
+	if err := os.Remove(autostartFile); err != nil && !os.IsNotExist(err) {
+		bareLog.Printf("Failed to remove %s: %v", autostartFile, err)
+	}
+}
+
+func rebootSystem() error {
+	return exec.Command("reboot").Run()
+}
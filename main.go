@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
 	"log"
@@ -13,9 +14,14 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 	"unicode/utf8"
 
+	"crycaller/internal/safename"
+	"crycaller/internal/unitrules"
+
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/creack/pty"
@@ -26,6 +32,56 @@ import (
 var bareLog *log.Logger
 var debugLog *log.Logger
 
+// logFiles – открытые файлы логов, logStamp – станция и оператор в их именах
+var logFiles []*os.File
+var logStamp string
+
+// openLogs открывает bare_log/debug_log с именами по станции и оператору:
+// bare_log_<station>_<operator>.log, пустые части пропускаются. После смены
+// станции или оператора записи идут в новые файлы, логгеры остаются те же.
+func openLogs() error {
+	stamp := safename.Join(identity.Station(), identity.Operator())
+	if logFiles != nil && stamp == logStamp {
+		return nil
+	}
+	var files []*os.File
+	for _, base := range []string{"bare_log", "debug_log"} {
+		name := safename.Join(base, stamp) + ".log"
+		f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+		if err != nil {
+			for _, f := range files {
+				f.Close()
+			}
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		files = append(files, f)
+	}
+	if bareLog == nil {
+		bareLog = log.New(files[0], "", log.LstdFlags)
+		debugLog = log.New(files[1], "DEBUG: ", log.LstdFlags)
+	} else {
+		// SetOutput ждёт текущую запись, после него старые файлы можно закрыть
+		bareLog.SetOutput(files[0])
+		debugLog.SetOutput(files[1])
+	}
+	for _, f := range logFiles {
+		f.Close()
+	}
+	logFiles, logStamp = files, stamp
+	return nil
+}
+
+// stampLogs переоткрывает логи после смены станции или оператора.
+// Без открытых логов (тесты) ничего не делает, при ошибке пишет в старые.
+func stampLogs() {
+	if logFiles == nil {
+		return
+	}
+	if err := openLogs(); err != nil {
+		bareLog.Printf("Error reopening logs: %v", err)
+	}
+}
+
 var globalConfig *Config
 
 // ================= CONFIG STRUCTS =================
@@ -33,21 +89,51 @@ type KeysConfig struct {
 	Focus   string            `json:"focus,omitempty"`
 	Custom  map[string]string `json:"custom,omitempty"`
 	Restart string            `json:"restart,omitempty"`
+	Pause   string            `json:"pause,omitempty"` // пауза/продолжение (по умолчанию ctrl+p)
+	Abort   string            `json:"abort,omitempty"` // прерывание без рестарта (по умолчанию ctrl+x)
 }
 
 type Config struct {
 	BackgroundScripts  []ScriptConfig `json:"background_scripts"`
 	InteractiveScripts []ScriptConfig `json:"interactive_scripts"`
+
+	StationID   string `json:"station_id,omitempty"`   // идентификатор стенда, попадает в отчёты
+	AskOperator bool   `json:"ask_operator,omitempty"` // стартовый экран ввода оператора
+
+	AskUnit   bool   `json:"ask_unit,omitempty"`   // перед прогоном сканировать SN/MAC изделия
+	UnitRules string `json:"unit_rules,omitempty"` // таблица правил (по умолчанию unit_rules.json)
+	Product   string `json:"product,omitempty"`    // продукт, если не определять его по DMI
+
+	AskFilter bool `json:"ask_filter,omitempty"` // перед прогоном выбрать теги на экране
 }
 
 type ScriptConfig struct {
 	Path      string     `json:"path"`
 	Args      string     `json:"args"`
-	Type      string     `json:"type"` // e.g. "binary", "binary, curses", "script, info"
+	Type      string     `json:"type"` // e.g. "binary", "binary, curses", "script, info", "builtin"
 	MaxLogs   int        `json:"max_logs,omitempty"`
 	Output    bool       `json:"output"`               // показывать отдельную плитку
 	OutputRes string     `json:"output_res,omitempty"` // пример: "10x40"
 	Keys      KeysConfig `json:"keys,omitempty"`
+
+	RebootRequired bool `json:"reboot_required,omitempty"` // после успешного прохождения нужна перезагрузка
+
+	Builtin string            `json:"builtin,omitempty"` // имя встроенной проверки для type: "builtin"
+	Params  map[string]string `json:"params,omitempty"`  // параметры встроенной проверки
+
+	Timeout string `json:"timeout,omitempty"` // например "10m"; по истечении тест считается упавшим, пауза не в счёт (не для builtin)
+
+	Env         map[string]string `json:"env,omitempty"`          // дополнительные переменные, поддерживается $VAR
+	Cwd         string            `json:"cwd,omitempty"`          // рабочий каталог теста
+	User        string            `json:"user,omitempty"`         // запуск от имени пользователя (имя или uid)
+	Group       string            `json:"group,omitempty"`        // группа (имя или gid)
+	Nice        *int              `json:"nice,omitempty"`         // -20..19
+	IONice      string            `json:"ionice,omitempty"`       // "idle", "best-effort:7", "realtime:0"
+	CPUAffinity string            `json:"cpu_affinity,omitempty"` // например "2-7"
+
+	Describe bool `json:"describe,omitempty"` // бинарник поддерживает --describe (манифест параметров)
+
+	Tags []string `json:"tags,omitempty"` // например ["audio", "quick"]; см. -only/-skip
 }
 
 // ================= SCRIPT STATUS =================
@@ -58,6 +144,8 @@ const (
 	StatusRunning
 	StatusPassed
 	StatusFailed
+	StatusPaused
+	StatusAborted
 )
 
 func (s ScriptStatus) String() string {
@@ -70,6 +158,10 @@ func (s ScriptStatus) String() string {
 		return "PASSED"
 	case StatusFailed:
 		return "FAILED"
+	case StatusPaused:
+		return "PAUSED"
+	case StatusAborted:
+		return "ABORTED"
 	}
 	return "UNKNOWN"
 }
@@ -251,12 +343,33 @@ type BgScript struct {
 	Duration   time.Duration
 	FinishedAt time.Time
 
+	PausedTotal time.Duration // суммарное время на паузе, не входит в Duration
+	pausedAt    time.Time
+	aborted     bool
+
 	cmd         *exec.Cmd
 	pty         *os.File
 	cancel      context.CancelFunc
 	mutex       sync.Mutex
 	Keys        KeysConfig
 	ConfigIndex int
+
+	Key            string // идентификатор теста в журнале
+	RebootRequired bool
+	Resumed        bool // результат взят из журнала прерванного прогона
+	Builtin        string
+	Params         map[string]string
+
+	Timeout  time.Duration
+	timer    *time.Timer // таймер timeout, на паузе остановлен
+	timedOut atomic.Bool
+	CutOff   bool   // info-тест остановлен при завершении основных тестов
+	Reason   string // причина неудачи, если её не выразить кодом возврата
+
+	Attempts []TestAttempt // результаты предыдущих запусков в этой сессии
+
+	Proc  ProcOptions
+	Usage ResourceUsage
 }
 
 func (b *BgScript) Start(wg *sync.WaitGroup, notifyFn func()) {
@@ -266,6 +379,12 @@ func (b *BgScript) Start(wg *sync.WaitGroup, notifyFn func()) {
 
 	ctx, cancel := context.WithCancel(context.Background())
 	b.cancel = cancel
+	defer cancel()
+
+	if b.Type == "builtin" {
+		b.runBuiltinTest(ctx, notifyFn)
+		return
+	}
 
 	args := parseArgs(b.Args)
 	isCurses := strings.Contains(strings.ToLower(b.Type), "curses")
@@ -281,19 +400,29 @@ func (b *BgScript) Start(wg *sync.WaitGroup, notifyFn func()) {
 	} else {
 		b.Status = StatusFailed
 		b.Code = -1
+		b.Reason = fmt.Sprintf("unsupported type %q", b.Type)
+		notifyFn()
+		return
+	}
+	if err := b.Proc.prepare(cmd); err != nil {
+		b.Status = StatusFailed
+		b.Code = -1
+		b.Reason = err.Error()
 		notifyFn()
 		return
 	}
-	cmd.Env = append(os.Environ(), "TERM=xterm-256color")
 	b.cmd = cmd
 
 	ptmx, err := pty.Start(cmd)
 	if err != nil {
 		b.Status = StatusFailed
 		b.Code = -1
+		b.Reason = "start failed: " + err.Error()
 		notifyFn()
 		return
 	}
+	liveGroups.add(cmd.Process.Pid)
+	tracker := startUsageTracker(cmd.Process.Pid)
 	b.pty = ptmx
 	_ = pty.Setsize(ptmx, &pty.Winsize{Rows: 1000, Cols: 2000})
 	if isCurses {
@@ -327,7 +456,20 @@ func (b *BgScript) Start(wg *sync.WaitGroup, notifyFn func()) {
 		}
 	}()
 
-	if err := cmd.Wait(); err != nil {
+	if b.Timeout > 0 {
+		b.timer = time.AfterFunc(b.Timeout, func() {
+			b.timedOut.Store(true)
+			b.Stop()
+		})
+		defer b.timer.Stop()
+	}
+
+	err = cmd.Wait()
+	if b.Status == StatusPaused {
+		// Тест завершился на паузе (убит извне или прерван) – пауза не входит в Duration
+		b.PausedTotal += time.Since(b.pausedAt)
+	}
+	if err != nil {
 		b.Status = StatusFailed
 		if exitErr, ok := err.(*exec.ExitError); ok {
 			b.Code = exitErr.ExitCode()
@@ -338,14 +480,32 @@ func (b *BgScript) Start(wg *sync.WaitGroup, notifyFn func()) {
 		b.Status = StatusPassed
 		b.Code = 0
 	}
+	b.Usage = tracker.stop(cmd.ProcessState)
+	if len(b.Usage.Leaked) > 0 {
+		bareLog.Printf("%s left %d process(es) running after exit: %v", b.Path, len(b.Usage.Leaked), b.Usage.Leaked)
+	}
+	reapSession(cmd.Process.Pid, b.Usage.Leaked)
+	if b.timedOut.Load() {
+		b.Status = StatusFailed
+		b.Reason = fmt.Sprintf("timeout after %v", b.Timeout)
+	}
+	if b.aborted {
+		b.Status = StatusAborted
+	}
 	b.EndTime = time.Now()
-	b.Duration = b.EndTime.Sub(b.StartTime)
+	b.Duration = b.EndTime.Sub(b.StartTime) - b.PausedTotal
 	b.FinishedAt = time.Now()
+	runJournal.record(b.Key, b.Path, b.Status, b.Code, b.Duration)
 	notifyFn()
 }
 
 func (b *BgScript) Stop() {
-	if b.cancel != nil {
+	if b.cmd != nil && b.cmd.Process != nil {
+		// Завершаем всё дерево процессов теста, а не только главный процесс
+		if b.Status == StatusRunning || b.Status == StatusPaused {
+			killTree(b.cmd.Process.Pid)
+		}
+	} else if b.cancel != nil {
 		b.cancel()
 	}
 	if b.pty != nil {
@@ -353,6 +513,53 @@ func (b *BgScript) Stop() {
 	}
 }
 
+// Pause останавливает всю группу процессов теста (SIGSTOP).
+// pty.Start запускает тест в новой сессии, поэтому pgid совпадает с pid.
+func (b *BgScript) Pause() {
+	if b.Status != StatusRunning {
+		return
+	}
+	if err := signalGroup(b.cmd, syscall.SIGSTOP); err != nil {
+		bareLog.Printf("Pause %s: %v", b.Path, err)
+		return
+	}
+	b.pausedAt = time.Now()
+	b.Status = StatusPaused
+	// Время на паузе не идёт в счёт таймаута
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+}
+
+// Resume продолжает выполнение группы процессов (SIGCONT)
+func (b *BgScript) Resume() {
+	if b.Status != StatusPaused {
+		return
+	}
+	if err := signalGroup(b.cmd, syscall.SIGCONT); err != nil {
+		bareLog.Printf("Resume %s: %v", b.Path, err)
+		return
+	}
+	b.PausedTotal += time.Since(b.pausedAt)
+	b.Status = StatusRunning
+	if b.timer != nil && !b.timedOut.Load() {
+		b.timer.Reset(b.Timeout - (time.Since(b.StartTime) - b.PausedTotal))
+	}
+}
+
+// Abort прерывает тест без рестарта, итоговый статус – ABORTED
+func (b *BgScript) Abort() {
+	if b.Status != StatusRunning && b.Status != StatusPaused {
+		return
+	}
+	b.aborted = true
+	if b.Status == StatusPaused {
+		// Остановленные процессы должны проснуться, чтобы получить сигнал завершения
+		_ = signalGroup(b.cmd, syscall.SIGCONT)
+	}
+	b.Stop()
+}
+
 // ================= INTERACTIVE SCRIPT =================
 type IntScript struct {
 	Path      string
@@ -375,11 +582,33 @@ type IntScript struct {
 	Duration   time.Duration
 	FinishedAt time.Time
 
+	PausedTotal time.Duration // суммарное время на паузе, не входит в Duration
+	pausedAt    time.Time
+	aborted     bool
+
 	cmd         *exec.Cmd
 	pty         *os.File
+	cancel      context.CancelFunc
 	mutex       sync.Mutex
 	Keys        KeysConfig
 	ConfigIndex int
+
+	Key            string // идентификатор теста в журнале
+	RebootRequired bool
+	Resumed        bool // результат взят из журнала прерванного прогона
+	Builtin        string
+	Params         map[string]string
+
+	Timeout  time.Duration
+	timer    *time.Timer // таймер timeout, на паузе остановлен
+	timedOut atomic.Bool
+	CutOff   bool   // info-тест остановлен при завершении основных тестов
+	Reason   string // причина неудачи, если её не выразить кодом возврата
+
+	Attempts []TestAttempt // результаты предыдущих запусков в этой сессии
+
+	Proc  ProcOptions
+	Usage ResourceUsage
 }
 
 func (i *IntScript) Start(wg *sync.WaitGroup, notifyFn func()) {
@@ -387,33 +616,52 @@ func (i *IntScript) Start(wg *sync.WaitGroup, notifyFn func()) {
 	i.Status = StatusRunning
 	i.StartTime = time.Now()
 
+	ctx, cancel := context.WithCancel(context.Background())
+	i.cancel = cancel
+	defer cancel()
+
+	if i.Type == "builtin" {
+		i.runBuiltinTest(ctx, notifyFn)
+		return
+	}
+
 	args := parseArgs(i.Args)
 	isCurses := strings.Contains(strings.ToLower(i.Type), "curses")
 	var cmd *exec.Cmd
 	if i.Type == "script" || (!isCurses && i.Type == "binary") {
 		if i.Type == "script" {
-			cmd = exec.CommandContext(context.Background(), "bash", append([]string{i.Path}, args...)...)
+			cmd = exec.CommandContext(ctx, "bash", append([]string{i.Path}, args...)...)
 		} else {
-			cmd = exec.CommandContext(context.Background(), i.Path, args...)
+			cmd = exec.CommandContext(ctx, i.Path, args...)
 		}
 	} else if isCurses {
-		cmd = exec.CommandContext(context.Background(), i.Path, args...)
+		cmd = exec.CommandContext(ctx, i.Path, args...)
 	} else {
 		i.Status = StatusFailed
 		i.Code = -1
+		i.Reason = fmt.Sprintf("unsupported type %q", i.Type)
+		notifyFn()
+		return
+	}
+	if err := i.Proc.prepare(cmd); err != nil {
+		i.Status = StatusFailed
+		i.Code = -1
+		i.Reason = err.Error()
 		notifyFn()
 		return
 	}
-	cmd.Env = append(os.Environ(), "TERM=xterm-256color")
 	i.cmd = cmd
 
 	ptmx, err := pty.Start(cmd)
 	if err != nil {
 		i.Status = StatusFailed
 		i.Code = -1
+		i.Reason = "start failed: " + err.Error()
 		notifyFn()
 		return
 	}
+	liveGroups.add(cmd.Process.Pid)
+	tracker := startUsageTracker(cmd.Process.Pid)
 	i.pty = ptmx
 	_ = pty.Setsize(ptmx, &pty.Winsize{Rows: 1000, Cols: 2000})
 	if isCurses {
@@ -447,7 +695,20 @@ func (i *IntScript) Start(wg *sync.WaitGroup, notifyFn func()) {
 		}
 	}()
 
-	if err := cmd.Wait(); err != nil {
+	if i.Timeout > 0 {
+		i.timer = time.AfterFunc(i.Timeout, func() {
+			i.timedOut.Store(true)
+			i.Stop()
+		})
+		defer i.timer.Stop()
+	}
+
+	err = cmd.Wait()
+	if i.Status == StatusPaused {
+		// Тест завершился на паузе (убит извне или прерван) – пауза не входит в Duration
+		i.PausedTotal += time.Since(i.pausedAt)
+	}
+	if err != nil {
 		i.Status = StatusFailed
 		if exitErr, ok := err.(*exec.ExitError); ok {
 			i.Code = exitErr.ExitCode()
@@ -458,92 +719,214 @@ func (i *IntScript) Start(wg *sync.WaitGroup, notifyFn func()) {
 		i.Status = StatusPassed
 		i.Code = 0
 	}
+	i.Usage = tracker.stop(cmd.ProcessState)
+	if len(i.Usage.Leaked) > 0 {
+		bareLog.Printf("%s left %d process(es) running after exit: %v", i.Path, len(i.Usage.Leaked), i.Usage.Leaked)
+	}
+	reapSession(cmd.Process.Pid, i.Usage.Leaked)
+	if i.timedOut.Load() {
+		i.Status = StatusFailed
+		i.Reason = fmt.Sprintf("timeout after %v", i.Timeout)
+	}
+	if i.aborted {
+		i.Status = StatusAborted
+	}
 	i.EndTime = time.Now()
-	i.Duration = i.EndTime.Sub(i.StartTime)
+	i.Duration = i.EndTime.Sub(i.StartTime) - i.PausedTotal
 	i.FinishedAt = time.Now()
+	runJournal.record(i.Key, i.Path, i.Status, i.Code, i.Duration)
 	notifyFn()
 }
 
 func (i *IntScript) Stop() {
 	if i.cmd != nil && i.cmd.Process != nil {
-		i.cmd.Process.Kill()
+		// Завершаем всё дерево процессов теста, а не только главный процесс
+		if i.Status == StatusRunning || i.Status == StatusPaused {
+			killTree(i.cmd.Process.Pid)
+		}
+	} else if i.cancel != nil {
+		i.cancel()
 	}
 	if i.pty != nil {
 		i.pty.Close()
 	}
 }
 
-// ================= INDIVIDUAL RESTART HELPERS =================
-func restartBgTest(old *BgScript, notifyFn func()) *BgScript {
-	config := globalConfig.BackgroundScripts[old.ConfigIndex]
-	maxLogs := config.MaxLogs
+// Pause останавливает всю группу процессов теста (SIGSTOP).
+// pty.Start запускает тест в новой сессии, поэтому pgid совпадает с pid.
+func (i *IntScript) Pause() {
+	if i.Status != StatusRunning {
+		return
+	}
+	if err := signalGroup(i.cmd, syscall.SIGSTOP); err != nil {
+		bareLog.Printf("Pause %s: %v", i.Path, err)
+		return
+	}
+	i.pausedAt = time.Now()
+	i.Status = StatusPaused
+	// Время на паузе не идёт в счёт таймаута
+	if i.timer != nil {
+		i.timer.Stop()
+	}
+}
+
+// Resume продолжает выполнение группы процессов (SIGCONT)
+func (i *IntScript) Resume() {
+	if i.Status != StatusPaused {
+		return
+	}
+	if err := signalGroup(i.cmd, syscall.SIGCONT); err != nil {
+		bareLog.Printf("Resume %s: %v", i.Path, err)
+		return
+	}
+	i.PausedTotal += time.Since(i.pausedAt)
+	i.Status = StatusRunning
+	if i.timer != nil && !i.timedOut.Load() {
+		i.timer.Reset(i.Timeout - (time.Since(i.StartTime) - i.PausedTotal))
+	}
+}
+
+// Abort прерывает тест без рестарта, итоговый статус – ABORTED
+func (i *IntScript) Abort() {
+	if i.Status != StatusRunning && i.Status != StatusPaused {
+		return
+	}
+	i.aborted = true
+	if i.Status == StatusPaused {
+		// Остановленные процессы должны проснуться, чтобы получить сигнал завершения
+		_ = signalGroup(i.cmd, syscall.SIGCONT)
+	}
+	i.Stop()
+}
+
+// signalGroup отправляет сигнал всей группе процессов, запущенной через pty.Start
+func signalGroup(cmd *exec.Cmd, sig syscall.Signal) error {
+	if cmd == nil || cmd.Process == nil {
+		return fmt.Errorf("process is not started")
+	}
+	return syscall.Kill(-cmd.Process.Pid, sig)
+}
+
+// ================= CONSTRUCTORS =================
+// newBgScript создаёт фоновый тест по записи конфига с индексом idx
+func newBgScript(sc ScriptConfig, idx int) *BgScript {
+	maxLogs := sc.MaxLogs
 	if maxLogs <= 0 {
 		maxLogs = 5
 	}
-	isCurses := strings.Contains(strings.ToLower(config.Type), "curses")
-	h, w, err := parseOutputRes(config.OutputRes, isCurses)
+	isCurses := strings.Contains(strings.ToLower(sc.Type), "curses")
+	h, w, err := parseOutputRes(sc.OutputRes, isCurses)
 	if err != nil {
-		bareLog.Printf("Config error for %s: %v, using defaults", config.Path, err)
+		bareLog.Printf("Config error for %s: %v, using defaults", sc.Path, err)
 		h, w = 10, 40
 	}
-	parts := strings.Split(config.Type, ",")
+	parts := strings.Split(sc.Type, ",")
 	baseType := strings.TrimSpace(parts[0])
 	infoFlag := len(parts) > 1 && strings.TrimSpace(parts[1]) == "info"
-	newTest := &BgScript{
-		Path:        config.Path,
-		Args:        config.Args,
-		Type:        baseType,
-		Info:        infoFlag,
-		Status:      StatusWaiting,
-		Code:        -1,
-		RawLog:      []string{},
-		MaxLogs:     maxLogs,
-		Output:      config.Output,
-		OutHeight:   h,
-		OutWidth:    w,
-		OutputRes:   config.OutputRes,
-		Keys:        config.Keys,
-		ConfigIndex: old.ConfigIndex,
+	if baseType == "builtin" && sc.Path == "" {
+		sc.Path = "builtin:" + sc.Builtin
+	}
+	var timeout time.Duration
+	if sc.Timeout != "" {
+		if timeout, err = time.ParseDuration(sc.Timeout); err != nil {
+			bareLog.Printf("Config error for %s: invalid timeout %q: %v", sc.Path, sc.Timeout, err)
+		}
+	}
+	return &BgScript{
+		Path:           sc.Path,
+		Args:           sc.Args,
+		Type:           baseType,
+		Info:           infoFlag,
+		Status:         StatusWaiting,
+		Code:           -1,
+		RawLog:         []string{},
+		MaxLogs:        maxLogs,
+		Output:         sc.Output,
+		OutHeight:      h,
+		OutWidth:       w,
+		OutputRes:      sc.OutputRes,
+		Keys:           sc.Keys,
+		ConfigIndex:    idx,
+		Key:            testKey("bg", sc),
+		RebootRequired: sc.RebootRequired,
+		Builtin:        sc.Builtin,
+		Params:         sc.Params,
+		Timeout:        timeout,
+		Proc:           procOptions(sc),
 	}
-	go func() {
-		var wg sync.WaitGroup
-		wg.Add(1)
-		newTest.Start(&wg, notifyFn)
-	}()
-	return newTest
 }
 
-func restartIntTest(old *IntScript, notifyFn func()) *IntScript {
-	config := globalConfig.InteractiveScripts[old.ConfigIndex]
-	maxLogs := config.MaxLogs
+// newIntScript создаёт интерактивный тест по записи конфига с индексом idx
+func newIntScript(sc ScriptConfig, idx int) *IntScript {
+	maxLogs := sc.MaxLogs
 	if maxLogs <= 0 {
 		maxLogs = 5
 	}
-	isCurses := strings.Contains(strings.ToLower(config.Type), "curses")
-	h, w, err := parseOutputRes(config.OutputRes, isCurses)
+	isCurses := strings.Contains(strings.ToLower(sc.Type), "curses")
+	h, w, err := parseOutputRes(sc.OutputRes, isCurses)
 	if err != nil {
-		bareLog.Printf("Config error for %s: %v, using defaults", config.Path, err)
+		bareLog.Printf("Config error for %s: %v, using defaults", sc.Path, err)
 		h, w = 10, 40
 	}
-	parts := strings.Split(config.Type, ",")
+	parts := strings.Split(sc.Type, ",")
 	baseType := strings.TrimSpace(parts[0])
 	infoFlag := len(parts) > 1 && strings.TrimSpace(parts[1]) == "info"
-	newTest := &IntScript{
-		Path:        config.Path,
-		Args:        config.Args,
-		Type:        baseType,
-		Info:        infoFlag,
-		Status:      StatusWaiting,
-		Code:        -1,
-		RawLog:      []string{},
-		MaxLogs:     maxLogs,
-		Output:      config.Output,
-		OutHeight:   h,
-		OutWidth:    w,
-		OutputRes:   config.OutputRes,
-		Keys:        config.Keys,
-		ConfigIndex: old.ConfigIndex,
+	if baseType == "builtin" && sc.Path == "" {
+		sc.Path = "builtin:" + sc.Builtin
+	}
+	var timeout time.Duration
+	if sc.Timeout != "" {
+		if timeout, err = time.ParseDuration(sc.Timeout); err != nil {
+			bareLog.Printf("Config error for %s: invalid timeout %q: %v", sc.Path, sc.Timeout, err)
+		}
+	}
+	return &IntScript{
+		Path:           sc.Path,
+		Args:           sc.Args,
+		Type:           baseType,
+		Info:           infoFlag,
+		Status:         StatusWaiting,
+		Code:           -1,
+		RawLog:         []string{},
+		MaxLogs:        maxLogs,
+		Output:         sc.Output,
+		OutHeight:      h,
+		OutWidth:       w,
+		OutputRes:      sc.OutputRes,
+		Keys:           sc.Keys,
+		ConfigIndex:    idx,
+		Key:            testKey("int", sc),
+		RebootRequired: sc.RebootRequired,
+		Builtin:        sc.Builtin,
+		Params:         sc.Params,
+		Timeout:        timeout,
+		Proc:           procOptions(sc),
+	}
+}
+
+// ================= INDIVIDUAL RESTART HELPERS =================
+func restartBgTest(old *BgScript, notifyFn func()) *BgScript {
+	if old.ConfigIndex < 0 {
+		// Тест удалён из конфига при перезагрузке – перезапускать нечего
+		return old
 	}
+	old.Stop()
+	newTest := newBgScript(globalConfig.BackgroundScripts[old.ConfigIndex], old.ConfigIndex)
+	go func() {
+		var wg sync.WaitGroup
+		wg.Add(1)
+		newTest.Start(&wg, notifyFn)
+	}()
+	return newTest
+}
+
+func restartIntTest(old *IntScript, notifyFn func()) *IntScript {
+	if old.ConfigIndex < 0 {
+		// Тест удалён из конфига при перезагрузке – перезапускать нечего
+		return old
+	}
+	old.Stop()
+	newTest := newIntScript(globalConfig.InteractiveScripts[old.ConfigIndex], old.ConfigIndex)
 	go func() {
 		var wg sync.WaitGroup
 		wg.Add(1)
@@ -558,10 +941,14 @@ type uiMode int
 const (
 	modeMain uiMode = iota
 	modeFinal
+	modeOperator
+	modeUnit
+	modeFilter
 )
 
 type doneAllMsg struct{}
 type refreshMsg struct{}
+type rebootStageMsg struct{}
 type selectTileMsg struct{ index int }
 
 type outputTile struct {
@@ -581,11 +968,39 @@ type model struct {
 	outputTiles     []outputTile
 	selectedTileIdx int
 	ctrlPressed     bool
+
+	rebootStage bool // запущены только тесты с reboot_required
+	rebooting   bool // после выхода из TUI нужно перезагрузить систему
+
+	operatorInput string
+	returnMode    uiMode // режим, в который вернётся экран оператора
+	pendingLaunch bool   // тесты ждут стартовых экранов
+	reportPath    string
+
+	unitInput   string
+	unitMsg     string
+	unitProduct *unitrules.Product
+	unitValues  map[string]string
+
+	finalIdx      int  // выбранная строка финального экрана
+	logView       bool // открыт полный лог выбранного теста
+	logOffset     int
+	finalSelected map[string]bool // тесты, отмеченные для повторного запуска (по Key)
+
+	reloadApplied string   // результат последней перезагрузки config.json
+	reloadQueued  []string // изменения, ожидающие рестарта
+
+	configWarnings []string // несоответствия args манифестам тестов
+
+	filterIdx    int
+	filterState  map[string]int // тег -> tagNone/tagOnly/tagSkip
+	filterPicked bool           // фильтр выбран (экраном или флагами)
 }
 
 func (m model) Init() tea.Cmd {
-	// Запускаем периодическую команду обновления состояния
-	return tickCmd()
+	// Запускаем периодическую команду обновления состояния и, если стартовых
+	// экранов нет, сами тесты
+	return tea.Batch(tickCmd(), startCmd(m))
 }
 
 // tickCmd отправляет refreshMsg каждую секунду
@@ -602,20 +1017,82 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.width = msg.Width
 		m.height = msg.Height
 		return m, tickCmd()
+	case startRunMsg:
+		if m.mode == modeMain && m.pendingLaunch {
+			m.pendingLaunch = false
+			launchScripts(m.bgScripts, m.intScripts, notifyFor(m.bgScripts, m.intScripts))
+		}
+		return m, nil
 	case doneAllMsg:
+		// Сообщение могло прийти от теста, запущенного до перезагрузки конфига
+		if !allScriptsDone(m.bgScripts, m.intScripts) {
+			return m, tickCmd()
+		}
 		// Когда все тесты завершены – переходим в финальный режим
 		for _, b := range m.bgScripts {
-			if b.Info && b.Status == StatusRunning {
+			if b.Info && (b.Status == StatusRunning || b.Status == StatusPaused) {
+				b.CutOff = true
 				b.Stop()
 			}
 		}
 		for _, i := range m.intScripts {
-			if i.Info && i.Status == StatusRunning {
+			if i.Info && (i.Status == StatusRunning || i.Status == StatusPaused) {
+				i.CutOff = true
 				i.Stop()
 			}
 		}
-		m.mode = modeFinal
+		if m.mode == modeFinal {
+			m.exitCode = computeExitCode(m.bgScripts, m.intScripts)
+			return m, tickCmd()
+		}
+		// Soak: сохраняем цикл и, если нужно, сразу запускаем следующий
+		if soak != nil && !soak.done && soak.finishCycle(m.bgScripts, m.intScripts) && nextSoakCycle(&m) {
+			return m, tickCmd()
+		}
+		if m.mode == modeOperator {
+			m.returnMode = modeFinal
+		} else {
+			m.mode = modeFinal
+		}
 		m.exitCode = computeExitCode(m.bgScripts, m.intScripts)
+		if soak != nil && soak.failedCycles() > 0 {
+			m.exitCode = 1
+		}
+		runJournal.setStage(stageFinished)
+		disarmAutostart()
+		if path, err := writeRunReport(buildRunReport(m)); err != nil {
+			bareLog.Printf("Failed to write run report: %v", err)
+		} else {
+			m.reportPath = path
+		}
+		return m, tickCmd()
+	case signalMsg:
+		return handleSignalMsg(m, msg)
+	case configReloadMsg:
+		return handleConfigReload(m, msg)
+	case rebootStageMsg:
+		if !m.rebootStage {
+			return m, tickCmd()
+		}
+		m.rebootStage = false
+		if rebootTestsPassed(m.bgScripts, m.intScripts) {
+			// Все тесты, требующие перезагрузки, прошли – сохраняем стадию и перезагружаемся
+			runJournal.setStage(stageRebooting)
+			if err := armAutostart(); err != nil {
+				bareLog.Printf("Failed to arm autostart: %v", err)
+			}
+			for _, b := range m.bgScripts {
+				b.Stop()
+			}
+			for _, i := range m.intScripts {
+				i.Stop()
+			}
+			m.rebooting = true
+			m.quitting = true
+			return m, tea.Quit
+		}
+		// Кто-то из них упал – перезагрузка бессмысленна, запускаем остальные тесты
+		launchScripts(m.bgScripts, m.intScripts, notifyFor(m.bgScripts, m.intScripts))
 		return m, tickCmd()
 	case selectTileMsg:
 		if msg.index >= 0 && msg.index < len(m.outputTiles) {
@@ -639,6 +1116,30 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 func handleKeyMsg(m model, msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	k := msg.String()
 
+	// Стартовые экраны перехватывают весь ввод (кроме выхода)
+	if m.mode == modeOperator && k != "ctrl+q" {
+		return handleOperatorKey(m, msg)
+	}
+	if m.mode == modeUnit && k != "ctrl+q" {
+		return handleUnitKey(m, msg)
+	}
+	if m.mode == modeFilter && k != "ctrl+q" {
+		return handleFilterKey(m, msg)
+	}
+
+	// Навигация по финальному экрану и просмотр логов
+	if m.mode == modeFinal && !strings.HasPrefix(k, "ctrl+") {
+		return handleFinalKey(m, msg)
+	}
+
+	// Смена оператора посреди смены: ctrl+o
+	if k == "ctrl+o" && m.mode != modeUnit && m.mode != modeFilter {
+		m.returnMode = m.mode
+		m.mode = modeOperator
+		m.operatorInput = ""
+		return m, nil
+	}
+
 	// Если нажата комбинация ctrl+<X>, извлекаем X
 	ctrlKey := ""
 	if strings.HasPrefix(k, "ctrl+") {
@@ -696,6 +1197,43 @@ func handleKeyMsg(m model, msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		}
 	}
 
+	// Пауза/продолжение и прерывание выбранного теста: ctrl+p / ctrl+x или ctrl+<pause> / ctrl+<abort>
+	if ctrlKey != "" && m.mode == modeMain && len(m.outputTiles) > 0 && m.selectedTileIdx < len(m.outputTiles) {
+		tile := m.outputTiles[m.selectedTileIdx]
+		var keys KeysConfig
+		if tile.isBackground {
+			keys = m.bgScripts[tile.index].Keys
+		} else {
+			keys = m.intScripts[tile.index].Keys
+		}
+		if ctrlKey == "p" || (keys.Pause != "" && keys.Pause == ctrlKey) {
+			if tile.isBackground {
+				b := m.bgScripts[tile.index]
+				if b.Status == StatusPaused {
+					b.Resume()
+				} else {
+					b.Pause()
+				}
+			} else {
+				i := m.intScripts[tile.index]
+				if i.Status == StatusPaused {
+					i.Resume()
+				} else {
+					i.Pause()
+				}
+			}
+			return m, nil
+		}
+		if ctrlKey == "x" || (keys.Abort != "" && keys.Abort == ctrlKey) {
+			if tile.isBackground {
+				m.bgScripts[tile.index].Abort()
+			} else {
+				m.intScripts[tile.index].Abort()
+			}
+			return m, nil
+		}
+	}
+
 	// Фокусировка по ctrl+<focus>
 	if ctrlKey != "" {
 		for idx, tile := range m.outputTiles {
@@ -770,7 +1308,7 @@ func handleKeyMsg(m model, msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 }
 
 // ================= buildOutputTiles =================
-// Для скриптов со статусом PASSED и FAILED плитки всегда добавляются
+// Для скриптов со статусом PASSED, FAILED и ABORTED плитки всегда добавляются
 func buildOutputTiles(bgs []*BgScript, ints []*IntScript) []outputTile {
 	var tiles []outputTile
 	// Добавляем интерактивные скрипты, если Output == true
@@ -780,9 +1318,9 @@ func buildOutputTiles(bgs []*BgScript, ints []*IntScript) []outputTile {
 	for i, s := range ints {
 		if s.Output {
 			switch s.Status {
-			case StatusRunning:
+			case StatusRunning, StatusPaused:
 				tiles = append(tiles, outputTile{isBackground: false, index: i})
-			case StatusFailed, StatusPassed:
+			case StatusFailed, StatusPassed, StatusAborted:
 				tiles = append(tiles, outputTile{isBackground: false, index: i})
 			}
 		}
@@ -792,9 +1330,9 @@ func buildOutputTiles(bgs []*BgScript, ints []*IntScript) []outputTile {
 	for i, s := range bgs {
 		if s.Output {
 			switch s.Status {
-			case StatusRunning:
+			case StatusRunning, StatusPaused:
 				tiles = append(tiles, outputTile{isBackground: true, index: i})
-			case StatusFailed, StatusPassed:
+			case StatusFailed, StatusPassed, StatusAborted:
 				tiles = append(tiles, outputTile{isBackground: true, index: i})
 			}
 		}
@@ -811,6 +1349,15 @@ func (m model) View() string {
 	if m.mode == modeFinal {
 		return renderFinalScreen(m)
 	}
+	if m.mode == modeOperator {
+		return renderOperatorScreen(m)
+	}
+	if m.mode == modeUnit {
+		return renderUnitScreen(m)
+	}
+	if m.mode == modeFilter {
+		return renderFilterScreen(m)
+	}
 	return renderMainScreen(m)
 }
 
@@ -848,10 +1395,14 @@ func renderLeftPanel(m model) string {
 	title := asciiBannerMain()
 	passed := renderCollapsedByStatus(m, StatusPassed, "PASSED (Collapsed)", passedStyle)
 	failed := renderCollapsedByStatus(m, StatusFailed, "FAILED (Collapsed)", failedStyle)
+	aborted := renderCollapsedByStatus(m, StatusAborted, "ABORTED (Collapsed)", abortedStyle)
+	paused := renderCollapsedByStatus(m, StatusPaused, "PAUSED", pausedStyle)
 	running := renderRunningList(m)
 	hint := footerStyle.Render("\nPress [ctrl+q] or [ESC] to quit | Press [ctrl+r] to restart ALL tests\n" +
 		"Press [ctrl+←]/[ctrl+→] to navigate between terminals\n" +
-		"Press [ctrl+e] or [ctrl+<restart>] to restart focused test\n")
+		"Press [ctrl+e] or [ctrl+<restart>] to restart focused test\n" +
+		"Press [ctrl+p] to pause/resume, [ctrl+x] to abort focused test\n" +
+		"Press [ctrl+o] to change operator\n")
 	// Новый стиль для подсказки custom keys
 	customText := aggregateCustomKeys(m)
 	customAll := ""
@@ -865,12 +1416,21 @@ func renderLeftPanel(m model) string {
 
 	return strings.Join([]string{
 		title,
+		identityLine(),
+		unitLine(),
+		filterLine(),
+		soakLine(),
+		reloadBanner(m),
+		configWarningsBanner(m),
 		"",
 		passed,
 		failed,
+		aborted,
+		paused,
 		running,
 		hint,
 		customAll,
+		focusedHelp(m),
 	}, "\n")
 }
 
@@ -879,6 +1439,7 @@ var (
 	runningColor = lipgloss.Color("220")
 	failedColor  = lipgloss.Color("196")
 	passedColor  = lipgloss.Color("42")
+	abortedColor = lipgloss.Color("208")
 	waitColor    = lipgloss.Color("244")
 	focusColor   = lipgloss.Color("51")
 
@@ -886,6 +1447,9 @@ var (
 	passedStyle = lipgloss.NewStyle().Foreground(passedColor).Bold(true)
 	focusStyle  = lipgloss.NewStyle().Foreground(focusColor).Bold(true)
 
+	abortedStyle = lipgloss.NewStyle().Foreground(abortedColor).Bold(true)
+	pausedStyle  = lipgloss.NewStyle().Foreground(runningColor)
+
 	footerStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("244"))
 	bannerStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("51"))
 )
@@ -1082,57 +1646,6 @@ func renderRow(row []tileBlock) string {
 	return strings.Join(combined, "\n")
 }
 
-// ================= FINAL SCREEN =================
-func renderFinalScreen(m model) string {
-	clear := "\033[2J\033[H"
-	banner := asciiBannerFinal()
-	head := finalTableHeader()
-	bgRows := finalRowsBg(m.bgScripts)
-	intRows := finalRowsInt(m.intScripts)
-	body := strings.Join(append(bgRows, intRows...), "\n")
-	foot := finalTableFooter()
-	info := fmt.Sprintf("\nPress [ctrl+q] or [ESC] to quit (exitCode=%d) | Press [ctrl+r] to restart ALL tests\n", m.exitCode)
-	return clear + strings.Join([]string{banner, "", head, body, foot, info}, "\n")
-}
-
-func finalTableHeader() string {
-	return `=======================================================
- SCRIPT                | STATUS     | TIME     
-=======================================================`
-}
-
-func finalTableFooter() string {
-	return "======================================================="
-}
-
-func finalRowsBg(bgs []*BgScript) []string {
-	sort.Slice(bgs, func(i, j int) bool {
-		return bgs[i].Duration < bgs[j].Duration
-	})
-	var out []string
-	for _, b := range bgs {
-		name := padRight(b.Path, 22)
-		statusStr := padRight(statusColorByCode(b.Code), 10)
-		tm := fmt.Sprintf("%v", b.Duration.Truncate(100*time.Millisecond))
-		out = append(out, fmt.Sprintf(" %s | %s | %s", name, statusStr, tm))
-	}
-	return out
-}
-
-func finalRowsInt(ints []*IntScript) []string {
-	sort.Slice(ints, func(i, j int) bool {
-		return ints[i].Duration < ints[j].Duration
-	})
-	var out []string
-	for _, i := range ints {
-		name := padRight(i.Path, 22)
-		statusStr := padRight(statusColorByCode(i.Code), 10)
-		tm := fmt.Sprintf("%v", i.Duration.Truncate(100*time.Millisecond))
-		out = append(out, fmt.Sprintf(" %s | %s | %s", name, statusStr, tm))
-	}
-	return out
-}
-
 func statusColorByCode(code int) string {
 	if code == 0 {
 		return passedStyle.Render("[PASSED]")
@@ -1140,6 +1653,14 @@ func statusColorByCode(code int) string {
 	return failedStyle.Render(fmt.Sprintf("[FAILED=%d]", code))
 }
 
+// statusColor учитывает статусы, которые не выражаются кодом возврата
+func statusColor(st ScriptStatus, code int) string {
+	if st == StatusAborted {
+		return abortedStyle.Render("[ABORTED]")
+	}
+	return statusColorByCode(code)
+}
+
 func asciiBannerMain() string {
 	return bannerStyle.Render(strings.Join([]string{
 		"  __ _               _             _            ",
@@ -1208,6 +1729,18 @@ func columnizeCheckBoxes(prefix string, names []string, maxPerCol int, style lip
 	return strings.Join(lines, "\n")
 }
 
+// tileTitle – заголовок плитки: [SELECTED] и [PAUSED] не затирают друг друга
+func tileTitle(path string, paused, selected bool) string {
+	title := path
+	if paused {
+		title = "[PAUSED] " + title
+	}
+	if selected {
+		title = "[SELECTED] " + title
+	}
+	return title
+}
+
 func padRight(s string, width int) string {
 	n := lipgloss.Width(s)
 	if n >= width {
@@ -1218,12 +1751,12 @@ func padRight(s string, width int) string {
 
 func computeExitCode(bgs []*BgScript, ints []*IntScript) int {
 	for _, b := range bgs {
-		if !b.Info && b.Status == StatusFailed {
+		if !b.Info && (b.Status == StatusFailed || b.Status == StatusAborted) {
 			return 1
 		}
 	}
 	for _, i := range ints {
-		if !i.Info && i.Status == StatusFailed {
+		if !i.Info && (i.Status == StatusFailed || i.Status == StatusAborted) {
 			return 1
 		}
 	}
@@ -1232,12 +1765,12 @@ func computeExitCode(bgs []*BgScript, ints []*IntScript) int {
 
 func allScriptsDone(bgs []*BgScript, ints []*IntScript) bool {
 	for _, b := range bgs {
-		if !b.Info && (b.Status == StatusWaiting || b.Status == StatusRunning) {
+		if !b.Info && (b.Status == StatusWaiting || b.Status == StatusRunning || b.Status == StatusPaused) {
 			return false
 		}
 	}
 	for _, i := range ints {
-		if !i.Info && (i.Status == StatusWaiting || i.Status == StatusRunning) {
+		if !i.Info && (i.Status == StatusWaiting || i.Status == StatusRunning || i.Status == StatusPaused) {
 			return false
 		}
 	}
@@ -1345,99 +1878,169 @@ func clamp(val, min, max int) int {
 var prog *tea.Program
 
 func main() {
-	cfg, err := loadConfig("config.json")
+	// crycaller запущен посредником для теста с nice/ionice/cpu_affinity
+	if spec, ok := os.LookupEnv(schedEnv); ok {
+		execScheduled(spec)
+	}
+	resumeFlag := flag.Bool("resume", false, "Resume the interrupted run from the journal without asking")
+	operatorFlag := flag.String("operator", "", "Operator badge/ID (skips the login screen)")
+	checkFlag := flag.Bool("check", false, "Validate test args in config.json against test manifests and exit")
+	skeletonFlag := flag.String("skeleton", "", "Print a config.json entry for the given test binary (uses its --describe manifest) and exit")
+	profileFlag := flag.String("profile", "", "Run tests from profiles/<name>.json instead of config.json")
+	onlyFlag := flag.String("only", "", "Run only tests with any of these tags (comma-separated)")
+	skipFlag := flag.String("skip", "", "Skip tests with any of these tags (comma-separated)")
+	testFlag := flag.String("test", "", "Run only the named tests: path, file name or name without extension (comma-separated)")
+	pickFlag := flag.Bool("pick", false, "Choose tags on a picker screen before the run")
+	cyclesFlag := flag.Int("cycles", 0, "Soak mode: repeat the tests N times")
+	durationFlag := flag.Duration("duration", 0, "Soak mode: keep starting new cycles until this time has passed (e.g. 8h)")
+	keepGoingFlag := flag.Bool("keep-going", false, "Soak mode: continue after a failed cycle instead of stopping")
+	flag.Parse()
+
+	// crycaller edit [profile] – редактор профилей
+	if flag.Arg(0) == "edit" {
+		if err := runEditor(flag.Args()[1:]); err != nil {
+			log.Printf("Editor error: %v", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if *skeletonFlag != "" {
+		if err := printSkeleton(*skeletonFlag); err != nil {
+			log.Printf("Skeleton error: %v", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	configPath := "config.json"
+	loadFn := func() (*Config, error) { return loadConfig(configPath) }
+	if *profileFlag != "" {
+		configPath = profilePath(*profileFlag)
+		loadFn = func() (*Config, error) {
+			p, err := loadProfile(*profileFlag)
+			if err != nil {
+				return nil, err
+			}
+			return p.config(), nil
+		}
+	}
+	cfg, err := loadFn()
 	if err != nil {
-		log.Printf("Error reading config.json: %v", err)
+		log.Printf("Error reading %s: %v", configPath, err)
 		os.Exit(1)
 	}
 	if cfg == nil {
-		log.Println("config.json is empty or invalid")
+		log.Printf("%s is empty or invalid", configPath)
 		os.Exit(1)
 	}
 	globalConfig = cfg
+	identity.SetStation(cfg.StationID)
 
 	// Логи
-	fBare, err := os.OpenFile("bare_log.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
-	if err != nil {
-		log.Fatalf("Error opening bare_log.log: %v", err)
+	if err := openLogs(); err != nil {
+		log.Fatalf("Error opening logs: %v", err)
 	}
-	bareLog = log.New(fBare, "", log.LstdFlags)
 
-	fDebug, err := os.OpenFile("debug_log.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
-	if err != nil {
-		log.Fatalf("Error opening debug_log.log: %v", err)
+	// Проверка args по манифестам тестов (заодно манифесты попадают в кэш для подсказок)
+	configWarnings := validateConfig(cfg)
+	if *checkFlag {
+		for _, p := range configWarnings {
+			fmt.Println(p)
+		}
+		if len(configWarnings) > 0 {
+			os.Exit(1)
+		}
+		fmt.Printf("%s OK\n", configPath)
+		os.Exit(0)
+	}
+	for _, p := range configWarnings {
+		bareLog.Printf("Config problem: %s", p)
 	}
-	debugLog = log.New(fDebug, "DEBUG: ", log.LstdFlags)
 
 	width, height := 80, 24
 
 	// Инициализируем массивы скриптов
 	var bgScripts []*BgScript
 	for i, sc := range cfg.BackgroundScripts {
-		maxLogs := sc.MaxLogs
-		if maxLogs <= 0 {
-			maxLogs = 5
-		}
-		isCurses := strings.Contains(strings.ToLower(sc.Type), "curses")
-		h, w, err := parseOutputRes(sc.OutputRes, isCurses)
-		if err != nil {
-			bareLog.Printf("Config error for %s: %v, using defaults", sc.Path, err)
-			h, w = 10, 40
-		}
-		parts := strings.Split(sc.Type, ",")
-		baseType := strings.TrimSpace(parts[0])
-		infoFlag := len(parts) > 1 && strings.TrimSpace(parts[1]) == "info"
-		bgScripts = append(bgScripts, &BgScript{
-			Path:        sc.Path,
-			Args:        sc.Args,
-			Type:        baseType,
-			Info:        infoFlag,
-			Status:      StatusWaiting,
-			Code:        -1,
-			RawLog:      []string{},
-			MaxLogs:     maxLogs,
-			Output:      sc.Output,
-			OutHeight:   h,
-			OutWidth:    w,
-			OutputRes:   sc.OutputRes,
-			Keys:        sc.Keys,
-			ConfigIndex: i,
-		})
+		bgScripts = append(bgScripts, newBgScript(sc, i))
 	}
 
 	var intScripts []*IntScript
 	for i, sc := range cfg.InteractiveScripts {
-		maxLogs := sc.MaxLogs
-		if maxLogs <= 0 {
-			maxLogs = 5
+		intScripts = append(intScripts, newIntScript(sc, i))
+	}
+
+	// Таблица правил идентификации изделия (общая с serial_to_uefi)
+	if cfg.AskUnit {
+		rulesPath := cfg.UnitRules
+		if rulesPath == "" {
+			rulesPath = unitrules.DefaultFile
 		}
-		isCurses := strings.Contains(strings.ToLower(sc.Type), "curses")
-		h, w, err := parseOutputRes(sc.OutputRes, isCurses)
+		unitRules, err = unitrules.LoadOrDefault(rulesPath)
 		if err != nil {
-			bareLog.Printf("Config error for %s: %v, using defaults", sc.Path, err)
-			h, w = 10, 40
-		}
-		parts := strings.Split(sc.Type, ",")
-		baseType := strings.TrimSpace(parts[0])
-		infoFlag := len(parts) > 1 && strings.TrimSpace(parts[1]) == "info"
-		intScripts = append(intScripts, &IntScript{
-			Path:        sc.Path,
-			Args:        sc.Args,
-			Type:        baseType,
-			Info:        infoFlag,
-			Status:      StatusWaiting,
-			Code:        -1,
-			RawLog:      []string{},
-			MaxLogs:     maxLogs,
-			Output:      sc.Output,
-			OutHeight:   h,
-			OutWidth:    w,
-			OutputRes:   sc.OutputRes,
-			Keys:        sc.Keys,
-			ConfigIndex: i,
-		})
+			log.Printf("Error reading %s: %v", rulesPath, err)
+			os.Exit(1)
+		}
+	}
+
+	// Журнал прогона: продолжаем прерванную сессию или начинаем новую
+	if j, err := loadJournal(journalFile); err == nil && j.Stage != stageFinished {
+		if *resumeFlag || (isatty.IsTerminal(os.Stdin.Fd()) && askResume(j)) {
+			runJournal = j
+			runJournal.setStage(stageRunning)
+			if j.Soak != nil && len(j.Soak.Cycles) > 0 {
+				// Soak-прогон после первого цикла: тесты с reboot_required уже не повторяются
+				bgScripts, intScripts = soakScripts()
+			}
+			applyJournal(runJournal, bgScripts, intScripts)
+			if runJournal.Operator != "" {
+				identity.SetOperator(runJournal.Operator)
+			}
+			restoreUnit(runJournal.Product, runJournal.Unit)
+			bareLog.Printf("Resuming session %s", runJournal.SessionID)
+		}
+	}
+	if runJournal == nil {
+		runJournal = newJournal(journalFile)
+		runJournal.setStage(stageRunning)
 	}
 
+	// Фильтр по тегам/именам: флаги, иначе фильтр продолжаемой сессии
+	runFilter = RunFilter{Only: splitList(*onlyFlag), Skip: splitList(*skipFlag), Tests: splitList(*testFlag)}
+	if !runFilter.Active() && runJournal.Filter != nil {
+		runFilter = *runJournal.Filter
+	}
+	filterPicked := runFilter.Active() || runJournal.Filter != nil
+	if runFilter.Active() {
+		bgScripts, intScripts = filterScripts(runFilter, bgScripts, intScripts)
+		if len(bgScripts)+len(intScripts) == 0 {
+			log.Printf("No tests match filter %q", runFilter.String())
+			os.Exit(1)
+		}
+		runJournal.setFilter(runFilter)
+		bareLog.Printf("Filter: %s", runFilter.String())
+	}
+	if *pickFlag {
+		cfg.AskFilter = true
+	}
+	// Soak-прогон продолжаемой сессии важнее флагов
+	if runJournal.Soak != nil {
+		soak = runJournal.Soak.snapshot()
+		bareLog.Printf("Resuming soak run at cycle %d", len(soak.Cycles)+1)
+	} else {
+		soak = newSoakRun(*cyclesFlag, *durationFlag, *keepGoingFlag)
+		runJournal.setSoak(soak)
+	}
+	disarmAutostart()
+	if *operatorFlag != "" {
+		identity.SetOperator(*operatorFlag)
+	}
+	if identity.Operator() != "" {
+		runJournal.setOperator(identity.Operator(), identity.Station())
+	}
+	stampLogs()
+
 	// Модель Bubble Tea
 	m := model{
 		bgScripts:       bgScripts,
@@ -1448,134 +2051,156 @@ func main() {
 		height:          height,
 		outputTiles:     []outputTile{},
 		selectedTileIdx: 0,
+		rebootStage:     hasWaitingReboot(bgScripts, intScripts),
+		unitValues:      map[string]string{},
+		finalSelected:   map[string]bool{},
+		configWarnings:  configWarnings,
+		filterState:     map[string]int{},
+		filterPicked:    filterPicked,
+	}
+	if cfg.AskUnit && !unit.Known() {
+		if cfg.Product != "" {
+			if p, ok := unitRules.Product(cfg.Product); ok {
+				m.unitProduct = p
+			} else {
+				m.unitMsg = fmt.Sprintf("Product %q is not in the rule table", cfg.Product)
+			}
+		} else if p, name := detectProduct(); p != nil {
+			m.unitProduct = p
+		} else if name != "" {
+			m.unitMsg = fmt.Sprintf("Product %q is not in the rule table", name)
+		}
 	}
 
+	// Стартовый экран выбирается до создания программы: tea.NewProgram копирует модель,
+	// тесты запускаются из Init
+	m = beginRun(m)
+
 	// Запуск Bubble Tea
 	var opts []tea.ProgramOption
 	if isatty.IsTerminal(os.Stdin.Fd()) {
 		opts = append(opts, tea.WithAltScreen())
 	}
+	// Сигналы обрабатываем сами, чтобы перед выходом убрать процессы тестов
+	opts = append(opts, tea.WithoutSignalHandler())
 	prog = tea.NewProgram(m, opts...)
+	handleSignals()
+	if err := watchConfig(configPath, loadFn); err != nil {
+		bareLog.Printf("Config watch disabled: %v", err)
+	}
 
 	go func() {
-		if _, err := prog.Run(); err != nil {
+		final, err := prog.Run()
+		if err != nil {
 			log.Printf("BubbleTea error: %v", err)
 		}
+		shutdownTests()
+		if code := signalExitCode.Load(); code != 0 {
+			os.Exit(int(code))
+		}
+		if fm, ok := final.(model); ok {
+			if fm.rebooting {
+				fmt.Printf("Rebooting to continue session %s...\n", runJournal.SessionID)
+				if err := rebootSystem(); err != nil {
+					log.Printf("Reboot failed: %v", err)
+					os.Exit(1)
+				}
+			}
+			os.Exit(fm.exitCode)
+		}
 		os.Exit(m.exitCode)
 	}()
 
-	// Запускаем все скрипты
-	notifyFn := func() {
-		if allScriptsDone(m.bgScripts, m.intScripts) {
-			prog.Send(doneAllMsg{})
-		} else {
-			prog.Send(refreshMsg{})
-		}
-	}
-
-	var wgAll sync.WaitGroup
-	for _, b := range m.bgScripts {
-		wgAll.Add(1)
-		go b.Start(&wgAll, notifyFn)
-	}
-	for _, i := range m.intScripts {
-		wgAll.Add(1)
-		go i.Start(&wgAll, notifyFn)
-	}
-
 	// Блокируемся
 	select {}
 }
 
 // ================= RESTART TESTS (ALL) =================
 func restartTests(m *model) {
+	for _, b := range m.bgScripts {
+		b.Stop()
+	}
+	for _, i := range m.intScripts {
+		i.Stop()
+	}
 	newBg := []*BgScript{}
 	for i, sc := range globalConfig.BackgroundScripts {
-		maxLogs := sc.MaxLogs
-		if maxLogs <= 0 {
-			maxLogs = 5
-		}
-		isCurses := strings.Contains(strings.ToLower(sc.Type), "curses")
-		h, w, err := parseOutputRes(sc.OutputRes, isCurses)
-		if err != nil {
-			bareLog.Printf("Config error for %s: %v, using defaults", sc.Path, err)
-			h, w = 10, 40
-		}
-		parts := strings.Split(sc.Type, ",")
-		baseType := strings.TrimSpace(parts[0])
-		infoFlag := len(parts) > 1 && strings.TrimSpace(parts[1]) == "info"
-		newBg = append(newBg, &BgScript{
-			Path:        sc.Path,
-			Args:        sc.Args,
-			Type:        baseType,
-			Info:        infoFlag,
-			Status:      StatusWaiting,
-			Code:        -1,
-			RawLog:      []string{},
-			MaxLogs:     maxLogs,
-			Output:      sc.Output,
-			OutHeight:   h,
-			OutWidth:    w,
-			OutputRes:   sc.OutputRes,
-			Keys:        sc.Keys,
-			ConfigIndex: i,
-		})
+		newBg = append(newBg, newBgScript(sc, i))
 	}
 	newInt := []*IntScript{}
 	for i, sc := range globalConfig.InteractiveScripts {
-		maxLogs := sc.MaxLogs
-		if maxLogs <= 0 {
-			maxLogs = 5
-		}
-		isCurses := strings.Contains(strings.ToLower(sc.Type), "curses")
-		h, w, err := parseOutputRes(sc.OutputRes, isCurses)
-		if err != nil {
-			bareLog.Printf("Config error for %s: %v, using defaults", sc.Path, err)
-			h, w = 10, 40
-		}
-		parts := strings.Split(sc.Type, ",")
-		baseType := strings.TrimSpace(parts[0])
-		infoFlag := len(parts) > 1 && strings.TrimSpace(parts[1]) == "info"
-		newInt = append(newInt, &IntScript{
-			Path:        sc.Path,
-			Args:        sc.Args,
-			Type:        baseType,
-			Info:        infoFlag,
-			Status:      StatusWaiting,
-			Code:        -1,
-			RawLog:      []string{},
-			MaxLogs:     maxLogs,
-			Output:      sc.Output,
-			OutHeight:   h,
-			OutWidth:    w,
-			OutputRes:   sc.OutputRes,
-			Keys:        sc.Keys,
-			ConfigIndex: i,
-		})
+		newInt = append(newInt, newIntScript(sc, i))
 	}
-	m.bgScripts = newBg
-	m.intScripts = newInt
+	m.bgScripts, m.intScripts = filterScripts(runFilter, newBg, newInt)
 	m.mode = modeMain
 	m.exitCode = 0
 	m.outputTiles = []outputTile{}
 	m.selectedTileIdx = 0
+	m.finalIdx = 0
+	m.logView = false
+	m.finalSelected = map[string]bool{}
+	m.reloadQueued = nil
+	identity.SetStation(globalConfig.StationID)
+	stampLogs()
+	if soak != nil {
+		// Полный рестарт начинает soak-прогон заново
+		soak = newSoakRun(soak.MaxCycles, soak.Duration, !soak.StopOnFail)
+	}
 
-	var wgAll sync.WaitGroup
-	notifyFn := func() {
-		if allScriptsDone(m.bgScripts, m.intScripts) {
+	// Полный рестарт – это новая сессия
+	runJournal = newJournal(journalFile)
+	runJournal.setStage(stageRunning)
+	runJournal.setSoak(soak)
+	if identity.Operator() != "" {
+		runJournal.setOperator(identity.Operator(), identity.Station())
+	}
+	if unit.Known() {
+		runJournal.setUnit(unit.Product(), unit.Values())
+	}
+	if runFilter.Active() {
+		runJournal.setFilter(runFilter)
+	}
+	m.rebootStage = hasWaitingReboot(m.bgScripts, m.intScripts)
+
+	launchScripts(m.bgScripts, m.intScripts, notifyFor(m.bgScripts, m.intScripts))
+}
+
+// notifyFor возвращает функцию, которой тесты сообщают UI об изменениях
+func notifyFor(bgs []*BgScript, ints []*IntScript) func() {
+	return func() {
+		if allScriptsDone(bgs, ints) {
 			prog.Send(doneAllMsg{})
+		} else if rebootStageDone(bgs, ints) {
+			prog.Send(rebootStageMsg{})
 		} else {
 			prog.Send(refreshMsg{})
 		}
 	}
-	for _, b := range m.bgScripts {
+}
+
+// launchScripts запускает все ожидающие тесты. Если среди них есть тесты
+// с reboot_required, сначала запускаются только они.
+func launchScripts(bgs []*BgScript, ints []*IntScript, notifyFn func()) {
+	rebootOnly := hasWaitingReboot(bgs, ints)
+	var wgAll sync.WaitGroup
+	for _, b := range bgs {
+		if b.Status != StatusWaiting || (rebootOnly && !b.RebootRequired) {
+			continue
+		}
 		wgAll.Add(1)
 		go b.Start(&wgAll, notifyFn)
 	}
-	for _, i := range m.intScripts {
+	for _, i := range ints {
+		if i.Status != StatusWaiting || (rebootOnly && !i.RebootRequired) {
+			continue
+		}
 		wgAll.Add(1)
 		go i.Start(&wgAll, notifyFn)
 	}
+	if !rebootOnly && allScriptsDone(bgs, ints) {
+		// Например, при продолжении сессии все тесты уже пройдены
+		go notifyFn()
+	}
 }
 
 func loadConfig(fname string) (*Config, error) {
@@ -1698,7 +2323,7 @@ func renderOutputPanel(m model) string {
 		if bg, ok := script.(*BgScript); ok {
 			path = bg.Path
 			isCurses = strings.Contains(strings.ToLower(bg.Type), "curses")
-			if bg.Status != StatusRunning {
+			if bg.Status != StatusRunning && bg.Status != StatusPaused {
 				if time.Since(bg.FinishedAt) < 3*time.Second {
 					if isCurses && bg.vtBuffer != nil {
 						content = bg.vtBuffer.RenderVisible()
@@ -1722,7 +2347,7 @@ func renderOutputPanel(m model) string {
 		} else if in, ok := script.(*IntScript); ok {
 			path = in.Path
 			isCurses = strings.Contains(strings.ToLower(in.Type), "curses")
-			if in.Status != StatusRunning {
+			if in.Status != StatusRunning && in.Status != StatusPaused {
 				if time.Since(in.FinishedAt) < 3*time.Second {
 					if isCurses && in.vtBuffer != nil {
 						content = in.vtBuffer.RenderVisible()
@@ -1745,10 +2370,9 @@ func renderOutputPanel(m model) string {
 			outWidth = in.OutWidth
 		}
 
-		title := path
-		if idx == m.selectedTileIdx {
-			title = fmt.Sprintf("[SELECTED] %s", path)
-		}
+		paused := (tile.isBackground && m.bgScripts[tile.index].Status == StatusPaused) ||
+			(!tile.isBackground && m.intScripts[tile.index].Status == StatusPaused)
+		title := tileTitle(path, paused, idx == m.selectedTileIdx)
 
 		// Базовая ширина для плитки
 		tileWidth := availableWidth / 2
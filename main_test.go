@@ -0,0 +1,119 @@
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestTileTitle(t *testing.T) {
+	for _, c := range []struct {
+		paused, selected bool
+		want             string
+	}{
+		{false, false, "./mic_test"},
+		{true, false, "[PAUSED] ./mic_test"},
+		{false, true, "[SELECTED] ./mic_test"},
+		{true, true, "[SELECTED] [PAUSED] ./mic_test"},
+	} {
+		if got := tileTitle("./mic_test", c.paused, c.selected); got != c.want {
+			t.Errorf("tileTitle(paused %v, selected %v) = %q, want %q", c.paused, c.selected, got, c.want)
+		}
+	}
+}
+
+func TestOpenLogs(t *testing.T) {
+	wd, _ := os.Getwd()
+	dir := t.TempDir()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	oldID, oldBare, oldDebug := identity, bareLog, debugLog
+	t.Cleanup(func() {
+		for _, f := range logFiles {
+			f.Close()
+		}
+		logFiles, logStamp = nil, ""
+		identity, bareLog, debugLog = oldID, oldBare, oldDebug
+		os.Chdir(wd)
+	})
+	identity, bareLog, debugLog = &Identity{}, nil, nil
+
+	identity.SetStation("line 2")
+	if err := openLogs(); err != nil {
+		t.Fatal(err)
+	}
+	bareLog.Printf("before login")
+	identity.SetOperator("op/7")
+	stampLogs()
+	bareLog.Printf("after login")
+	debugLog.Printf("debug")
+
+	for name, want := range map[string]string{
+		"bare_log_line-2.log":       "before login",
+		"bare_log_line-2_op-7.log":  "after login",
+		"debug_log_line-2_op-7.log": "DEBUG: ",
+	} {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), want) || strings.Count(string(data), "\n") != 1 {
+			t.Errorf("%s = %q, want one line with %q", name, data, want)
+		}
+	}
+}
+
+func TestTimeoutPaused(t *testing.T) {
+	oldLog := bareLog
+	t.Cleanup(func() { bareLog = oldLog })
+	bareLog = log.New(io.Discard, "", 0)
+
+	b := newBgScript(ScriptConfig{Path: "sleep", Args: "0.3", Type: "binary", Timeout: "500ms"}, 0)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go b.Start(&wg, func() {})
+	for b.cmd == nil || b.cmd.Process == nil {
+		time.Sleep(10 * time.Millisecond)
+	}
+	// The pause is longer than the timeout but must not count against it
+	b.Pause()
+	time.Sleep(700 * time.Millisecond)
+	b.Resume()
+	wg.Wait()
+	if b.Status != StatusPassed || b.Reason != "" {
+		t.Errorf("status %v, reason %q, want passed", b.Status, b.Reason)
+	}
+	if b.PausedTotal < 700*time.Millisecond || b.Duration > 500*time.Millisecond {
+		t.Errorf("paused %v, duration %v", b.PausedTotal, b.Duration)
+	}
+}
+
+func TestKilledWhilePaused(t *testing.T) {
+	oldLog := bareLog
+	t.Cleanup(func() { bareLog = oldLog })
+	bareLog = log.New(io.Discard, "", 0)
+
+	b := newBgScript(ScriptConfig{Path: "sleep", Args: "10", Type: "binary"}, 0)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go b.Start(&wg, func() {})
+	for b.cmd == nil || b.cmd.Process == nil {
+		time.Sleep(10 * time.Millisecond)
+	}
+	b.Pause()
+	time.Sleep(300 * time.Millisecond)
+	// Killed from outside while stopped
+	if err := syscall.Kill(b.cmd.Process.Pid, syscall.SIGKILL); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+	if b.PausedTotal < 300*time.Millisecond || b.Duration > 200*time.Millisecond {
+		t.Errorf("paused %v, duration %v", b.PausedTotal, b.Duration)
+	}
+}
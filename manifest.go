@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"crycaller/describe"
+)
+
+// ================= TEST MANIFESTS =================
+// Тестовые бинарники (video_test, mic_test, usb_test, cam_test) по флагу
+// --describe печатают JSON-манифест: параметры, значения по умолчанию,
+// клавиши, коды возврата и признак curses. crycaller использует его для
+// проверки args, генерации заготовки конфига (-skeleton) и подсказки в TUI.
+// Запуск с --describe выполняется только для тестов с "describe": true –
+// бинарник без поддержки флага мог бы просто начать тест.
+
+const describeTimeout = 5 * time.Second
+
+var (
+	manifestMutex sync.Mutex
+	manifests     = map[string]*describe.Manifest{}
+)
+
+// describeBinary запускает path --describe и разбирает манифест
+func describeBinary(path string) (*describe.Manifest, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), describeTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, path, "--describe").Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s --describe: %v", path, err)
+	}
+	var m describe.Manifest
+	if err := json.Unmarshal(out, &m); err != nil {
+		return nil, fmt.Errorf("%s --describe: invalid manifest: %v", path, err)
+	}
+	return &m, nil
+}
+
+// loadManifest возвращает манифест из кэша или запрашивает его у бинарника
+func loadManifest(path string) (*describe.Manifest, error) {
+	manifestMutex.Lock()
+	m, ok := manifests[path]
+	manifestMutex.Unlock()
+	if ok {
+		return m, nil
+	}
+	m, err := describeBinary(path)
+	if err != nil {
+		return nil, err
+	}
+	manifestMutex.Lock()
+	manifests[path] = m
+	manifestMutex.Unlock()
+	return m, nil
+}
+
+// cachedManifest не запускает процессов – для использования из View
+func cachedManifest(path string) *describe.Manifest {
+	manifestMutex.Lock()
+	defer manifestMutex.Unlock()
+	return manifests[path]
+}
+
+// manifestParam ищет параметр по имени флага без дефисов
+func manifestParam(m *describe.Manifest, name string) (describe.Param, bool) {
+	for _, p := range m.Params {
+		if strings.TrimLeft(p.Flag, "-") == name {
+			return p, true
+		}
+	}
+	return describe.Param{}, false
+}
+
+// validateArgs проверяет args по правилам пакета flag: -x, --x, -x=v,
+// небулевы флаги забирают следующий аргумент
+func validateArgs(m *describe.Manifest, args string) []string {
+	var problems []string
+	tokens := parseArgs(args)
+	for idx := 0; idx < len(tokens); idx++ {
+		tok := tokens[idx]
+		if tok == "--" {
+			break
+		}
+		if !strings.HasPrefix(tok, "-") || tok == "-" {
+			problems = append(problems, fmt.Sprintf("unexpected argument %q", tok))
+			continue
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(tok, "-"), "=")
+		p, ok := manifestParam(m, name)
+		if !ok {
+			problems = append(problems, fmt.Sprintf("unknown flag -%s", name))
+			continue
+		}
+		if p.Type == "bool" {
+			if hasValue {
+				if _, err := strconv.ParseBool(value); err != nil {
+					problems = append(problems, fmt.Sprintf("-%s expects true/false, got %q", name, value))
+				}
+			}
+			continue
+		}
+		if !hasValue {
+			if idx+1 >= len(tokens) {
+				problems = append(problems, fmt.Sprintf("-%s needs a %s value", name, p.Type))
+				continue
+			}
+			idx++
+			value = tokens[idx]
+		}
+		if err := checkParamValue(p.Type, value); err != nil {
+			problems = append(problems, fmt.Sprintf("-%s: %v", name, err))
+		}
+	}
+	return problems
+}
+
+func checkParamValue(typ, value string) error {
+	var err error
+	switch typ {
+	case "int", "int64":
+		_, err = strconv.ParseInt(value, 0, 64)
+	case "uint", "uint64":
+		_, err = strconv.ParseUint(value, 0, 64)
+	case "float64":
+		_, err = strconv.ParseFloat(value, 64)
+	case "duration":
+		_, err = time.ParseDuration(value)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %s %q", typ, value)
+	}
+	return nil
+}
+
+// validateConfig проверяет args всех тестов с describe и возвращает список проблем
+func validateConfig(cfg *Config) []string {
+	var problems []string
+	check := func(kind string, scs []ScriptConfig) {
+		for _, sc := range scs {
+			// timeout действует только на процесс теста, у встроенных проверок свои таймауты
+			if sc.Timeout != "" {
+				if strings.TrimSpace(strings.Split(sc.Type, ",")[0]) == "builtin" {
+					problems = append(problems, fmt.Sprintf("%s %s: timeout is not supported for builtin checks", kind, scriptPath(sc)))
+				} else if _, err := time.ParseDuration(sc.Timeout); err != nil {
+					problems = append(problems, fmt.Sprintf("%s %s: invalid timeout %q", kind, sc.Path, sc.Timeout))
+				}
+			}
+			if !sc.Describe {
+				continue
+			}
+			m, err := loadManifest(sc.Path)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s %s: %v", kind, sc.Path, err))
+				continue
+			}
+			for _, p := range validateArgs(m, sc.Args) {
+				problems = append(problems, fmt.Sprintf("%s %s: %s", kind, sc.Path, p))
+			}
+			curses := strings.Contains(strings.ToLower(sc.Type), "curses")
+			if m.Curses != curses {
+				problems = append(problems, fmt.Sprintf("%s %s: manifest says curses=%v, type is %q", kind, sc.Path, m.Curses, sc.Type))
+			}
+		}
+	}
+	check("background", cfg.BackgroundScripts)
+	check("interactive", cfg.InteractiveScripts)
+	return problems
+}
+
+// printSkeleton печатает запись для config.json по манифесту бинарника,
+// а справку по параметрам – в stderr
+func printSkeleton(path string) error {
+	m, err := describeBinary(path)
+	if err != nil {
+		return err
+	}
+	sc := ScriptConfig{
+		Path:     path,
+		Args:     m.Example,
+		Type:     "binary",
+		Output:   true,
+		Describe: true,
+	}
+	if m.Curses {
+		sc.Type = "binary, curses"
+		sc.OutputRes = "20x80"
+	}
+	data, err := json.MarshalIndent(sc, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	fmt.Fprintln(os.Stderr, manifestUsage(m))
+	return nil
+}
+
+// manifestUsage – многострочная справка по манифесту
+func manifestUsage(m *describe.Manifest) string {
+	lines := []string{fmt.Sprintf("%s: %s", m.Name, m.Description), "Params:"}
+	for _, p := range m.Params {
+		def := ""
+		if p.Default != "" {
+			def = fmt.Sprintf(" (default %s)", p.Default)
+		}
+		lines = append(lines, fmt.Sprintf("  %-12s %-8s %s%s", p.Flag, p.Type, p.Description, def))
+	}
+	if len(m.Keys) > 0 {
+		lines = append(lines, "Keys:")
+		for _, k := range m.Keys {
+			lines = append(lines, fmt.Sprintf("  %-12s %s", k.Key, k.Description))
+		}
+	}
+	lines = append(lines, "Exit codes:")
+	for _, e := range m.ExitCodes {
+		lines = append(lines, fmt.Sprintf("  %-12d %s", e.Code, e.Meaning))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// focusedHelp – подсказка по тесту в фокусе для левой панели
+func focusedHelp(m model) string {
+	if len(m.outputTiles) == 0 || m.selectedTileIdx >= len(m.outputTiles) {
+		return ""
+	}
+	tile := m.outputTiles[m.selectedTileIdx]
+	path := ""
+	if tile.isBackground {
+		path = m.bgScripts[tile.index].Path
+	} else {
+		path = m.intScripts[tile.index].Path
+	}
+	man := cachedManifest(path)
+	if man == nil {
+		return ""
+	}
+	lines := []string{fmt.Sprintf("Help: %s – %s", man.Name, man.Description)}
+	for _, k := range man.Keys {
+		lines = append(lines, fmt.Sprintf("  [%s] %s", k.Key, k.Description))
+	}
+	var codes []string
+	for _, e := range man.ExitCodes {
+		codes = append(codes, fmt.Sprintf("%d=%s", e.Code, e.Meaning))
+	}
+	if len(codes) > 0 {
+		lines = append(lines, "  exit: "+strings.Join(codes, "; "))
+	}
+	return footerStyle.Render(strings.Join(lines, "\n"))
+}
+
+// configWarningsBanner – проблемы, найденные при проверке args по манифестам
+func configWarningsBanner(m model) string {
+	if len(m.configWarnings) == 0 {
+		return ""
+	}
+	return failedStyle.Render("Config problems:\n  " + strings.Join(m.configWarnings, "\n  "))
+}
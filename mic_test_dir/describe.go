@@ -0,0 +1,19 @@
+package main
+
+import "crycaller/describe"
+
+var describeFlag = describe.Flag()
+
+var manifest = describe.Manifest{
+	Name:        "mic_test",
+	Description: "Plays a tone through the speakers and listens for it on the microphone; asks the operator if not enough confirmations were detected",
+	Keys: []describe.Key{
+		{Key: "y/Enter", Description: "sound was audible (test passes)"},
+		{Key: "n/Esc", Description: "sound was not audible (test fails)"},
+	},
+	ExitCodes: []describe.Exit{
+		{Code: 0, Meaning: "tone detected or confirmed by the operator"},
+		{Code: 1, Meaning: "tone not detected, rejected by the operator or ALSA error"},
+	},
+	Example: "-y 3 -f 500 -t 5s",
+}
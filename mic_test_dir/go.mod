@@ -4,4 +4,9 @@ go 1.23.2
 
 require github.com/eiannone/keyboard v0.0.0-20220611211555-0d226195f203
 
-require golang.org/x/sys v0.0.0-20220520151302-bc2c85ada10a // indirect
+require (
+	crycaller v0.0.0-00010101000000-000000000000
+	golang.org/x/sys v0.30.0 // indirect
+)
+
+replace crycaller => ../
@@ -13,6 +13,8 @@ import (
 	"unsafe"
 
 	"github.com/eiannone/keyboard"
+
+	"crycaller/describe"
 )
 
 /*
@@ -289,6 +291,10 @@ func waitForUserConfirmation() bool {
 func main() {
 	flag.Parse()
 
+	if *describeFlag {
+		describe.Print(manifest)
+	}
+
 	// Устанавливаем громкость Master на 100%.
 	if err := setMasterVolume100(); err != nil {
 		log.Fatalf("Error setting volume: %v", err)
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// ================= OPERATOR & STATION IDENTITY =================
+// Оператор вводится на стартовом экране (клавиатура или сканер штрих-кодов)
+// и может смениться посреди смены по ctrl+o без перезапуска crycaller.
+// Станция берётся из station_id в config.json.
+
+type OperatorShift struct {
+	Operator string    `json:"operator"`
+	Since    time.Time `json:"since"`
+}
+
+type Identity struct {
+	mutex    sync.Mutex
+	operator string
+	station  string
+	shifts   []OperatorShift
+}
+
+var identity = &Identity{}
+
+func (id *Identity) Operator() string {
+	id.mutex.Lock()
+	defer id.mutex.Unlock()
+	return id.operator
+}
+
+func (id *Identity) Station() string {
+	id.mutex.Lock()
+	defer id.mutex.Unlock()
+	return id.station
+}
+
+func (id *Identity) SetStation(station string) {
+	id.mutex.Lock()
+	defer id.mutex.Unlock()
+	id.station = station
+}
+
+// SetOperator меняет текущего оператора и запоминает смену для отчёта
+func (id *Identity) SetOperator(operator string) {
+	id.mutex.Lock()
+	defer id.mutex.Unlock()
+	if operator == id.operator {
+		return
+	}
+	id.operator = operator
+	id.shifts = append(id.shifts, OperatorShift{Operator: operator, Since: time.Now()})
+}
+
+func (id *Identity) Shifts() []OperatorShift {
+	id.mutex.Lock()
+	defer id.mutex.Unlock()
+	return append([]OperatorShift(nil), id.shifts...)
+}
+
+// sessionEnv – переменные окружения, которые получает каждый дочерний тест
+func sessionEnv() []string {
+	env := []string{
+		"CRYCALLER_OPERATOR=" + identity.Operator(),
+		"CRYCALLER_STATION=" + identity.Station(),
+	}
+	if runJournal != nil {
+		env = append(env, "CRYCALLER_SESSION="+runJournal.SessionID)
+	}
+	return append(env, unit.Env()...)
+}
+
+// ================= OPERATOR SCREEN =================
+func handleOperatorKey(m model, msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyEnter:
+		op := strings.TrimSpace(m.operatorInput)
+		if op == "" {
+			return m, nil
+		}
+		identity.SetOperator(op)
+		runJournal.setOperator(op, identity.Station())
+		stampLogs()
+		bareLog.Printf("Operator set to %s at station %s", op, identity.Station())
+		m.operatorInput = ""
+		m.mode = m.returnMode
+		if m.pendingLaunch {
+			// Стартовый экран: тесты запускаются только после ввода оператора
+			m = beginRun(m)
+			return m, startCmd(m)
+		}
+		return m, nil
+	case tea.KeyBackspace:
+		if r := []rune(m.operatorInput); len(r) > 0 {
+			m.operatorInput = string(r[:len(r)-1])
+		}
+		return m, nil
+	case tea.KeyEsc:
+		// Отмена смены оператора; на стартовом экране – выход как обычно
+		if m.pendingLaunch || identity.Operator() == "" {
+			m.quitting = true
+			return m, tea.Quit
+		}
+		m.operatorInput = ""
+		m.mode = m.returnMode
+		return m, nil
+	case tea.KeyRunes, tea.KeySpace:
+		m.operatorInput += string(msg.Runes)
+		return m, nil
+	}
+	return m, nil
+}
+
+func renderOperatorScreen(m model) string {
+	clear := "\033[2J\033[H"
+	station := identity.Station()
+	if station == "" {
+		station = "(not set)"
+	}
+	lines := []string{
+		asciiBannerMain(),
+		"",
+		asciiSep("OPERATOR LOGIN"),
+		fmt.Sprintf("Station: %s", station),
+	}
+	if cur := identity.Operator(); cur != "" {
+		lines = append(lines, fmt.Sprintf("Current operator: %s", cur))
+	}
+	lines = append(lines,
+		"",
+		"Scan or type operator badge/ID and press [Enter]:",
+		focusStyle.Render("> "+m.operatorInput+"_"),
+		footerStyle.Render("\nPress [ESC] to cancel | Press [ctrl+q] to quit"),
+	)
+	return clear + mainBorder.Render(lipgloss.NewStyle().Width(m.width-4).Render(strings.Join(lines, "\n")))
+}
+
+// identityLine – строка с оператором и станцией для левой панели и финального экрана
+func identityLine() string {
+	op, st := identity.Operator(), identity.Station()
+	if op == "" && st == "" {
+		return ""
+	}
+	if op == "" {
+		op = "-"
+	}
+	if st == "" {
+		st = "-"
+	}
+	return fmt.Sprintf("Operator: %s | Station: %s", op, st)
+}
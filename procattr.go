@@ -0,0 +1,345 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// ================= PROCESS ATTRIBUTES =================
+// Окружение, рабочий каталог, пользователь и приоритеты дочернего теста.
+// env/cwd/user/group применяются до запуска. Для nice/ionice/cpu_affinity
+// тест запускается через сам crycaller в роли посредника (schedEnv): тот
+// выставляет приоритеты себе, сбрасывает права до user/group и делает exec
+// теста, так что их с первой инструкции наследуют все потомки теста.
+
+type ProcOptions struct {
+	Env         map[string]string
+	Cwd         string
+	User        string
+	Group       string
+	Nice        *int
+	IONice      string
+	CPUAffinity string
+}
+
+func procOptions(sc ScriptConfig) ProcOptions {
+	return ProcOptions{
+		Env:         sc.Env,
+		Cwd:         sc.Cwd,
+		User:        sc.User,
+		Group:       sc.Group,
+		Nice:        sc.Nice,
+		IONice:      sc.IONice,
+		CPUAffinity: sc.CPUAffinity,
+	}
+}
+
+// environ строит окружение теста. Значения env раскрываются через $VAR/${VAR}
+// относительно уже собранного окружения, поэтому можно ссылаться на
+// CRYCALLER_* и UNIT_* переменные.
+func (p ProcOptions) environ() []string {
+	env := append(append(os.Environ(), "TERM=xterm-256color"), sessionEnv()...)
+	if len(p.Env) == 0 {
+		return env
+	}
+	values := map[string]string{}
+	for _, kv := range env {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			values[k] = v
+		}
+	}
+	var keys []string
+	for k := range p.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := os.Expand(p.Env[k], func(name string) string { return values[name] })
+		values[k] = v
+		env = append(env, k+"="+v)
+	}
+	return env
+}
+
+// prepare настраивает cmd перед pty.Start
+func (p ProcOptions) prepare(cmd *exec.Cmd) error {
+	if cmd.Err != nil {
+		return cmd.Err
+	}
+	cmd.Env = p.environ()
+	if p.Cwd != "" {
+		dir := os.ExpandEnv(p.Cwd)
+		if info, err := os.Stat(dir); err != nil {
+			return fmt.Errorf("cwd: %v", err)
+		} else if !info.IsDir() {
+			return fmt.Errorf("cwd: %s is not a directory", dir)
+		}
+		cmd.Dir = dir
+	}
+	cred, err := p.credential()
+	if err != nil {
+		return err
+	}
+	if p.Nice != nil || p.IONice != "" || p.CPUAffinity != "" {
+		return p.viaScheduler(cmd, cred)
+	}
+	if cred != nil {
+		// pty.Start сохраняет SysProcAttr и лишь добавляет Setsid/Setctty
+		if cmd.SysProcAttr == nil {
+			cmd.SysProcAttr = &syscall.SysProcAttr{}
+		}
+		cmd.SysProcAttr.Credential = cred
+	}
+	return nil
+}
+
+// credential разрешает user/group в uid/gid. Если указан только user,
+// используются его основная и дополнительные группы.
+func (p ProcOptions) credential() (*syscall.Credential, error) {
+	if p.User == "" && p.Group == "" {
+		return nil, nil
+	}
+	cred := &syscall.Credential{Uid: uint32(os.Getuid()), Gid: uint32(os.Getgid())}
+	if p.User != "" {
+		u, err := lookupUser(p.User)
+		if err != nil {
+			return nil, err
+		}
+		cred = u
+	}
+	if p.Group != "" {
+		gid, err := lookupGroup(p.Group)
+		if err != nil {
+			return nil, err
+		}
+		cred.Gid = gid
+		if p.User == "" {
+			cred.Groups = []uint32{gid}
+		}
+	}
+	return cred, nil
+}
+
+// lookupUser разрешает имя или uid в uid, основную и дополнительные группы.
+// uid без записи в passwd тоже подходит: gid тогда равен uid, без
+// дополнительных групп
+func lookupUser(name string) (*syscall.Credential, error) {
+	id, numErr := strconv.ParseUint(name, 10, 32)
+	var u *user.User
+	err := numErr
+	if numErr == nil {
+		u, err = user.LookupId(name)
+	}
+	if err != nil {
+		u, err = user.Lookup(name)
+	}
+	switch {
+	case err == nil:
+	case numErr == nil:
+		return &syscall.Credential{Uid: uint32(id), Gid: uint32(id)}, nil
+	default:
+		return nil, fmt.Errorf("user %q: %v", name, err)
+	}
+	uid, _ := strconv.ParseUint(u.Uid, 10, 32)
+	gid, _ := strconv.ParseUint(u.Gid, 10, 32)
+	cred := &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}
+	if ids, err := u.GroupIds(); err == nil {
+		for _, id := range ids {
+			if g, err := strconv.ParseUint(id, 10, 32); err == nil {
+				cred.Groups = append(cred.Groups, uint32(g))
+			}
+		}
+	}
+	return cred, nil
+}
+
+func lookupGroup(name string) (uint32, error) {
+	if id, err := strconv.ParseUint(name, 10, 32); err == nil {
+		return uint32(id), nil
+	}
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		return 0, fmt.Errorf("group %q: %v", name, err)
+	}
+	id, _ := strconv.ParseUint(g.Gid, 10, 32)
+	return uint32(id), nil
+}
+
+// schedEnv передаёт crycaller-посреднику, что выставить перед exec теста
+const schedEnv = "CRYCALLER_SCHED"
+
+// schedSpec – задание посреднику: приоритеты, права и сам тест
+type schedSpec struct {
+	Path        string              `json:"path"`
+	Args        []string            `json:"args"`
+	Nice        *int                `json:"nice,omitempty"`
+	IONice      string              `json:"ionice,omitempty"`
+	CPUAffinity string              `json:"cpu_affinity,omitempty"`
+	Credential  *syscall.Credential `json:"credential,omitempty"`
+}
+
+// viaScheduler подменяет cmd запуском crycaller-посредника. Права он
+// сбрасывает сам, уже после приоритетов: отрицательный nice и realtime
+// ionice доступны только root.
+func (p ProcOptions) viaScheduler(cmd *exec.Cmd, cred *syscall.Credential) error {
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("scheduling: %v", err)
+	}
+	spec, err := json.Marshal(schedSpec{
+		Path:        cmd.Path,
+		Args:        cmd.Args,
+		Nice:        p.Nice,
+		IONice:      p.IONice,
+		CPUAffinity: p.CPUAffinity,
+		Credential:  cred,
+	})
+	if err != nil {
+		return fmt.Errorf("scheduling: %v", err)
+	}
+	cmd.Path, cmd.Args = self, []string{self}
+	cmd.Env = append(cmd.Env, schedEnv+"="+string(spec))
+	return nil
+}
+
+// execScheduled – режим посредника: выставляет себе nice/ionice/cpu_affinity,
+// переходит к user/group теста и заменяет себя тестом. Не возвращается.
+// Ошибки приоритетов не фатальны и попадают в вывод теста.
+func execScheduled(data string) {
+	// В Linux приоритеты и affinity – свойства потока: exec должен идти с него же
+	runtime.LockOSThread()
+	var spec schedSpec
+	if err := json.Unmarshal([]byte(data), &spec); err != nil {
+		fmt.Fprintf(os.Stderr, "crycaller: %s: %v\n", schedEnv, err)
+		os.Exit(127)
+	}
+	p := ProcOptions{Nice: spec.Nice, IONice: spec.IONice, CPUAffinity: spec.CPUAffinity}
+	for _, err := range p.applyScheduling() {
+		fmt.Fprintf(os.Stderr, "crycaller: %v\n", err)
+	}
+	if c := spec.Credential; c != nil {
+		groups := make([]int, len(c.Groups))
+		for i, g := range c.Groups {
+			groups[i] = int(g)
+		}
+		// Тест не должен остаться root, если права сбросить не удалось
+		for _, err := range []error{syscall.Setgroups(groups), syscall.Setgid(int(c.Gid)), syscall.Setuid(int(c.Uid))} {
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "crycaller: set user %d/%d: %v\n", c.Uid, c.Gid, err)
+				os.Exit(126)
+			}
+		}
+	}
+	var env []string
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, schedEnv+"=") {
+			env = append(env, kv)
+		}
+	}
+	err := syscall.Exec(spec.Path, spec.Args, env)
+	fmt.Fprintf(os.Stderr, "crycaller: exec %s: %v\n", spec.Path, err)
+	os.Exit(127)
+}
+
+// applyScheduling выставляет nice/ionice/cpu_affinity текущему потоку
+func (p ProcOptions) applyScheduling() []error {
+	var errs []error
+	if p.Nice != nil {
+		if err := unix.Setpriority(unix.PRIO_PROCESS, 0, *p.Nice); err != nil {
+			errs = append(errs, fmt.Errorf("nice %d: %v", *p.Nice, err))
+		}
+	}
+	if p.IONice != "" {
+		prio, err := parseIONice(p.IONice)
+		if err == nil {
+			_, _, errno := unix.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoProcess, 0, uintptr(prio))
+			if errno != 0 {
+				err = errno
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("ionice %q: %v", p.IONice, err))
+		}
+	}
+	if p.CPUAffinity != "" {
+		set, err := parseCPUList(p.CPUAffinity)
+		if err == nil {
+			err = unix.SchedSetaffinity(0, &set)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("cpu_affinity %q: %v", p.CPUAffinity, err))
+		}
+	}
+	return errs
+}
+
+const (
+	ioprioWhoProcess = 1
+	ioprioClassShift = 13
+)
+
+// parseIONice: "idle", "best-effort[:0-7]", "realtime[:0-7]" (как у ionice -c)
+func parseIONice(val string) (int, error) {
+	class, level, hasLevel := strings.Cut(strings.ToLower(strings.TrimSpace(val)), ":")
+	var c int
+	switch class {
+	case "realtime", "rt", "1":
+		c = 1
+	case "best-effort", "be", "2":
+		c = 2
+	case "idle", "3":
+		c = 3
+	default:
+		return 0, fmt.Errorf("unknown class %q (expected realtime, best-effort or idle)", class)
+	}
+	n := 4
+	if hasLevel {
+		var err error
+		if n, err = strconv.Atoi(level); err != nil || n < 0 || n > 7 {
+			return 0, fmt.Errorf("invalid level %q (expected 0-7)", level)
+		}
+	}
+	if c == 3 {
+		n = 0
+	}
+	return c<<ioprioClassShift | n, nil
+}
+
+// parseCPUList разбирает список CPU в формате taskset -c: "0-3,6"
+func parseCPUList(val string) (unix.CPUSet, error) {
+	var set unix.CPUSet
+	for _, part := range strings.Split(val, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		lo, hi, isRange := strings.Cut(part, "-")
+		from, err := strconv.Atoi(lo)
+		if err != nil {
+			return set, fmt.Errorf("invalid cpu %q", part)
+		}
+		to := from
+		if isRange {
+			if to, err = strconv.Atoi(hi); err != nil || to < from {
+				return set, fmt.Errorf("invalid range %q", part)
+			}
+		}
+		for cpu := from; cpu <= to; cpu++ {
+			set.Set(cpu)
+		}
+	}
+	if set.Count() == 0 {
+		return set, fmt.Errorf("empty cpu list")
+	}
+	return set, nil
+}
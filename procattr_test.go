@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestMain lets the test binary stand in for crycaller when prepare runs a
+// test through the scheduling trampoline.
+func TestMain(m *testing.M) {
+	if spec, ok := os.LookupEnv(schedEnv); ok {
+		execScheduled(spec)
+	}
+	os.Exit(m.Run())
+}
+
+func TestPrepareScheduling(t *testing.T) {
+	nice := 5
+	p := ProcOptions{Nice: &nice, CPUAffinity: "0"}
+	// The grandchild shows whether the settings reach the whole tree.
+	cmd := exec.Command("sh", "-c", `sh -c 'nice; grep Cpus_allowed_list /proc/self/status'`)
+	if err := p.prepare(cmd); err != nil {
+		t.Fatal(err)
+	}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	lines := strings.Fields(string(out))
+	if len(lines) != 3 || lines[0] != "5" || lines[2] != "0" {
+		t.Errorf("output = %q, want nice 5 and Cpus_allowed_list 0", out)
+	}
+	for _, kv := range cmd.Env {
+		if strings.HasPrefix(kv, "PATH=") {
+			return
+		}
+	}
+	t.Error("prepare dropped the environment")
+}
+
+func TestLookupUser(t *testing.T) {
+	// A uid without a passwd entry is taken as is.
+	uid := 4000000
+	for ; uid < 4000100; uid++ {
+		if _, err := user.LookupId(strconv.Itoa(uid)); err != nil {
+			break
+		}
+	}
+	cred, err := lookupUser(strconv.Itoa(uid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cred.Uid != uint32(uid) || cred.Gid != uint32(uid) || len(cred.Groups) != 0 {
+		t.Errorf("cred = %+v, want uid and gid %d", cred, uid)
+	}
+
+	if _, err := lookupUser("no-such-user-crycaller"); err == nil {
+		t.Error("unknown user name accepted")
+	}
+
+	cred, err = lookupUser("0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cred.Uid != 0 || cred.Gid != 0 {
+		t.Errorf("root cred = %+v", cred)
+	}
+}
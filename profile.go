@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ================= PROFILES =================
+// Профиль – именованный набор тестов в profiles/<name>.json. Его создаёт
+// `crycaller edit`, а запускает `crycaller -profile <name>`. vars
+// подставляются в path и args как $VAR/${VAR} (неизвестные берутся из окружения).
+
+const profileDir = "profiles"
+
+type Profile struct {
+	Name    string            `json:"name"`
+	Scripts Config            `json:"scripts"`
+	Vars    map[string]string `json:"vars"`
+}
+
+func profilePath(name string) string {
+	return filepath.Join(profileDir, name+".json")
+}
+
+func loadProfile(name string) (*Profile, error) {
+	data, err := os.ReadFile(profilePath(name))
+	if err != nil {
+		return nil, err
+	}
+	var p Profile
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("%s: %v", profilePath(name), err)
+	}
+	if p.Name == "" {
+		p.Name = name
+	}
+	if p.Vars == nil {
+		p.Vars = map[string]string{}
+	}
+	return &p, nil
+}
+
+func saveProfile(p *Profile) error {
+	if err := os.MkdirAll(profileDir, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(profilePath(p.Name), append(data, '\n'), 0644)
+}
+
+// config возвращает конфиг прогона с подставленными vars
+func (p *Profile) config() *Config {
+	cfg := p.Scripts
+	expand := func(s string) string {
+		return os.Expand(s, func(name string) string {
+			if v, ok := p.Vars[name]; ok {
+				return v
+			}
+			return os.Getenv(name)
+		})
+	}
+	apply := func(scs []ScriptConfig) []ScriptConfig {
+		out := make([]ScriptConfig, len(scs))
+		for idx, sc := range scs {
+			if strings.Contains(sc.Path+sc.Args, "$") {
+				sc.Path = expand(sc.Path)
+				sc.Args = expand(sc.Args)
+			}
+			out[idx] = sc
+		}
+		return out
+	}
+	cfg.BackgroundScripts = apply(cfg.BackgroundScripts)
+	cfg.InteractiveScripts = apply(cfg.InteractiveScripts)
+	return &cfg
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+	"unsafe"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"golang.org/x/sys/unix"
+)
+
+// ================= CONFIG HOT RELOAD =================
+// config.json (или файл профиля) отслеживается через inotify (на каталог – редакторы обычно
+// пишут во временный файл и переименовывают его). Безопасные изменения
+// применяются сразу: раскладка плиток, max_logs, клавиши, новые тесты,
+// удаление ещё не запущенных тестов. Изменения, затрагивающие уже
+// запущенные тесты, вступают в силу при следующем рестарте, о чём
+// сообщает баннер.
+
+const reloadDebounce = 300 * time.Millisecond
+
+type configReloadMsg struct {
+	cfg      *Config
+	err      error
+	warnings []string
+}
+
+// watchConfig следит за файлом конфига и отправляет configReloadMsg после каждой записи
+func watchConfig(path string, load func() (*Config, error)) error {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC)
+	if err != nil {
+		return err
+	}
+	dir, name := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	if _, err := unix.InotifyAddWatch(fd, dir, unix.IN_CLOSE_WRITE|unix.IN_MOVED_TO|unix.IN_CREATE); err != nil {
+		unix.Close(fd)
+		return err
+	}
+	changed := make(chan struct{}, 1)
+	go func() {
+		buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+		for {
+			n, err := unix.Read(fd, buf)
+			if err != nil {
+				if err == unix.EINTR {
+					continue
+				}
+				bareLog.Printf("inotify read error: %v", err)
+				return
+			}
+			for off := 0; off+unix.SizeofInotifyEvent <= n; {
+				ev := (*unix.InotifyEvent)(unsafe.Pointer(&buf[off]))
+				nameBytes := buf[off+unix.SizeofInotifyEvent : off+unix.SizeofInotifyEvent+int(ev.Len)]
+				if strings.TrimRight(string(nameBytes), "\x00") == name {
+					select {
+					case changed <- struct{}{}:
+					default:
+					}
+				}
+				off += unix.SizeofInotifyEvent + int(ev.Len)
+			}
+		}
+	}()
+	go func() {
+		for range changed {
+			// Редактор может писать файл в несколько приёмов – ждём, пока всё утихнет
+			time.Sleep(reloadDebounce)
+			select {
+			case <-changed:
+			default:
+			}
+			cfg, err := load()
+			if err == nil && cfg == nil {
+				err = fmt.Errorf("%s is empty or invalid", path)
+			}
+			var warnings []string
+			if err == nil {
+				warnings = validateConfig(cfg)
+			}
+			prog.Send(configReloadMsg{cfg: cfg, err: err, warnings: warnings})
+		}
+	}()
+	return nil
+}
+
+// liveFields – поля, которые можно поменять у уже запущенного теста
+func liveFields(sc ScriptConfig) ScriptConfig {
+	sc.MaxLogs = 0
+	sc.Output = false
+	sc.OutputRes = ""
+	sc.Keys = KeysConfig{}
+	sc.Tags = nil
+	return sc
+}
+
+// needsRestart – изменения затрагивают запуск теста, а не только его отображение
+func needsRestart(old, new ScriptConfig) bool {
+	if !reflect.DeepEqual(liveFields(old), liveFields(new)) {
+		return true
+	}
+	// Размер виртуального терминала curses-теста фиксируется при запуске
+	return strings.Contains(strings.ToLower(new.Type), "curses") && old.OutputRes != new.OutputRes
+}
+
+// matchTests сопоставляет тесты с записями нового конфига: сначала по
+// testKey, оставшиеся – по пути в порядке следования. Так правка args или
+// params – изменение того же теста, а не удаление старого и добавление
+// нового. Возвращает индекс записи для каждого теста (-1 – записи нет) и
+// занятые записи.
+func matchTests(kind string, keys, paths []string, scs []ScriptConfig) ([]int, []bool) {
+	idx := make([]int, len(keys))
+	taken := make([]bool, len(scs))
+	for t, key := range keys {
+		idx[t] = -1
+		for j, sc := range scs {
+			if !taken[j] && testKey(kind, sc) == key {
+				idx[t], taken[j] = j, true
+				break
+			}
+		}
+	}
+	for t, path := range paths {
+		if idx[t] >= 0 {
+			continue
+		}
+		for j, sc := range scs {
+			if !taken[j] && scriptPath(sc) == path {
+				idx[t], taken[j] = j, true
+				break
+			}
+		}
+	}
+	return idx, taken
+}
+
+// scriptPath – путь теста так, как его показывает плитка
+func scriptPath(sc ScriptConfig) string {
+	if sc.Path == "" && strings.TrimSpace(strings.Split(sc.Type, ",")[0]) == "builtin" {
+		return "builtin:" + sc.Builtin
+	}
+	return sc.Path
+}
+
+func (b *BgScript) applyLive(sc ScriptConfig) {
+	b.MaxLogs = sc.MaxLogs
+	if b.MaxLogs <= 0 {
+		b.MaxLogs = 5
+	}
+	b.Output = sc.Output
+	b.Keys = sc.Keys
+	if h, w, err := parseOutputRes(sc.OutputRes, b.vtBuffer != nil); err == nil && b.vtBuffer == nil {
+		b.OutputRes, b.OutHeight, b.OutWidth = sc.OutputRes, h, w
+	}
+}
+
+func (i *IntScript) applyLive(sc ScriptConfig) {
+	i.MaxLogs = sc.MaxLogs
+	if i.MaxLogs <= 0 {
+		i.MaxLogs = 5
+	}
+	i.Output = sc.Output
+	i.Keys = sc.Keys
+	if h, w, err := parseOutputRes(sc.OutputRes, i.vtBuffer != nil); err == nil && i.vtBuffer == nil {
+		i.OutputRes, i.OutHeight, i.OutWidth = sc.OutputRes, h, w
+	}
+}
+
+// applyConfigReload сопоставляет тесты со старым и новым конфигом (matchTests)
+func applyConfigReload(m model, cfg *Config) model {
+	old := globalConfig
+	var applied, queued []string
+
+	var keys, paths []string
+	for _, b := range m.bgScripts {
+		keys, paths = append(keys, b.Key), append(paths, b.Path)
+	}
+	newBg, takenBg := matchTests("bg", keys, paths, cfg.BackgroundScripts)
+	var bgs []*BgScript
+	for t, b := range m.bgScripts {
+		j := newBg[t]
+		switch {
+		case j < 0 && b.Status == StatusWaiting:
+			applied = append(applied, "removed "+b.Path)
+			continue
+		case j < 0:
+			b.ConfigIndex = -1
+			queued = append(queued, b.Path+" removed from config")
+		case b.Status == StatusWaiting:
+			nb := newBgScript(cfg.BackgroundScripts[j], j)
+			nb.Attempts = b.Attempts
+			b = nb
+		default:
+			sc := cfg.BackgroundScripts[j]
+			if b.ConfigIndex >= 0 && needsRestart(old.BackgroundScripts[b.ConfigIndex], sc) {
+				queued = append(queued, b.Path+" changed")
+			}
+			b.applyLive(sc)
+			b.ConfigIndex = j
+		}
+		bgs = append(bgs, b)
+	}
+	for j, sc := range cfg.BackgroundScripts {
+		if !takenBg[j] && runFilter.Match(sc) {
+			nb := newBgScript(sc, j)
+			bgs = append(bgs, nb)
+			applied = append(applied, "added "+nb.Path)
+		}
+	}
+
+	keys, paths = nil, nil
+	for _, i := range m.intScripts {
+		keys, paths = append(keys, i.Key), append(paths, i.Path)
+	}
+	newInt, takenInt := matchTests("int", keys, paths, cfg.InteractiveScripts)
+	var ints []*IntScript
+	for t, i := range m.intScripts {
+		j := newInt[t]
+		switch {
+		case j < 0 && i.Status == StatusWaiting:
+			applied = append(applied, "removed "+i.Path)
+			continue
+		case j < 0:
+			i.ConfigIndex = -1
+			queued = append(queued, i.Path+" removed from config")
+		case i.Status == StatusWaiting:
+			ni := newIntScript(cfg.InteractiveScripts[j], j)
+			ni.Attempts = i.Attempts
+			i = ni
+		default:
+			sc := cfg.InteractiveScripts[j]
+			if i.ConfigIndex >= 0 && needsRestart(old.InteractiveScripts[i.ConfigIndex], sc) {
+				queued = append(queued, i.Path+" changed")
+			}
+			i.applyLive(sc)
+			i.ConfigIndex = j
+		}
+		ints = append(ints, i)
+	}
+	for j, sc := range cfg.InteractiveScripts {
+		if !takenInt[j] && runFilter.Match(sc) {
+			ni := newIntScript(sc, j)
+			ints = append(ints, ni)
+			applied = append(applied, "added "+ni.Path)
+		}
+	}
+
+	// Общие настройки (станция, стартовые экраны, правила) – только с рестартом
+	if !reflect.DeepEqual(globalSettings(*old), globalSettings(*cfg)) {
+		queued = append(queued, "global settings changed")
+	}
+
+	globalConfig = cfg
+	m.bgScripts = bgs
+	m.intScripts = ints
+	m.outputTiles = buildOutputTiles(m.bgScripts, m.intScripts)
+	if m.selectedTileIdx >= len(m.outputTiles) {
+		m.selectedTileIdx = 0
+	}
+	m.reloadQueued = mergeNotes(m.reloadQueued, queued)
+	m.reloadApplied = fmt.Sprintf("config reloaded at %s", time.Now().Format("15:04:05"))
+	if len(applied) > 0 {
+		m.reloadApplied += ": " + strings.Join(applied, ", ")
+	}
+	bareLog.Printf("Config reloaded: applied %v, queued %v", applied, queued)
+
+	// Новые тесты запускаются сразу, если прогон идёт
+	if m.mode == modeMain && !m.pendingLaunch && !m.rebootStage {
+		launchScripts(m.bgScripts, m.intScripts, notifyFor(m.bgScripts, m.intScripts))
+	}
+	return m
+}
+
+func globalSettings(cfg Config) Config {
+	cfg.BackgroundScripts = nil
+	cfg.InteractiveScripts = nil
+	return cfg
+}
+
+func mergeNotes(notes, add []string) []string {
+	for _, n := range add {
+		dup := false
+		for _, e := range notes {
+			if e == n {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			notes = append(notes, n)
+		}
+	}
+	return notes
+}
+
+func handleConfigReload(m model, msg configReloadMsg) (tea.Model, tea.Cmd) {
+	if msg.err != nil {
+		bareLog.Printf("Config reload failed: %v", msg.err)
+		m.reloadApplied = "config reload failed: " + msg.err.Error()
+		return m, tickCmd()
+	}
+	m.configWarnings = msg.warnings
+	return applyConfigReload(m, msg.cfg), tickCmd()
+}
+
+// reloadBanner – строка о последней перезагрузке конфига и отложенных изменениях
+func reloadBanner(m model) string {
+	var lines []string
+	if m.reloadApplied != "" {
+		lines = append(lines, footerStyle.Render(m.reloadApplied))
+	}
+	if len(m.reloadQueued) > 0 {
+		lines = append(lines, pausedStyle.Render("Pending until restart (ctrl+r): "+strings.Join(m.reloadQueued, "; ")))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApplyConfigReload(t *testing.T) {
+	stress := ScriptConfig{Path: "./stress", Args: "-t 60", Type: "default"}
+	mic := ScriptConfig{Path: "./mic_test", Type: "default"}
+	ping := ScriptConfig{Type: "builtin", Builtin: "ping", Params: map[string]string{"host": "a"}}
+
+	for _, c := range []struct {
+		name        string
+		old, new    []ScriptConfig
+		status      []ScriptStatus
+		wantPaths   []string
+		wantArgs    []string
+		wantIndex   []int
+		wantQueued  []string
+		wantRunning int // started tests kept as they are, not replaced
+	}{
+		{
+			name:      "args of a running test are queued",
+			old:       []ScriptConfig{stress},
+			new:       []ScriptConfig{{Path: "./stress", Args: "-t 600", Type: "default"}},
+			status:    []ScriptStatus{StatusRunning},
+			wantPaths: []string{"./stress"}, wantArgs: []string{"-t 60"}, wantIndex: []int{0},
+			wantQueued: []string{"./stress changed"}, wantRunning: 1,
+		},
+		{
+			name:      "args of a passed test are queued",
+			old:       []ScriptConfig{stress, mic},
+			new:       []ScriptConfig{mic, {Path: "./stress", Args: "-t 600", Type: "default"}},
+			status:    []ScriptStatus{StatusPassed, StatusPassed},
+			wantPaths: []string{"./stress", "./mic_test"}, wantArgs: []string{"-t 60", ""}, wantIndex: []int{1, 0},
+			wantQueued: []string{"./stress changed"}, wantRunning: 2,
+		},
+		{
+			name:      "params of a builtin are queued",
+			old:       []ScriptConfig{ping},
+			new:       []ScriptConfig{{Type: "builtin", Builtin: "ping", Params: map[string]string{"host": "b"}}},
+			status:    []ScriptStatus{StatusFailed},
+			wantPaths: []string{"builtin:ping"}, wantArgs: []string{""}, wantIndex: []int{0},
+			wantQueued: []string{"builtin:ping changed"}, wantRunning: 1,
+		},
+		{
+			name:      "args of a waiting test apply at once",
+			old:       []ScriptConfig{stress},
+			new:       []ScriptConfig{{Path: "./stress", Args: "-t 600", Type: "default"}},
+			status:    []ScriptStatus{StatusWaiting},
+			wantPaths: []string{"./stress"}, wantArgs: []string{"-t 600"}, wantIndex: []int{0},
+		},
+		{
+			name:      "second copy of a running test is added",
+			old:       []ScriptConfig{stress},
+			new:       []ScriptConfig{stress, {Path: "./stress", Args: "-t 600", Type: "default"}},
+			status:    []ScriptStatus{StatusRunning},
+			wantPaths: []string{"./stress", "./stress"}, wantArgs: []string{"-t 60", "-t 600"}, wantIndex: []int{0, 1},
+			wantRunning: 1,
+		},
+		{
+			name:      "removed running test is queued, removed waiting test goes",
+			old:       []ScriptConfig{stress, mic},
+			new:       nil,
+			status:    []ScriptStatus{StatusRunning, StatusWaiting},
+			wantPaths: []string{"./stress"}, wantArgs: []string{"-t 60"}, wantIndex: []int{-1},
+			wantQueued: []string{"./stress removed from config"}, wantRunning: 1,
+		},
+		{
+			name:      "display fields apply live",
+			old:       []ScriptConfig{stress},
+			new:       []ScriptConfig{{Path: "./stress", Args: "-t 60", Type: "default", MaxLogs: 9}},
+			status:    []ScriptStatus{StatusRunning},
+			wantPaths: []string{"./stress"}, wantArgs: []string{"-t 60"}, wantIndex: []int{0},
+			wantRunning: 1,
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			m := testModel(t, Config{BackgroundScripts: c.old})
+			m.pendingLaunch = true
+			var before []*BgScript
+			for i, sc := range c.old {
+				b := newBgScript(sc, i)
+				b.Status = c.status[i]
+				before = append(before, b)
+			}
+			m.bgScripts = append([]*BgScript(nil), before...)
+
+			m = applyConfigReload(m, &Config{BackgroundScripts: c.new})
+
+			var paths, args []string
+			var index []int
+			running := 0
+			for _, b := range m.bgScripts {
+				paths, args, index = append(paths, b.Path), append(args, b.Args), append(index, b.ConfigIndex)
+				for _, o := range before {
+					if o == b && o.Status != StatusWaiting {
+						running++
+					}
+				}
+			}
+			if !reflect.DeepEqual(paths, c.wantPaths) || !reflect.DeepEqual(args, c.wantArgs) || !reflect.DeepEqual(index, c.wantIndex) {
+				t.Errorf("tests = %q %q %v, want %q %q %v", paths, args, index, c.wantPaths, c.wantArgs, c.wantIndex)
+			}
+			if running != c.wantRunning {
+				t.Errorf("%d started tests kept, want %d", running, c.wantRunning)
+			}
+			if !reflect.DeepEqual(m.reloadQueued, c.wantQueued) {
+				t.Errorf("queued = %q, want %q", m.reloadQueued, c.wantQueued)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"crycaller/internal/safename"
+)
+
+// ================= RUN REPORT =================
+// Итоговый отчёт прогона пишется в reports/ при переходе на финальный экран.
+// Имя файла содержит станцию, оператора и ID сессии.
+
+const reportDir = "reports"
+
+// TestAttempt – результат одного запуска теста; при повторном запуске
+// с финального экрана предыдущие попытки сохраняются в истории
+type TestAttempt struct {
+	Status     string        `json:"status"`
+	Code       int           `json:"code"`
+	Duration   time.Duration `json:"duration_ns"`
+	Reason     string        `json:"reason,omitempty"`
+	FinishedAt time.Time     `json:"finished_at"`
+}
+
+type TestReport struct {
+	Kind     string        `json:"kind"` // bg | int
+	Path     string        `json:"path"`
+	Args     string        `json:"args,omitempty"`
+	Info     bool          `json:"info,omitempty"`
+	Status   string        `json:"status"`
+	Code     int           `json:"code"`
+	Duration time.Duration `json:"duration_ns"`
+	Resumed  bool          `json:"resumed,omitempty"`
+	Reason   string        `json:"reason,omitempty"`
+	CutOff   bool          `json:"cut_off,omitempty"`
+
+	Usage            *ResourceUsage `json:"usage,omitempty"`
+	PreviousAttempts []TestAttempt  `json:"previous_attempts,omitempty"`
+}
+
+type RunReport struct {
+	SessionID  string            `json:"session_id"`
+	StationID  string            `json:"station_id,omitempty"`
+	Operator   string            `json:"operator,omitempty"`
+	Operators  []OperatorShift   `json:"operator_shifts,omitempty"`
+	Product    string            `json:"product,omitempty"`
+	Unit       map[string]string `json:"unit,omitempty"`
+	StartedAt  time.Time         `json:"started_at"`
+	FinishedAt time.Time         `json:"finished_at"`
+	ExitCode   int               `json:"exit_code"`
+
+	// Частичный прогон: активный фильтр и тесты конфига, не попавшие в прогон
+	Partial bool       `json:"partial,omitempty"`
+	Filter  *RunFilter `json:"filter,omitempty"`
+	Skipped []string   `json:"skipped,omitempty"`
+
+	Soak *SoakRun `json:"soak,omitempty"` // циклы и доля падений в soak-режиме; tests – последний цикл
+
+	Tests []TestReport `json:"tests"`
+}
+
+func buildRunReport(m model) RunReport {
+	r := RunReport{
+		StationID:  identity.Station(),
+		Operator:   identity.Operator(),
+		Operators:  identity.Shifts(),
+		Product:    unit.Product(),
+		Unit:       unit.Values(),
+		FinishedAt: time.Now(),
+		ExitCode:   m.exitCode,
+	}
+	if runJournal != nil {
+		r.SessionID = runJournal.SessionID
+		r.StartedAt = runJournal.StartedAt
+	}
+	if runFilter.Active() {
+		f := runFilter
+		r.Partial = true
+		r.Filter = &f
+		r.Skipped = skippedTests(globalConfig, runFilter)
+	}
+	r.Soak = soak
+	for _, b := range m.bgScripts {
+		t := TestReport{
+			Kind: "bg", Path: b.Path, Args: b.Args, Info: b.Info,
+			Status: b.Status.String(), Code: b.Code, Duration: b.Duration, Resumed: b.Resumed,
+			Reason: b.Reason, CutOff: b.CutOff, PreviousAttempts: b.Attempts,
+		}
+		if b.Type != "builtin" && !b.StartTime.IsZero() {
+			u := b.Usage
+			t.Usage = &u
+		}
+		r.Tests = append(r.Tests, t)
+	}
+	for _, i := range m.intScripts {
+		t := TestReport{
+			Kind: "int", Path: i.Path, Args: i.Args, Info: i.Info,
+			Status: i.Status.String(), Code: i.Code, Duration: i.Duration, Resumed: i.Resumed,
+			Reason: i.Reason, CutOff: i.CutOff, PreviousAttempts: i.Attempts,
+		}
+		if i.Type != "builtin" && !i.StartTime.IsZero() {
+			u := i.Usage
+			t.Usage = &u
+		}
+		r.Tests = append(r.Tests, t)
+	}
+	return r
+}
+
+// reportFileName: <station>_<operator>_<session>.json, пустые части пропускаются
+func reportFileName(r RunReport) string {
+	return safename.Join(r.StationID, r.Operator, r.SessionID) + ".json"
+}
+
+// writeRunReport сохраняет отчёт и возвращает путь к файлу
+func writeRunReport(r RunReport) (string, error) {
+	if err := os.MkdirAll(reportDir, 0755); err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(reportDir, reportFileName(r))
+	return path, os.WriteFile(path, data, 0644)
+}
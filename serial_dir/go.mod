@@ -1,3 +0,0 @@
-module serial
-
-go 1.23.2
@@ -0,0 +1,478 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"crycaller/internal/efivarfs"
+	"crycaller/internal/macpool"
+	"crycaller/internal/provision"
+)
+
+// -dry-run: the run takes its usual path against dryRunSystem. Commands that
+// only read the machine (dmidecode, ip listings, lsmod, lsblk, blkid, findmnt,
+// uname, efibootmgr listings), files and efivarfs are read as usual; every
+// other command and every change of a file, an EFI variable or the MAC pool
+// becomes a step of the plan instead. What the run reads back after a change
+// (the burned MAC, the new OneTimeBoot entry, the written variables, the
+// built module) is simulated. The plan is printed when the run exits.
+
+// dryRunSystem records the changes of a dry run
+type dryRunSystem struct {
+	System
+	efi   *dryRunEfi
+	steps []string
+	files map[string]bool // созданные файлы и каталоги (true – каталог)
+	built []string        // каталоги, в которых запускался make
+
+	macSet   string          // MAC, который прошила утилита
+	bootDev  string          // диск новой записи OneTimeBoot
+	bootNew  string          // номер новой записи OneTimeBoot
+	bootNext string          // efibootmgr -n
+	removed  map[string]bool // удалённые записи Boot####
+}
+
+// startDryRun wraps the system, efivarfs and the MAC pool so that the run
+// only records its changes
+func startDryRun() {
+	r := &dryRunSystem{System: system, files: map[string]bool{}, removed: map[string]bool{}}
+	r.efi = &dryRunEfi{EfiStore: efiVars, rec: r, vars: map[efivarfs.VarID]*dryRunVar{}}
+	efiVars = r.efi
+	if macAllocator != nil {
+		macAllocator = &dryRunAllocator{rec: r, pool: macPoolRange, next: macPoolRange.First}
+	}
+	system = r
+}
+
+func (r *dryRunSystem) step(format string, args ...interface{}) {
+	r.steps = append(r.steps, fmt.Sprintf(format, args...))
+}
+
+// dryRunReads reports whether a command only reads the machine
+func dryRunReads(name string, args []string) bool {
+	switch name {
+	case "dmidecode", "lsmod", "lsblk", "blkid", "findmnt", "uname":
+		return true
+	case "ip":
+		line := strings.Join(args, " ")
+		return line == "a" || strings.HasSuffix(line, "link show") || strings.HasPrefix(line, "addr show")
+	case "efibootmgr":
+		return len(args) == 0 || args[0] == "-v"
+	}
+	return false
+}
+
+var etherRe = regexp.MustCompile(`link/ether [0-9a-f:]+`)
+
+func (r *dryRunSystem) Run(name string, args ...string) (string, error) {
+	line := strings.Join(append([]string{name}, args...), " ")
+	if !dryRunReads(name, args) {
+		r.step("%s", line)
+		r.changed(name, args)
+		return "", nil
+	}
+	if name == "efibootmgr" && r.bootNew != "" && len(args) == 3 && args[2] == r.bootNew {
+		return r.bootEntry(), nil
+	}
+	out, err := r.System.Run(name, args...)
+	if err != nil {
+		return out, err
+	}
+	switch {
+	case name == "ip" && strings.HasSuffix(line, "link show") && r.macSet != "":
+		// Утилита прошила MAC: он появляется на первом Ethernet-интерфейсе
+		if loc := etherRe.FindStringIndex(out); loc != nil {
+			out = out[:loc[0]] + "link/ether " + r.macSet + out[loc[1]:]
+		}
+	case name == "efibootmgr":
+		out = r.bootListing(out)
+	}
+	return out, nil
+}
+
+// changed keeps what the run will read back after a recorded command
+func (r *dryRunSystem) changed(name string, args []string) {
+	flat := strings.ToUpper(strings.ReplaceAll(strings.Join(args, " "), ":", ""))
+	if mac != "" && strings.Contains(flat, strings.ToUpper(strings.ReplaceAll(mac, ":", ""))) {
+		r.macSet = strings.ToLower(mac)
+	}
+	switch {
+	case name == "make" && len(args) > 1 && args[0] == "-C":
+		r.built = append(r.built, args[1])
+	case name == "efibootmgr" && args[0] == "-c":
+		if i := slices.Index(args, "-d"); i >= 0 && i+1 < len(args) {
+			r.bootDev = args[i+1]
+		}
+		// efibootmgr берёт следующий свободный номер
+		out, _ := r.System.Run("efibootmgr")
+		next := 0
+		for _, m := range regexp.MustCompile(`(?m)^Boot([0-9A-Fa-f]{4})`).FindAllStringSubmatch(out, -1) {
+			if n, err := strconv.ParseUint(m[1], 16, 16); err == nil && int(n) >= next {
+				next = int(n) + 1
+			}
+		}
+		r.bootNew = fmt.Sprintf("%04X", next)
+	case name == "efibootmgr" && args[0] == "-B" && len(args) == 3:
+		r.removed[args[2]] = true
+	case name == "efibootmgr" && args[0] == "-n" && len(args) == 2:
+		r.bootNext = args[1]
+	}
+}
+
+func (r *dryRunSystem) bootEntry() string {
+	return fmt.Sprintf("Boot%s* OneTimeBoot\tHD(%s)/File(%s)", r.bootNew, r.bootDev, targetBootPath)
+}
+
+// bootListing applies the recorded efibootmgr changes to a listing
+func (r *dryRunSystem) bootListing(out string) string {
+	var lines []string
+	if r.bootNext != "" {
+		lines = append(lines, "BootNext: "+r.bootNext)
+	}
+	for _, l := range strings.Split(out, "\n") {
+		if (r.bootNext != "" && strings.HasPrefix(l, "BootNext:")) || (len(l) >= 8 && r.removed[l[4:8]]) {
+			continue
+		}
+		lines = append(lines, l)
+	}
+	if r.bootNew != "" {
+		lines = append(lines, r.bootEntry())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// dryRunFile is a file the run would have created
+type dryRunFile struct {
+	name string
+	dir  bool
+}
+
+func (f dryRunFile) Name() string       { return filepath.Base(f.name) }
+func (f dryRunFile) Size() int64        { return 0 }
+func (f dryRunFile) ModTime() time.Time { return time.Time{} }
+func (f dryRunFile) IsDir() bool        { return f.dir }
+func (f dryRunFile) Sys() interface{}   { return nil }
+
+func (f dryRunFile) Mode() os.FileMode {
+	if f.dir {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
+
+func (r *dryRunSystem) Stat(name string) (os.FileInfo, error) {
+	if dir, ok := r.files[name]; ok {
+		return dryRunFile{name, dir}, nil
+	}
+	// make в каталоге модуля собирает .ko
+	if filepath.Ext(name) == ".ko" && slices.Contains(r.built, filepath.Dir(name)) {
+		return dryRunFile{name, false}, nil
+	}
+	return r.System.Stat(name)
+}
+
+func (r *dryRunSystem) WriteFile(name string, data []byte, perm os.FileMode) error {
+	if _, err := r.Stat(filepath.Dir(name)); err != nil {
+		return err
+	}
+	if len(data) <= 64 && !strings.ContainsRune(string(data), '\n') {
+		r.step("write %q to %s", data, name)
+	} else {
+		r.step("write %s (%d bytes)", name, len(data))
+	}
+	r.files[name] = false
+	return nil
+}
+
+func (r *dryRunSystem) Mkdir(name string, perm os.FileMode) error {
+	if _, err := r.Stat(name); err == nil {
+		return &os.PathError{Op: "mkdir", Path: name, Err: os.ErrExist}
+	}
+	r.step("mkdir %s", name)
+	r.files[name] = true
+	return nil
+}
+
+func (r *dryRunSystem) Rename(oldpath, newpath string) error {
+	if _, err := r.Stat(oldpath); err != nil {
+		return err
+	}
+	r.step("rename %s to %s", oldpath, newpath)
+	r.files[newpath] = false
+	return nil
+}
+
+func (r *dryRunSystem) Chmod(name string, mode os.FileMode) error {
+	if _, err := r.Stat(name); err != nil {
+		return err
+	}
+	r.step("chmod %o %s", mode, name)
+	return nil
+}
+
+// MkdirTemp names the directory after the pattern, the random part is XXXXXX
+func (r *dryRunSystem) MkdirTemp(dir, pattern string) (string, error) {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	if i := strings.LastIndex(pattern, "*"); i >= 0 {
+		pattern = pattern[:i] + "XXXXXX" + pattern[i+1:]
+	} else {
+		pattern += "XXXXXX"
+	}
+	name := filepath.Join(dir, pattern)
+	r.step("mkdir %s", name)
+	r.files[name] = true
+	return name, nil
+}
+
+func (r *dryRunSystem) RemoveAll(path string) error {
+	r.step("remove %s", path)
+	for name := range r.files {
+		if name == path || strings.HasPrefix(name, path+string(filepath.Separator)) {
+			delete(r.files, name)
+		}
+	}
+	return nil
+}
+
+func (r *dryRunSystem) EfiVars() EfiStore     { return r.efi }
+func (r *dryRunSystem) Sleep(d time.Duration) {}
+
+// Exit prints the plan before the run ends
+func (r *dryRunSystem) Exit(code int) {
+	fmt.Println()
+	title := "=== Plan ==="
+	if result.Action != "" {
+		title = "=== Plan: " + result.Action + " ==="
+	}
+	fmt.Println(colorBlue + title + colorReset)
+	for i, s := range r.steps {
+		fmt.Printf("  %2d. %s\n", i+1, s)
+	}
+	for _, e := range result.Errors {
+		fmt.Println(colorRed + "  FAIL: " + e + colorReset)
+	}
+	fmt.Println()
+	if code == exitOK {
+		fmt.Println(colorGreen + "Dry run finished, nothing was changed." + colorReset)
+	} else {
+		fmt.Printf(colorRed+"Dry run finished with exit code %d, nothing was changed.\n"+colorReset, code)
+	}
+	r.System.Exit(code)
+}
+
+// dryRunEfi records EFI variable changes and answers reads with them
+type dryRunEfi struct {
+	EfiStore
+	rec  *dryRunSystem
+	vars map[efivarfs.VarID]*dryRunVar
+}
+
+type dryRunVar struct {
+	attrs   efivarfs.Attributes
+	data    []byte
+	deleted bool
+}
+
+func (e *dryRunEfi) ListName(name string) ([]efivarfs.VarID, error) {
+	vars, err := e.EfiStore.ListName(name)
+	if err != nil {
+		return nil, err
+	}
+	var list []efivarfs.VarID
+	for _, v := range vars {
+		if w, ok := e.vars[v]; !ok || !w.deleted {
+			list = append(list, v)
+		}
+	}
+	for v, w := range e.vars {
+		if v.Name == name && !w.deleted && !slices.Contains(vars, v) {
+			list = append(list, v)
+		}
+	}
+	slices.SortFunc(list, func(a, b efivarfs.VarID) int { return strings.Compare(a.FileName(), b.FileName()) })
+	return list, nil
+}
+
+func (e *dryRunEfi) Read(v efivarfs.VarID) (efivarfs.Attributes, []byte, error) {
+	w, ok := e.vars[v]
+	switch {
+	case !ok:
+		return e.EfiStore.Read(v)
+	case w.deleted:
+		return 0, nil, fmt.Errorf("%s: %w", v, os.ErrNotExist)
+	}
+	return w.attrs, w.data, nil
+}
+
+func (e *dryRunEfi) Write(v efivarfs.VarID, attrs efivarfs.Attributes, data []byte) error {
+	e.rec.step("write EFI variable %s = %q (%s)", v, data, attrs)
+	e.vars[v] = &dryRunVar{attrs: attrs, data: data}
+	return nil
+}
+
+func (e *dryRunEfi) Delete(v efivarfs.VarID) error {
+	if _, _, err := e.Read(v); errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	e.rec.step("delete EFI variable %s", v)
+	e.vars[v] = &dryRunVar{deleted: true}
+	return nil
+}
+
+// dryRunAllocator records the MAC pool operations. Which MAC the pool hands
+// out is only known on a real run; the first one of the pool stands in for it.
+type dryRunAllocator struct {
+	rec  *dryRunSystem
+	pool macpool.Pool
+	next uint64
+}
+
+const dryRunLease = "dry-run"
+
+func (a *dryRunAllocator) Reserve(unit, mac string) (macpool.Lease, error) {
+	if mac != "" {
+		if err := a.pool.Validate(mac); err != nil {
+			return macpool.Lease{}, err
+		}
+		v, _ := macpool.ParseMAC(mac)
+		a.rec.step("reserve %s in the MAC pool for %s", macpool.FormatMAC(v), unit)
+		return macpool.Lease{ID: dryRunLease, Unit: unit, MAC: macpool.FormatMAC(v), State: macpool.StateReserved}, nil
+	}
+	if a.next > a.pool.Last {
+		return macpool.Lease{}, macpool.ErrExhausted
+	}
+	l := macpool.Lease{ID: dryRunLease, Unit: unit, MAC: macpool.FormatMAC(a.next), State: macpool.StateReserved}
+	a.rec.step("reserve the next free MAC of %s for %s (%s stands in for it below)", a.pool, unit, l.MAC)
+	return l, nil
+}
+
+func (a *dryRunAllocator) Commit(l macpool.Lease) error {
+	a.rec.step("commit the MAC lease of %s", l.MAC)
+	return nil
+}
+
+func (a *dryRunAllocator) Release(l macpool.Lease) error {
+	a.rec.step("release the MAC lease of %s", l.MAC)
+	return nil
+}
+
+func (a *dryRunAllocator) Retire(l macpool.Lease) error {
+	a.rec.step("retire %s in the MAC pool (already on %s)", l.MAC, l.Unit)
+	a.next++
+	return nil
+}
+
+func detected(name, value string) {
+	fmt.Printf("  %-24s %s\n", name+":", value)
+}
+
+func detectedErr(name string, err error) {
+	detected(name, colorYellow+"unknown ("+err.Error()+")"+colorReset)
+}
+
+// printDetected prints what the dry run found on the machine before the
+// run goes on to record its plan
+func printDetected(plan provision.Plan, backends []string, baseSerial, sysSerial string) {
+	fmt.Println()
+	fmt.Println(colorBlue + "=== Detected ===" + colorReset)
+	detected("Product", productName)
+	detected("DMI baseboard serial", baseSerial)
+	detected("DMI system serial", sysSerial)
+	values := scannedValues()
+	for _, f := range productRule.Fields {
+		detected("Scanned "+f.Name, values[f.Name])
+	}
+	for _, m := range plan.Mismatches {
+		detected("Mismatch", m)
+	}
+
+	// Сетевые интерфейсы и активный адрес, который восстанавливается после прошивки MAC
+	if ifaces, err := listInterfaces(); err != nil {
+		detectedErr("Interfaces", err)
+	} else {
+		for _, iface := range ifaces {
+			mark := ""
+			if strings.EqualFold(iface[1], mac) {
+				mark = " (target MAC)"
+			}
+			detected("Interface "+iface[0], iface[1]+mark)
+		}
+	}
+	if oldIface, oldIP, err := getActiveInterfaceAndIP(); err != nil {
+		detectedErr("Active interface", err)
+	} else {
+		detected("Active interface", oldIface+" "+oldIP)
+	}
+
+	// Загрузочный диск и внешний EFI-раздел для прошивальщика
+	if bootDev, err := findBootDevice(); err != nil {
+		detectedErr("Boot device", err)
+	} else {
+		detected("Boot device", bootDev)
+		targetDevice, targetEfi, err := findExternalEfiPartition(bootDev)
+		switch {
+		case err != nil:
+			detectedErr("External EFI partition", err)
+		case targetEfi == "":
+			detected("External EFI partition", colorYellow+"none"+colorReset)
+		default:
+			detected("External EFI partition", targetEfi+" on "+targetDevice)
+		}
+	}
+
+	// Существующие переменные и записи OneTimeBoot
+	for _, name := range []string{efiSNName, efiMACName} {
+		vars, err := efiVars.ListName(name)
+		if err != nil {
+			detectedErr("EFI variables "+name, err)
+			continue
+		}
+		if len(vars) == 0 {
+			detected("EFI variables "+name, "none")
+		}
+		for _, v := range vars {
+			value := ""
+			if _, data, err := efiVars.Read(v); err != nil {
+				value = "read error: " + err.Error()
+			} else {
+				value = fmt.Sprintf("%q", data)
+			}
+			detected("EFI variable", v.String()+" = "+value)
+		}
+	}
+	entries, err := listOneTimeBootEntries()
+	if err != nil {
+		detectedErr("OneTimeBoot entries", err)
+	} else if len(entries) == 0 {
+		detected("OneTimeBoot entries", "none")
+	}
+	for _, e := range entries {
+		state := "kept"
+		if e.Conflicts {
+			state = "conflicts with " + targetBootPath
+		}
+		detected("OneTimeBoot entry", "Boot"+e.BootNum+" ("+state+")")
+	}
+
+	if macAllocation != nil {
+		detected("MAC pool", macAllocation.Pool+" ("+macAllocation.Source+")")
+	}
+	detected("Serial backends", strings.Join(backends, ", "))
+	if slices.Contains(backends, provision.BackendEfivar) {
+		guid := efiVarGUID
+		if guid == "" {
+			guid = productEfiGUID(productRule)
+		}
+		detected("EFI variable GUID", guid)
+	}
+	fmt.Println()
+}
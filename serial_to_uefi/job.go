@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"crycaller/internal/unitrules"
+)
+
+// Unattended mode: the values come from -mb-sn/-io-sn/-mac or a -job file
+// instead of the scanner, nothing is asked on the terminal, the post action
+// is taken from -post-action, progress goes to stderr and stdout carries only
+// the JSON Result. The exit code is the same as in the Result.
+
+// Post actions
+const (
+	postPoweroff = "poweroff"
+	postReboot   = "reboot"
+	postNone     = "none"
+)
+
+// Exit codes
+const (
+	exitOK      = 0
+	exitFailed  = 1 // provisioning failed
+	exitBadArgs = 2 // invalid flags, job file or values
+)
+
+// Job is an MES job file. Flags given on the command line win over it.
+type Job struct {
+	MbSN       string `json:"mb_sn"`
+	IoSN       string `json:"io_sn,omitempty"`
+	MAC        string `json:"mac"`
+	PostAction string `json:"post_action,omitempty"`
+	Operator   string `json:"operator,omitempty"`
+	Station    string `json:"station,omitempty"`
+	Supervisor string `json:"supervisor,omitempty"` // разрешение на повторное использование SN
+}
+
+// Result is the machine-readable outcome of an unattended run
+type Result struct {
+	Success        bool              `json:"success"`
+	ExitCode       int               `json:"exit_code"`
+	DryRun         bool              `json:"dry_run,omitempty"`
+	Action         string            `json:"action,omitempty"`
+	Product        string            `json:"product,omitempty"`
+	MbSN           string            `json:"mb_sn,omitempty"`
+	IoSN           string            `json:"io_sn,omitempty"`
+	MAC            string            `json:"mac,omitempty"`
+	OriginalSerial string            `json:"original_serial,omitempty"`
+	PostAction     string            `json:"post_action"`
+	LogFile        string            `json:"log_file,omitempty"`
+	EfiVerify      []EfiVerification `json:"efi_verify,omitempty"`
+	MacAllocation  *MacAllocation    `json:"mac_allocation,omitempty"`
+	SerialOverride *SerialOverride   `json:"serial_override,omitempty"`
+	Errors         []string          `json:"errors,omitempty"`
+}
+
+var (
+	unattended bool              // значения из флагов/задания, без вопросов оператору
+	postAction string            // -post-action (или из задания), "" – спросить
+	jobValues  map[string]string // значения полей из флагов/задания
+	result     Result            // результат для stdout в unattended-режиме
+	resultOut  io.Writer         // настоящий stdout, когда обычный вывод ушёл в stderr
+	pendingCmd string            // poweroff/reboot, выполняется в exit после вывода результата
+)
+
+// loadJob reads a job file
+func loadJob(path string) (*Job, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, fmt.Errorf("parse %s: %v", path, err)
+	}
+	return &job, nil
+}
+
+// startUnattended switches to unattended mode: stdout is kept for the
+// Result, everything else goes to stderr
+func startUnattended() {
+	if unattended {
+		return
+	}
+	unattended = true
+	resultOut = os.Stdout
+	os.Stdout = os.Stderr
+}
+
+// unattendedArgs reports whether the raw command line has a job or value
+// flag. It decides the mode when the flags cannot be parsed.
+func unattendedArgs(args []string) bool {
+	for _, a := range args {
+		if a == "--" {
+			break
+		}
+		name, _, _ := strings.Cut(strings.TrimLeft(a, "-"), "=")
+		if strings.HasPrefix(a, "-") {
+			switch name {
+			case "job", "mb-sn", "io-sn", "mac":
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// setupJob merges the job file and the value flags. Any of them switches to
+// unattended mode.
+func setupJob(jobFile, mbSNFlag, ioSNFlag, macFlag, postFlag string) error {
+	if jobFile != "" || mbSNFlag != "" || ioSNFlag != "" || macFlag != "" {
+		startUnattended()
+	}
+
+	job := &Job{}
+	if jobFile != "" {
+		var err error
+		if job, err = loadJob(jobFile); err != nil {
+			return fmt.Errorf("job file: %v", err)
+		}
+	}
+	for _, f := range []struct {
+		flag string
+		dst  *string
+	}{
+		{mbSNFlag, &job.MbSN}, {ioSNFlag, &job.IoSN}, {macFlag, &job.MAC}, {postFlag, &job.PostAction},
+	} {
+		if f.flag != "" {
+			*f.dst = f.flag
+		}
+	}
+
+	jobValues = map[string]string{}
+	for field, v := range map[string]string{unitrules.FieldMbSN: job.MbSN, unitrules.FieldIoSN: job.IoSN, unitrules.FieldMAC: job.MAC} {
+		if v = strings.TrimSpace(v); v != "" {
+			jobValues[field] = v
+		}
+	}
+	postAction = strings.ToLower(job.PostAction)
+	switch postAction {
+	case "", postPoweroff, postReboot, postNone:
+	default:
+		return fmt.Errorf("invalid post action %q (want %s, %s or %s)", job.PostAction, postPoweroff, postReboot, postNone)
+	}
+	if unattended && postAction == "" {
+		postAction = postNone
+	}
+	if operatorID == "" {
+		operatorID = job.Operator
+	}
+	if stationID == "" {
+		stationID = job.Station
+	}
+	if supervisorID == "" {
+		supervisorID = job.Supervisor
+	}
+	return nil
+}
+
+// finishPrompt carries out the post action of a finished run. action is what
+// the operator is offered: poweroff (nothing or a failure) or reboot into the
+// flasher. After a failure a reboot is never done.
+func finishPrompt(action string, failed bool) {
+	choice := postAction
+	if choice == "" && dryRun {
+		// Пробный запуск ничего не спрашивает: в плане – предложенное действие
+		choice = action
+	} else if choice == "" {
+		if action == postReboot {
+			fmt.Print("Serial number has been set. Reboot now? (Y/n): ")
+		} else {
+			fmt.Print("Poweroff system now? (Y/n): ")
+		}
+		answer, _ := system.Stdin().ReadString('\n')
+		choice = action
+		if strings.EqualFold(strings.TrimSpace(answer), "n") {
+			choice = postNone
+		}
+	} else if failed && choice == postReboot {
+		choice = postNone
+	}
+	result.PostAction = choice
+
+	switch {
+	case choice == postPoweroff:
+		fmt.Println("Powering off system...")
+	case choice == postReboot:
+		fmt.Println("Rebooting system...")
+	case action == postReboot && !failed:
+		fmt.Println("Please reboot manually to apply changes.")
+	default:
+		fmt.Println("Exiting without powering off. Please shutdown manually.")
+	}
+	if choice != postNone {
+		pendingCmd = choice
+	}
+}
+
+// exit ends the run: in unattended mode the Result goes to stdout first,
+// then the chosen poweroff/reboot is started
+func exit(code int) {
+	settleMACLease(macOnUnit)
+	if unattended && resultOut != nil {
+		writeResult(code)
+	}
+	if pendingCmd != "" {
+		_ = runCommandNoOutput(pendingCmd)
+	}
+	system.Exit(code)
+}
+
+func writeResult(code int) {
+	result.ExitCode = code
+	result.Success = code == exitOK
+	result.Product = productName
+	result.MbSN, result.IoSN, result.MAC = mbSN, ioSN, mac
+	result.EfiVerify = efiVerifications
+	result.MacAllocation = macAllocation
+	result.SerialOverride = serialOverride
+	if result.PostAction == "" {
+		result.PostAction = postNone
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not encode result: %v\n", err)
+		return
+	}
+	fmt.Fprintln(resultOut, string(data))
+}
@@ -2,9 +2,6 @@ package main
 
 import (
 	"bufio"
-	"bytes"
-	"crypto/rand"
-	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"flag"
@@ -12,31 +9,41 @@ import (
 	"io/fs"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
-	"syscall"
 	"time"
+
+	"crycaller/internal/dmi"
+	"crycaller/internal/efivarfs"
+	"crycaller/internal/macpool"
+	"crycaller/internal/provision"
+	"crycaller/internal/safename"
+	"crycaller/internal/unitrules"
 )
 
 const (
-	serialFile = "SERIAL"
-	efiCont    = "ctefi"
-	maxRetries = 3 // Maximum number of retry attempts for critical operations
+	serialFile    = "SERIAL"
+	efiCont       = "ctefi"
+	efiShellEntry = "03-efishell.conf" // systemd-boot entry of the EFI shell flasher
+	maxRetries    = 3                  // Maximum number of retry attempts for critical operations
 )
 
 var (
-	cDir        string // текущая рабочая директория
-	mbSN        string // серийный номер материнской платы (ввод пользователя)
-	ioSN        string // серийный номер IO (для продукта "Silver")
-	mac         string // MAC-адрес (ввод пользователя)
-	rtDrv       string // имя удалённого конфликтующего драйвера
-	productName string // имя продукта из dmidecode (например, "Silver" или "IFMBH610MTPR")
+	cDir        string             // текущая рабочая директория
+	mbSN        string             // серийный номер материнской платы (ввод пользователя)
+	ioSN        string             // серийный номер IO (для продукта "Silver")
+	mac         string             // MAC-адрес (ввод пользователя)
+	rtDrv       string             // имя удалённого конфликтующего драйвера
+	productName string             // имя продукта из dmidecode (например, "Silver" или "IFMBH610MTPR")
+	productRule *unitrules.Product // правила продукта из таблицы (в т.ч. efi_guid)
 
 	// EFI variable configuration
-	guidPrefix string // префикс для GUID переменной UEFI
-	efiVarGUID string // сгенерированный GUID
+	guidPrefix string // устаревший -guid-prefix, только для предупреждения
+	efiVarGUID string // GUID переменных UEFI (-guid, efi_guid продукта или UUIDv5 от имени продукта)
+
+	efiVars EfiStore // запись переменных напрямую через efivarfs (system.EfiVars)
 
 	// Новые параметры для efivar
 	efiSNName  string // имя переменной UEFI для серийного номера
@@ -45,6 +52,15 @@ var (
 	// Новые параметры для логирования
 	logToFile bool   // флаг для сохранения лога в файл
 	logServer string // адрес сервера для отправки лога (формат: user@host:path)
+
+	// Кто и на каком стенде выполняет прошивку (по умолчанию берётся из окружения crycaller)
+	operatorID string
+	stationID  string
+
+	rulesFile string // таблица правил распознавания SN/MAC, общая с crycaller
+
+	backendName string // -backend: переопределяет способ передачи SN прошивальщику
+	dryRun      bool   // -dry-run: только обнаружение и план действий
 )
 
 // ANSI escape sequences для цветного вывода
@@ -59,13 +75,6 @@ const (
 	colorBgGreen = "\033[42m"
 )
 
-// Section represents a section from dmidecode output
-type Section struct {
-	Handle     string                 `json:"handle,omitempty"`
-	Title      string                 `json:"title,omitempty"`
-	Properties map[string]interface{} `json:"properties,omitempty"`
-}
-
 // LogData structure for storing process information
 type LogData struct {
 	Timestamp       string                 `json:"timestamp"`
@@ -80,6 +89,13 @@ type LogData struct {
 	EfiSNVarName    string                 `json:"efi_sn_var_name,omitempty"`  // для SerialNumber
 	EfiMACVarName   string                 `json:"efi_mac_var_name,omitempty"` // для MAC
 	EfiVarGUID      string                 `json:"efi_var_guid,omitempty"`
+	EfiVerify       []EfiVerification      `json:"efi_verify,omitempty"` // чтение записанных переменных обратно
+	Operator        string                 `json:"operator,omitempty"`
+	StationID       string                 `json:"station_id,omitempty"`
+	SessionID       string                 `json:"session_id,omitempty"`
+	MacAllocation   *MacAllocation         `json:"mac_allocation,omitempty"`  // MAC из пула: источник, лизинг, состояние
+	SerialInfo      DecodedSerials         `json:"serial_info,omitempty"`     // расшифровка SN по полям
+	SerialOverride  *SerialOverride        `json:"serial_override,omitempty"` // повторное использование SN с разрешения супервизора
 }
 
 func debugPrint(message string) {
@@ -104,6 +120,7 @@ func criticalError(message string) {
 	fmt.Println(colorBgRed + border + colorReset)
 	fmt.Println(colorBgRed + colorReset)
 	fmt.Println("")
+	result.Errors = append(result.Errors, message)
 }
 
 // Функция для вывода информации об успешном завершении
@@ -127,39 +144,124 @@ func successMessage(message string) {
 }
 
 func main() {
+	run(os.Args[1:])
+}
+
+// run is main without the process around it: flags come from args and the
+// machine is reached only through system, so tests can drive every path.
+func run(args []string) {
+	resetState()
+	flags := flag.NewFlagSet(filepath.Base(os.Args[0]), flag.ContinueOnError)
+
 	// Add flags for logging and EFI variables
-	logFilePtr := flag.Bool("log", true, "Save log to file")
-	logServerPtr := flag.String("server", "", "Server to send log to (format: user@host:path)")
-	guidPrefixPtr := flag.String("guid-prefix", "", "Optional 8-hex-digit prefix for the generated GUID")
-	efiSNPtr := flag.String("efisn", "SerialNumber", "Name of the UEFI variable for Serial Number (default: SerialNumber)")
-	efiMACPtr := flag.String("efimac", "HexMac", "Name of the UEFI variable for MAC Address (default: HexMac)")
-	flag.Parse()
+	logFilePtr := flags.Bool("log", true, "Save log to file")
+	logServerPtr := flags.String("server", "", "Server to send log to (format: user@host:path)")
+	guidPrefixPtr := flags.String("guid-prefix", "", "Deprecated: the GUID is no longer random, see -guid. Only limits -purge-legacy-efivars to GUIDs starting with it")
+	guidPtr := flags.String("guid", "", "Vendor GUID of the EFI variables (default: efi_guid of the product in the rule table, else derived from the product name)")
+	backendPtr := flags.String("backend", "", "Serial backend: file (ctefi/SERIAL), efivar or both (default: backend of the product definition)")
+	listPtr := flags.Bool("list-efivars", false, "List all SerialNumber/HexMac EFI variables with their GUIDs and values, then exit")
+	purgePtr := flags.Bool("purge-legacy-efivars", false, "Remove the SerialNumber/HexMac EFI variables under unknown GUIDs (left by the old random-GUID tool, see -list-efivars), then exit")
+	dryRunPtr := flags.Bool("dry-run", false, "Run detection, print the plan of actions and exit without touching hardware, firmware or NVRAM")
+	efiSNPtr := flags.String("efisn", "SerialNumber", "Name of the UEFI variable for Serial Number (default: SerialNumber)")
+	efiMACPtr := flags.String("efimac", "HexMac", "Name of the UEFI variable for MAC Address (default: HexMac)")
+	operatorPtr := flags.String("operator", os.Getenv("CRYCALLER_OPERATOR"), "Operator badge/ID (default: $CRYCALLER_OPERATOR)")
+	stationPtr := flags.String("station", os.Getenv("CRYCALLER_STATION"), "Station ID (default: $CRYCALLER_STATION)")
+	supervisorPtr := flags.String("supervisor", "", "Supervisor badge/ID that allows re-using a serial number already provisioned on another board")
+	jobPtr := flags.String("job", "", "JSON job file with mb_sn, io_sn, mac, post_action, operator, station, supervisor (unattended mode)")
+	mbSNPtr := flags.String("mb-sn", "", "Motherboard serial number (unattended mode, overrides the job file)")
+	ioSNPtr := flags.String("io-sn", "", "IO board serial number (unattended mode, overrides the job file)")
+	macPtr := flags.String("mac", "", "MAC address (unattended mode, overrides the job file)")
+	postPtr := flags.String("post-action", "", "What to do at the end: poweroff, reboot or none (default: ask; none in unattended mode)")
+	poolPtr := flags.String("mac-pool", macpool.DefaultFile, "MAC pool configuration: OUI, range and ledger file or allocator URL (ignored if the default file is missing)")
+	rulesPtr := flags.String("rules", unitrules.DefaultFile, "Product definitions: DMI match, scanned fields, DMI comparisons, serial backend and MAC tool")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			exit(exitOK)
+		}
+		// До setupJob дело не дошло, но MES всё равно ждёт Result на stdout
+		if unattendedArgs(args) {
+			startUnattended()
+			criticalError("Invalid arguments: " + err.Error())
+		}
+		exit(exitBadArgs)
+	}
 
 	logToFile = *logFilePtr
 	logServer = *logServerPtr
 	guidPrefix = *guidPrefixPtr
 	efiSNName = *efiSNPtr
 	efiMACName = *efiMACPtr
+	operatorID = *operatorPtr
+	stationID = *stationPtr
+	rulesFile = *rulesPtr
+	efiVarGUID = strings.ToLower(*guidPtr)
+	backendName = *backendPtr
+	macPoolFile = *poolPtr
+	supervisorID = *supervisorPtr
+	dryRun = *dryRunPtr
+
+	if err := setupJob(*jobPtr, *mbSNPtr, *ioSNPtr, *macPtr, *postPtr); err != nil {
+		criticalError(err.Error())
+		exit(exitBadArgs)
+	}
+
+	if guidPrefix != "" && !*purgePtr {
+		fmt.Println(colorYellow + "[WARNING] -guid-prefix is ignored, the EFI variable GUID is now fixed per product (see -guid)" + colorReset)
+	}
+	if efiVarGUID != "" {
+		if _, err := efivarfs.ParseGUID(efiVarGUID); err != nil {
+			criticalError("Invalid -guid: " + err.Error())
+			exit(exitFailed)
+		}
+	}
+	if *listPtr {
+		if err := listEfiVars(); err != nil {
+			criticalError("Failed to list EFI variables: " + err.Error())
+			exit(exitFailed)
+		}
+		return
+	}
 
 	// Root privileges are required
-	if os.Geteuid() != 0 {
+	if system.Geteuid() != 0 {
 		criticalError("Please run this program with root privileges")
-		os.Exit(1)
+		exit(exitFailed)
+	}
+	if *purgePtr {
+		if err := purgeLegacyEfiVars(strings.ToLower(guidPrefix)); err != nil {
+			criticalError("Failed to remove legacy EFI variables: " + err.Error())
+			exit(exitFailed)
+		}
+		return
 	}
 
 	var err error
-	cDir, err = os.Getwd()
+	cDir, err = system.Getwd()
 	if err != nil {
 		criticalError("Could not get current directory: " + err.Error())
-		os.Exit(1)
+		exit(exitFailed)
 	}
 
-	fmt.Println(colorBlue + "Starting serial number modification..." + colorReset)
+	if err := openMACPool(); err != nil {
+		criticalError("Invalid MAC pool: " + err.Error())
+		exit(exitFailed)
+	}
+
+	if dryRun {
+		fmt.Println(colorBlue + "Dry run: detecting the system, nothing will be changed" + colorReset)
+		defer func(s System) { system = s }(system)
+		startDryRun()
+	} else {
+		fmt.Println(colorBlue + "Starting serial number modification..." + colorReset)
+	}
 
 	// 1. Read serial numbers and MAC from the user
 	if err := getSerialAndMac(); err != nil {
 		criticalError("Failed to get serial and MAC: " + err.Error())
-		os.Exit(1)
+		if errors.Is(err, errInvalidInput) {
+			exit(exitBadArgs)
+		}
+		exit(exitFailed)
 	}
 
 	debugPrint("User provided MB Serial: " + mbSN)
@@ -168,6 +270,17 @@ func main() {
 	}
 	debugPrint("User provided MAC: " + mac)
 
+	// Серийные номера не должны повторяться без разрешения супервизора
+	if err := checkSerials(); err != nil {
+		criticalError("Serial number rejected: " + err.Error())
+		if !dryRun {
+			if errors.Is(err, errInvalidInput) {
+				exit(exitBadArgs)
+			}
+			exit(exitFailed)
+		}
+	}
+
 	// 2. Get system serial numbers via dmidecode
 	baseSerial, err := getSystemSerial("baseboard")
 	if err != nil {
@@ -183,77 +296,95 @@ func main() {
 		debugPrint("System Serial: " + sysSerial)
 	}
 
-	// Determine if serial number reflashing is required
-	needSerialFlash := false
-
-	// Тщательно проверяем логику сравнения серийных номеров
-	// При этом используем ТОЛЬКО mbSN для сравнения, IO Serial не проверяется
-	if mbSN != baseSerial {
-		needSerialFlash = true
-		debugPrint("Serial flashing is required: current SN does not match requested")
-		debugPrint(fmt.Sprintf("Current baseboard SN: %s, requested mbSN: %s", baseSerial, mbSN))
-	} else {
-		debugPrint("Serial numbers match, no flashing required")
+	// Determine what has to be flashed for this product
+	profile := provision.ProfileFor(productRule)
+	if backendName != "" {
+		profile.Backend = backendName
 	}
-
-	// ioSN не проверяется, он используется только для логов
-	if productName == "Silver" {
-		debugPrint(fmt.Sprintf("IO SN (%s) is only used for logging purposes, not for comparison", ioSN))
-	} else if productName == "IFMBH610MTPR" {
-		// Для IFMBH610MTPR продукта сравниваем только mbSN с baseSerial
-		if mbSN != baseSerial {
-			needSerialFlash = true
-			debugPrint("Serial flashing is required: current SN does not match requested")
-			debugPrint(fmt.Sprintf("Current baseboard SN: %s, requested: %s", baseSerial, mbSN))
-		} else {
-			debugPrint("Serial numbers match, no flashing required")
-		}
+	backends, err := profile.Backends()
+	if err != nil {
+		criticalError(err.Error())
+		exit(exitFailed)
 	}
+	useEfivar := slices.Contains(backends, provision.BackendEfivar)
+	debugPrint(fmt.Sprintf("Serial backends for %s: %s", productName, strings.Join(backends, ", ")))
 
 	// Determine if entered MAC matches what is already present
 	targetMAC := strings.ToLower(mac)
 	macAlreadySet := false
-	if ifaces, err := getInterfacesWithMAC(targetMAC); err == nil && len(ifaces) > 0 {
+	if mac == "" {
+		debugPrint("MAC will be allocated from the pool")
+	} else if ifaces, err := getInterfacesWithMAC(targetMAC); err == nil && len(ifaces) > 0 {
 		macAlreadySet = true
 		debugPrint(fmt.Sprintf("MAC %s is already present on interfaces: %s", targetMAC, strings.Join(ifaces, ", ")))
 	} else {
 		debugPrint(fmt.Sprintf("MAC %s not found in system, flashing is required", targetMAC))
 	}
+	macOnUnit = macAlreadySet
+
+	// MAC из пула (или резерв отсканированного) и проверка по истории прошитых плат
+	if err := reserveMAC(macAlreadySet); err != nil {
+		criticalError("MAC address rejected: " + err.Error())
+		if !dryRun {
+			if errors.Is(err, errInvalidInput) {
+				exit(exitBadArgs)
+			}
+			exit(exitFailed)
+		}
+	}
+
+	plan, err := provision.Decide(profile, provision.Input{
+		Values:     scannedValues(),
+		DMI:        map[string]string{provision.DMIBaseboard: baseSerial, provision.DMISystem: sysSerial},
+		MACPresent: macAlreadySet,
+	})
+	if err != nil {
+		criticalError("Cannot decide what to flash: " + err.Error())
+		exit(exitFailed)
+	}
+	for _, m := range plan.Mismatches {
+		debugPrint("Serial flashing is required: " + m)
+	}
+	if !plan.FlashSerial {
+		debugPrint("Serial numbers match, no flashing required")
+	}
+
+	if dryRun {
+		// Дальше – обычный путь, изменения только записываются в план
+		printDetected(plan, backends, baseSerial, sysSerial)
+		result.DryRun = true
+	}
 
 	// Variable to record performed actions
-	actionPerformed := ""
+	actionPerformed := plan.Action
 	success := true
 
-	reader := bufio.NewReader(os.Stdin)
-
 	// Handle different scenarios based on what needs updating
-	if !needSerialFlash && macAlreadySet {
+	switch {
+	case !plan.FlashSerial && !plan.FlashMAC:
 		// CASE 1: Both serial numbers and MAC already match - no changes needed
-		actionPerformed = "No changes required"
 		successMessage("No reflash required – system already has the correct serial number and MAC address")
 
 		// Create log before completion
 		createOperationLog(actionPerformed, success, baseSerial)
 
-		fmt.Print("Poweroff system now? (Y/n): ")
-		choice, _ := reader.ReadString('\n')
-		choice = strings.TrimSpace(choice)
-		if !strings.EqualFold(choice, "n") {
-			fmt.Println("Powering off system...")
-			_ = runCommandNoOutput("poweroff")
-		} else {
-			fmt.Println("Exiting without powering off. Please shutdown manually.")
-		}
-	} else if !needSerialFlash && !macAlreadySet {
+		finishPrompt(postPoweroff, false)
+	case !plan.FlashSerial:
 		// CASE 2: Serial numbers match but MAC needs updating
-		actionPerformed = "MAC address update only"
 		fmt.Println(colorYellow + "Serial numbers match. Only MAC flash is required." + colorReset)
 
 		// Clear any existing MAC EFI variables
-		if err := clearEfiVariables(efiMACName); err != nil {
-			fmt.Printf(colorYellow+"[WARNING] Failed to clear extra EFI variables for %s: %v\n"+colorReset, efiMACName, err)
-		} else {
-			debugPrint("Cleared extra EFI variables for " + efiMACName)
+		if useEfivar {
+			// GUID переменных фиксирован для продукта
+			if efiVarGUID == "" {
+				efiVarGUID = productEfiGUID(productRule)
+			}
+			debugPrint("EFI variable GUID: " + efiVarGUID)
+			if err := clearEfiVariables(efiMACName); err != nil {
+				fmt.Printf(colorYellow+"[WARNING] Failed to clear extra EFI variables for %s: %v\n"+colorReset, efiMACName, err)
+			} else {
+				debugPrint("Cleared extra EFI variables for " + efiMACName)
+			}
 		}
 
 		// Пытаемся обновить MAC через драйвер с повторными попытками
@@ -261,21 +392,13 @@ func main() {
 			success = false
 			criticalError("MAC address could not be written after multiple attempts. It is recommended to power off the system and diagnose the hardware manually.")
 		} else {
-			// Generate GUID for EFI variables if not already generated
-			if efiVarGUID == "" {
-				efiVarGUID, err = randomGUIDWithPrefix(guidPrefix)
-				if err != nil {
-					fmt.Printf(colorYellow+"[WARNING] Failed to generate GUID: %v\n"+colorReset, err)
-				} else {
-					debugPrint("Generated EFI variable GUID: " + efiVarGUID)
-				}
-			}
-
+			macOnUnit = true
+		}
+		if success && useEfivar {
 			// После успешного обновления MAC, записываем его также в EFI-переменную
-			if efiVarGUID != "" {
-				if err := writeMACToEfiVar(mac); err != nil {
-					fmt.Printf(colorYellow+"[WARNING] Failed to write MAC to EFI variable: %v\n"+colorReset, err)
-				}
+			if err := writeMACToEfiVar(mac); err != nil {
+				success = false
+				criticalError("Failed to write MAC to EFI variable: " + err.Error())
 			}
 		}
 
@@ -286,135 +409,78 @@ func main() {
 			successMessage("MAC address updated successfully")
 		}
 
-		fmt.Print("Poweroff system now? (Y/n): ")
-		choice, _ := reader.ReadString('\n')
-		choice = strings.TrimSpace(choice)
-		if !strings.EqualFold(choice, "n") {
-			fmt.Println("Powering off system...")
-			_ = runCommandNoOutput("poweroff")
-		} else {
-			fmt.Println("Exiting without powering off. Please shutdown manually.")
-		}
-	} else if needSerialFlash {
+		finishPrompt(postPoweroff, !success)
+	default:
 		// CASE 3: Serial numbers need updating (MAC may or may not need updating)
-		// Определяем, какие действия будут выполняться:
-		if !macAlreadySet {
-			actionPerformed = "Serial number and MAC address update"
-		} else {
-			actionPerformed = "Serial number update only"
-		}
 
 		// First, flash MAC if it's not already set
-		if !macAlreadySet {
+		if plan.FlashMAC {
 			if err := writeMAcWithRetries(mac); err != nil {
 				success = false
 				criticalError("MAC address could not be written after multiple attempts. It is recommended to power off the system and diagnose the hardware manually.")
 
 				// Create log before exiting
 				createOperationLog("MAC address update failed", false, baseSerial)
-
-				fmt.Print("Poweroff system now? (Y/n): ")
-				choice, _ := reader.ReadString('\n')
-				choice = strings.TrimSpace(choice)
-				if !strings.EqualFold(choice, "n") {
-					fmt.Println("Powering off system...")
-					_ = runCommandNoOutput("poweroff")
-				} else {
-					fmt.Println("Exiting without powering off. Please shutdown manually.")
-				}
-				os.Exit(1)
+				finishPrompt(postPoweroff, true)
+				exit(exitFailed)
 			}
+			macOnUnit = true
 		} else {
 			fmt.Println(colorGreen + "[INFO] MAC address already set correctly, skipping MAC update." + colorReset)
 		}
 
-		// Clear existing EFI variables for both Serial Number and MAC
-		if err := clearEfiVariables(efiSNName); err != nil {
-			fmt.Printf(colorYellow+"[WARNING] Failed to clear extra EFI variables for %s: %v\n"+colorReset, efiSNName, err)
-		} else {
-			debugPrint("Cleared extra EFI variables for " + efiSNName)
-		}
+		if useEfivar {
+			if efiVarGUID == "" {
+				efiVarGUID = productEfiGUID(productRule)
+			}
+			debugPrint("EFI variable GUID: " + efiVarGUID)
 
-		if err := clearEfiVariables(efiMACName); err != nil {
-			fmt.Printf(colorYellow+"[WARNING] Failed to clear extra EFI variables for %s: %v\n"+colorReset, efiMACName, err)
-		} else {
-			debugPrint("Cleared extra EFI variables for " + efiMACName)
-		}
+			// Clear existing EFI variables for both Serial Number and MAC
+			if err := clearEfiVariables(efiSNName); err != nil {
+				fmt.Printf(colorYellow+"[WARNING] Failed to clear extra EFI variables for %s: %v\n"+colorReset, efiSNName, err)
+			} else {
+				debugPrint("Cleared extra EFI variables for " + efiSNName)
+			}
 
-		// Now update serial number
-		// Generate GUID for EFI variable
-		efiVarGUID, err = randomGUIDWithPrefix(guidPrefix)
-		if err != nil {
-			success = false
-			criticalError("Failed to generate GUID: " + err.Error())
-			os.Exit(1)
+			if err := clearEfiVariables(efiMACName); err != nil {
+				fmt.Printf(colorYellow+"[WARNING] Failed to clear extra EFI variables for %s: %v\n"+colorReset, efiMACName, err)
+			} else {
+				debugPrint("Cleared extra EFI variables for " + efiMACName)
+			}
 		}
-		debugPrint("Generated EFI variable GUID: " + efiVarGUID)
-
-		// Write serial number to EFI variable with retries
-		var serialWriteSuccess bool = false
 
 		// В EFI-переменную и в файл SERIAL всегда записываем только mbSN
 		// ioSN используется только для логов
-
-		for retry := 0; retry < maxRetries; retry++ {
-			if err := writeSerialToEfiVar(mbSN); err != nil {
-				fmt.Printf(colorYellow+"[WARNING] Attempt %d: Failed to write serial to EFI variable: %v"+colorReset+"\n", retry+1, err)
-				if retry == maxRetries-1 {
-					criticalError("Failed to write serial to EFI variable after multiple attempts. It is recommended to power off the system and diagnose the hardware manually.")
-
-					// Create log before exiting
-					createOperationLog("Serial number update failed", false, baseSerial)
-
-					fmt.Print("Poweroff system now? (Y/n): ")
-					choice, _ := reader.ReadString('\n')
-					choice = strings.TrimSpace(choice)
-					if !strings.EqualFold(choice, "n") {
-						fmt.Println("Powering off system...")
-						_ = runCommandNoOutput("poweroff")
-					} else {
-						fmt.Println("Exiting without powering off. Please shutdown manually.")
-					}
-					os.Exit(1)
-				}
-				time.Sleep(500 * time.Millisecond) // Small delay between retries
-				continue
-			}
-
-			// Successfully written, no need to check reading as it causes errors
-			debugPrint("Successfully wrote serial number to EFI variable")
-			serialWriteSuccess = true
-			break
-		}
-
-		if !serialWriteSuccess {
+		if err := writeSerial(plan.Backends, mbSN); err != nil {
 			success = false
-			criticalError("Failed to write serial to EFI variable after multiple attempts")
-			os.Exit(1)
+			criticalError("Failed to write serial number after multiple attempts. It is recommended to power off the system and diagnose the hardware manually.")
+			fmt.Printf(colorYellow+"[WARNING] %v"+colorReset+"\n", err)
+
+			// Create log before exiting
+			createOperationLog("Serial number update failed", false, baseSerial)
+			finishPrompt(postPoweroff, true)
+			exit(exitFailed)
 		}
 
-		// If MAC was successfully set, also write it to EFI variable
-		if !macAlreadySet || macAlreadySet {
-			// Also write MAC to EFI variable regardless
+		// MAC также сохраняется в EFI-переменную
+		if useEfivar {
 			if err := writeMACToEfiVar(mac); err != nil {
-				fmt.Printf(colorYellow+"[WARNING] Failed to write MAC to EFI variable: %v\n"+colorReset, err)
-			} else {
-				debugPrint("Successfully wrote MAC to EFI variable")
-			}
-		}
+				success = false
+				criticalError("Failed to write MAC to EFI variable: " + err.Error())
 
-		// For compatibility with the old method, also write to file (всегда используем mbSN)
-		if err := writeSerialToFile(mbSN); err != nil {
-			fmt.Printf(colorYellow+"[WARNING] Failed to write serial to file: %v"+colorReset+"\n", err)
-		} else {
-			debugPrint(fmt.Sprintf("Successfully wrote mbSN=%s to SERIAL file", mbSN))
+				// Create log before exiting
+				createOperationLog("MAC EFI variable update failed", false, baseSerial)
+				finishPrompt(postPoweroff, true)
+				exit(exitFailed)
+			}
+			debugPrint("Successfully wrote MAC to EFI variable")
 		}
 
 		// Call bootctl function to set up one-time boot entry and reflash EFI
 		if err := bootctl(); err != nil {
 			success = false
 			criticalError("Bootctl error: " + err.Error())
-			os.Exit(1)
+			exit(exitFailed)
 		}
 
 		// Create log before reboot
@@ -425,229 +491,281 @@ func main() {
 		}
 
 		// Request system reboot
-		fmt.Print("Serial number has been set. Reboot now? (Y/n): ")
-		choice, _ := reader.ReadString('\n')
-		choice = strings.TrimSpace(choice)
-		if strings.EqualFold(choice, "n") {
-			fmt.Println("Please reboot manually to apply changes.")
-		} else {
-			fmt.Println("Rebooting system...")
-			_ = runCommandNoOutput("reboot")
-		}
-	} else {
-		// This case should never happen logically, but just in case
-		fmt.Println(colorGreen + "No changes were required. Exiting..." + colorReset)
-		createOperationLog("No changes required", true, baseSerial)
+		finishPrompt(postReboot, false)
 	}
-}
 
-// randomGUIDWithPrefix generates a GUID in the format 8-4-4-4-12 (hex), where
-// the first 8 hex characters can be specified by prefix. The remaining blocks are generated randomly.
-func randomGUIDWithPrefix(prefix string) (string, error) {
-	// Prefix must consist of exactly 8 hex characters.
-	// If empty, generate random 8.
-	if prefix == "" {
-		p, err := randomHex(4) // Generate 4 bytes => 8 hex characters
-		if err != nil {
-			return "", err
-		}
-		prefix = p
-	} else {
-		if len(prefix) != 8 {
-			return "", errors.New("guid-prefix must have exactly 8 hex characters")
-		}
-		if _, err := hex.DecodeString(prefix); err != nil {
-			return "", fmt.Errorf("invalid guid-prefix: %v", err)
-		}
+	if !success {
+		exit(exitFailed)
 	}
+	exit(exitOK)
+}
 
-	// Generate another 4-4-4-12 => 24 hex characters.
-	suffixBytes, err := randomBytes(12)
-	if err != nil {
-		return "", fmt.Errorf("random generation error: %v", err)
+// resetState clears what a previous run left in the package state
+func resetState() {
+	mbSN, ioSN, mac, rtDrv = "", "", "", ""
+	productName, productRule = "", nil
+	efiVerifications = nil
+	efiVars = system.EfiVars()
+	unattended, postAction, jobValues = false, "", nil
+	macAllocator, macPoolRange, macLease, macAllocation, macOnUnit = nil, macpool.Pool{}, nil, nil, false
+	serialOverride, serialInfo = nil, nil
+	result, resultOut, pendingCmd = Result{}, nil, ""
+}
+
+// scannedValues returns the scanned identity by rule-table field name
+func scannedValues() map[string]string {
+	values := map[string]string{unitrules.FieldMbSN: mbSN, unitrules.FieldMAC: mac}
+	if ioSN != "" {
+		values[unitrules.FieldIoSN] = ioSN
 	}
+	return values
+}
 
-	suffixHex := hex.EncodeToString(suffixBytes) // 24 hex characters
+// writeSerial hands the new serial number to the EFI shell flasher through
+// every backend of the product (EFI variable and/or ctefi/SERIAL)
+func writeSerial(backends []string, serial string) error {
+	for _, b := range backends {
+		switch b {
+		case provision.BackendEfivar:
+			// writeSerialToEfiVar сам повторяет запись и проверяет её чтением
+			if err := writeSerialToEfiVar(serial); err != nil {
+				return err
+			}
+			debugPrint("Successfully wrote and verified serial number in EFI variable")
+		case provision.BackendFile:
+			if err := writeSerialToFile(serial); err != nil {
+				return fmt.Errorf("failed to write serial to file: %v", err)
+			}
+			debugPrint(fmt.Sprintf("Successfully wrote mbSN=%s to SERIAL file", serial))
+		}
+	}
+	return nil
+}
 
-	// Split into blocks: 4-4-4-12
-	block1 := suffixHex[0:4]
-	block2 := suffixHex[4:8]
-	block3 := suffixHex[8:12]
-	block4 := suffixHex[12:24]
+// vendorNamespace is the UUIDv5 namespace for GUIDs derived from product names
+var vendorNamespace = efivarfs.MustParseGUID("42773b4d-2327-4d2d-8b01-8a230d6855ae")
 
-	// Form GUID, returning string and nil
-	guid := fmt.Sprintf("%s-%s-%s-%s-%s",
-		strings.ToLower(prefix),
-		block1,
-		block2,
-		block3,
-		block4,
-	)
+// productEfiGUID returns the EFI variable GUID of a product: efi_guid from the
+// rule table if set, otherwise a name-based UUIDv5 of the product name, so every
+// unit of a product always uses the same SerialNumber-<GUID> variable
+func productEfiGUID(p *unitrules.Product) string {
+	if p != nil && p.EfiGUID != "" {
+		return strings.ToLower(p.EfiGUID)
+	}
+	name := productName
+	if p != nil {
+		name = p.Name
+	}
+	return efivarfs.NameGUID(vendorNamespace, name).String()
+}
 
-	return guid, nil
+// efiGUIDOwners maps the GUIDs this tool writes to their owner: the products
+// of the rule table and -guid
+func efiGUIDOwners() map[string]string {
+	owners := map[string]string{}
+	if rules, err := unitrules.LoadOrDefault(rulesFile); err != nil {
+		fmt.Printf(colorYellow+"[WARNING] Failed to load product rules: %v\n"+colorReset, err)
+	} else {
+		for i := range rules.Products {
+			p := &rules.Products[i]
+			owners[productEfiGUID(p)] = p.Name
+		}
+	}
+	if efiVarGUID != "" {
+		owners[efiVarGUID] = "-guid"
+	}
+	return owners
 }
 
-// randomBytes reads n random bytes from crypto/rand
-func randomBytes(n int) ([]byte, error) {
-	b := make([]byte, n)
-	_, err := rand.Read(b)
-	if err != nil {
-		return nil, err
+// listEfiVars prints every SerialNumber/HexMac variable with its GUID and value
+// and marks GUIDs that belong to known products
+func listEfiVars() error {
+	owners := efiGUIDOwners()
+
+	found := 0
+	for _, name := range []string{efiSNName, efiMACName} {
+		vars, err := efiVars.ListName(name)
+		if err != nil {
+			return err
+		}
+		for _, v := range vars {
+			found++
+			value := ""
+			attrs, data, err := efiVars.Read(v)
+			if err != nil {
+				value = colorRed + "read error: " + err.Error() + colorReset
+			} else {
+				value = fmt.Sprintf("%q", data)
+			}
+			owner := owners[v.GUID.String()]
+			if owner == "" {
+				owner = colorYellow + "unknown GUID" + colorReset
+			}
+			fmt.Printf("%-14s %s  %-9s %s  [%s]\n", v.Name, v.GUID, attrs, value, owner)
+		}
+	}
+	if found == 0 {
+		fmt.Printf("No %s/%s variables in %s\n", efiSNName, efiMACName, efiVars)
 	}
-	return b, nil
+	return nil
 }
 
-// randomHex generates n random bytes and returns them in hex form
-func randomHex(n int) (string, error) {
-	b, err := randomBytes(n)
-	if err != nil {
-		return "", err
+// purgeLegacyEfiVars removes the SerialNumber/HexMac variables that
+// -list-efivars marks as "unknown GUID". The old tool wrote them under a new
+// random GUID on every run and never removed them. A random GUID cannot be
+// told from another vendor's, so clearEfiVariables keeps them and this
+// explicit migration step is the only thing that deletes them. With a
+// non-empty prefix (the old -guid-prefix) only GUIDs starting with it go.
+func purgeLegacyEfiVars(prefix string) error {
+	owners := efiGUIDOwners()
+	removed := 0
+	for _, name := range []string{efiSNName, efiMACName} {
+		vars, err := efiVars.ListName(name)
+		if err != nil {
+			return err
+		}
+		for _, v := range vars {
+			guid := v.GUID.String()
+			if owners[guid] != "" || !strings.HasPrefix(guid, prefix) {
+				continue
+			}
+			if err := efiVars.Delete(v); err != nil {
+				return fmt.Errorf("%s: %v", v, err)
+			}
+			fmt.Printf("[INFO] Removed legacy EFI variable: %s\n", v)
+			removed++
+		}
 	}
-	return hex.EncodeToString(b), nil
+	fmt.Printf("Removed %d legacy %s/%s variables from %s\n", removed, efiSNName, efiMACName, efiVars)
+	return nil
 }
 
 // writeSerialToEfiVar writes the serial number to an EFI variable
 func writeSerialToEfiVar(serialNumber string) error {
-	// Create a temporary file to pass data to efivar
-	tmpFile, err := os.CreateTemp("", "serial-*.bin")
+	varName, err := writeEfiVar(efiSNName, serialNumber)
 	if err != nil {
-		return fmt.Errorf("failed to create temporary file: %v", err)
+		return err
 	}
-	defer os.Remove(tmpFile.Name())
-
-	// Write the serial number to the temporary file
-	if _, err := tmpFile.Write([]byte(serialNumber)); err != nil {
-		tmpFile.Close()
-		return fmt.Errorf("failed to write to temporary file: %v", err)
-	}
-	tmpFile.Close()
-
-	// Full variable name
-	varName := fmt.Sprintf("%s-%s", efiVarGUID, efiSNName)
-	debugPrint("Writing to EFI variable: " + varName)
-
-	// Run efivar to write the variable
-	cmd := exec.Command(
-		"efivar",
-		"--write",
-		"--name="+varName,
-		"--attributes=7", // Non-volatile + BootService access + RuntimeService access = 7
-		"--datafile="+tmpFile.Name(),
-	)
-
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("failed to write EFI variable: %v (output: %s)", err, string(out))
-	}
-
 	fmt.Printf(colorGreen+"[INFO] Successfully wrote serial number to EFI variable '%s'\n"+colorReset, varName)
 	return nil
 }
 
 // writeMACToEfiVar writes the MAC address to an EFI variable
 func writeMACToEfiVar(macAddress string) error {
-	// Create a temporary file to pass data to efivar
-	tmpFile, err := os.CreateTemp("", "mac-*.bin")
+	varName, err := writeEfiVar(efiMACName, macAddress)
 	if err != nil {
-		return fmt.Errorf("failed to create temporary file: %v", err)
-	}
-	defer os.Remove(tmpFile.Name())
-
-	// Write the MAC address to the temporary file
-	if _, err := tmpFile.Write([]byte(macAddress)); err != nil {
-		tmpFile.Close()
-		return fmt.Errorf("failed to write to temporary file: %v", err)
+		return err
 	}
-	tmpFile.Close()
+	fmt.Printf(colorGreen+"[INFO] Successfully wrote MAC address to EFI variable '%s'\n"+colorReset, varName)
+	return nil
+}
 
-	// Full variable name
-	varName := fmt.Sprintf("%s-%s", efiVarGUID, efiMACName)
-	debugPrint("Writing to EFI variable: " + varName)
+// EfiVerification is the read-back result of one EFI variable write
+type EfiVerification struct {
+	Variable   string `json:"variable"`
+	Expected   string `json:"expected"`
+	Actual     string `json:"actual,omitempty"`
+	Attributes string `json:"attributes,omitempty"`
+	Verified   bool   `json:"verified"`
+	Attempts   int    `json:"attempts"`
+	RolledBack bool   `json:"rolled_back,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
 
-	// Run efivar to write the variable
-	cmd := exec.Command(
-		"efivar",
-		"--write",
-		"--name="+varName,
-		"--attributes=7", // Non-volatile + BootService access + RuntimeService access = 7
-		"--datafile="+tmpFile.Name(),
-	)
+// efiVerifications collects verification results for LogData
+var efiVerifications []EfiVerification
 
-	out, err := cmd.CombinedOutput()
+// writeEfiVar writes value to <name>-<efiVarGUID> through efivarfs with the
+// attributes efivar used to set (NV|BS|RT), reads it back and retries on a
+// mismatch. If the last attempt still does not match, the variable is
+// deleted so the firmware never sees wrong bytes. Returns the variable name.
+func writeEfiVar(name, value string) (string, error) {
+	guid, err := efivarfs.ParseGUID(efiVarGUID)
 	if err != nil {
-		return fmt.Errorf("failed to write EFI variable: %v (output: %s)", err, string(out))
+		return "", err
 	}
+	v := efivarfs.VarID{Name: name, GUID: guid}
+	res := EfiVerification{Variable: v.String(), Expected: value}
+
+	for res.Attempts < maxRetries {
+		res.Attempts++
+		debugPrint(fmt.Sprintf("Writing to EFI variable: %s (attempt %d)", v, res.Attempts))
+		if err = efiVars.Write(v, efivarfs.DefaultAttributes, []byte(value)); err != nil {
+			err = fmt.Errorf("failed to write EFI variable: %v", err)
+		} else if err = verifyEfiVar(v, value, &res); err == nil {
+			res.Verified = true
+			res.Error = ""
+			efiVerifications = append(efiVerifications, res)
+			debugPrint("Verified EFI variable " + v.String())
+			return v.String(), nil
+		}
+		res.Error = err.Error()
+		fmt.Printf(colorYellow+"[WARNING] Attempt %d: %s: %v"+colorReset+"\n", res.Attempts, v, err)
+		system.Sleep(500 * time.Millisecond) // Small delay between retries
+	}
+
+	// Откат: лучше отсутствующая переменная, чем переменная с неверными данными
+	if derr := efiVars.Delete(v); derr == nil {
+		res.RolledBack = true
+		fmt.Printf(colorYellow+"[WARNING] Rolled back EFI variable %s\n"+colorReset, v)
+	} else if !errors.Is(derr, os.ErrNotExist) {
+		fmt.Printf(colorYellow+"[WARNING] Failed to roll back EFI variable %s: %v\n"+colorReset, v, derr)
+	}
+	efiVerifications = append(efiVerifications, res)
+	return "", fmt.Errorf("%s: %v", v, err)
+}
 
-	fmt.Printf(colorGreen+"[INFO] Successfully wrote MAC address to EFI variable '%s'\n"+colorReset, varName)
+// verifyEfiVar reads the variable back and compares attributes and payload
+func verifyEfiVar(v efivarfs.VarID, value string, res *EfiVerification) error {
+	attrs, data, err := efiVars.Read(v)
+	if err != nil {
+		return fmt.Errorf("read-back failed: %v", err)
+	}
+	res.Attributes = attrs.String()
+	res.Actual = string(data)
+	if attrs != efivarfs.DefaultAttributes {
+		return fmt.Errorf("attributes mismatch: got %s, want %s", attrs, efivarfs.DefaultAttributes)
+	}
+	if string(data) != value {
+		return fmt.Errorf("payload mismatch: got %q, want %q", data, value)
+	}
 	return nil
 }
 
-// writeSerialToFile writes the serial number to the SERIAL file for backward compatibility
+// writeSerialToFile writes the serial number to ctefi/SERIAL (the file backend)
 func writeSerialToFile(serial string) error {
 	filePath := filepath.Join(cDir, efiCont, serialFile)
-	fmt.Printf("[INFO] Writing %s for compatibility...\n", filePath)
-	return os.WriteFile(filePath, []byte(serial), 0644)
+	fmt.Printf("[INFO] Writing %s...\n", filePath)
+	return system.WriteFile(filePath, []byte(serial), 0644)
 }
 
-// clearEfiVariables removes all EFI variable files in /sys/firmware/efi/efivars/
-// whose names start with varName + "-" (e.g. "SerialNumber-*")
+// clearEfiVariables removes the EFI variables called varName under our GUID
+// and the GUIDs of the other known products. Variables of other vendors that
+// happen to use the same name are left alone.
 func clearEfiVariables(varName string) error {
-	// Path to the EFI variables directory
-	efiVarsDir := "/sys/firmware/efi/efivars"
-
-	// Read all entries in the directory
-	entries, err := os.ReadDir(efiVarsDir)
+	vars, err := efiVars.ListName(varName)
 	if err != nil {
-		return fmt.Errorf("failed to read EFI variables directory %s: %v", efiVarsDir, err)
+		return fmt.Errorf("failed to read EFI variables directory %s: %v", efiVars, err)
 	}
 
-	// The target prefix is varName followed by a dash
-	targetPrefix := varName + "-"
-	foundVariables := false
-
-	fmt.Printf("[DEBUG] Looking for EFI variables starting with '%s'\n", targetPrefix)
+	fmt.Printf("[DEBUG] Looking for EFI variables named '%s'\n", varName)
 
-	for _, entry := range entries {
-		fileName := entry.Name()
-		// Check if the variable file name starts with the target prefix
-		if strings.HasPrefix(fileName, targetPrefix) {
-			foundVariables = true
-			fmt.Printf("[DEBUG] Found matching variable: %s\n", fileName)
-
-			// Build the full file path in /sys/firmware/efi/efivars/
-			filePath := filepath.Join(efiVarsDir, fileName)
-
-			// First try to remove the immutable attribute using chattr
-			chattrCmd := exec.Command("chattr", "-i", filePath)
-			chattrOut, chattrErr := chattrCmd.CombinedOutput()
-			if chattrErr != nil {
-				fmt.Printf("[WARNING] Failed to remove immutable attribute from %s: %v\nOutput: %s\n",
-					filePath, chattrErr, string(chattrOut))
-				// Continue anyway - the file might not have the immutable attribute
-			} else {
-				fmt.Printf("[DEBUG] Removed immutable attribute from %s\n", filePath)
-			}
-
-			// Now attempt to delete the file
-			if err := os.Remove(filePath); err != nil {
-				fmt.Printf("[WARNING] Failed to remove EFI variable file %s: %v\n", filePath, err)
-
-				// If direct deletion fails, try using rm command which might have more permissions
-				rmCmd := exec.Command("rm", "-f", filePath)
-				rmOut, rmErr := rmCmd.CombinedOutput()
-				if rmErr != nil {
-					fmt.Printf("[WARNING] Failed to remove EFI variable using rm command: %s: %v\nOutput: %s\n",
-						filePath, rmErr, string(rmOut))
-				} else {
-					fmt.Printf("[INFO] Successfully removed EFI variable file: %s using rm command\n", filePath)
-				}
-			} else {
-				fmt.Printf("[INFO] Successfully removed EFI variable file: %s\n", filePath)
-			}
+	owners := efiGUIDOwners()
+	for _, v := range vars {
+		if owners[v.GUID.String()] == "" {
+			fmt.Printf("[INFO] Keeping EFI variable %s: unknown GUID (see -purge-legacy-efivars)\n", v)
+			continue
+		}
+		fmt.Printf("[DEBUG] Found matching variable: %s\n", v)
+		// Delete clears the immutable attribute first, like chattr -i
+		if err := efiVars.Delete(v); err != nil {
+			fmt.Printf("[WARNING] Failed to remove EFI variable %s: %v\n", v, err)
+		} else {
+			fmt.Printf("[INFO] Successfully removed EFI variable: %s\n", v)
 		}
 	}
 
-	if !foundVariables {
+	if len(vars) == 0 {
 		fmt.Printf("[INFO] No existing EFI variables found for '%s'\n", varName)
 	}
 
@@ -657,6 +775,8 @@ func clearEfiVariables(varName string) error {
 // Function to create and save operation log
 func createOperationLog(action string, success bool, originalSerial string) {
 	fmt.Println(colorBlue + "Creating operation log..." + colorReset)
+	result.Action, result.OriginalSerial = action, originalSerial
+	settleMACLease(macOnUnit)
 
 	// Get full dmidecode output
 	dmidecodeOutput, err := runCommand("dmidecode")
@@ -666,47 +786,11 @@ func createOperationLog(action string, success bool, originalSerial string) {
 	}
 
 	// Parse dmidecode output
-	sections, err := parseDmidecodeOutput(dmidecodeOutput)
+	sections, err := dmi.Parse(dmidecodeOutput)
 	if err != nil {
 		fmt.Printf(colorYellow+"[WARNING] Could not parse dmidecode output: %v"+colorReset, err)
 	}
-
-	// Convert sections to a map for JSON
-	systemInfo := make(map[string]interface{})
-	for _, sec := range sections {
-		key := sec.Title
-		if key == "" {
-			key = sec.Handle // Use handle if title is empty
-		}
-
-		sectionData := make(map[string]interface{})
-		if sec.Handle != "" {
-			sectionData["handle"] = sec.Handle
-		}
-
-		// Only include properties if they are not empty
-		if len(sec.Properties) > 0 {
-			sectionData["properties"] = sec.Properties
-		}
-
-		// If such a key already exists, convert value to an array or add to existing array
-		if existing, exists := systemInfo[key]; exists {
-			switch v := existing.(type) {
-			case map[string]interface{}:
-				// If we already have one section with this title, create an array of two elements
-				systemInfo[key] = []interface{}{v, sectionData}
-			case []interface{}:
-				// If we already have an array of sections with this title, add to it
-				systemInfo[key] = append(v, sectionData)
-			default:
-				// For other cases (e.g., if for some reason the value is not a map or slice)
-				systemInfo[key] = []interface{}{existing, sectionData}
-			}
-		} else {
-			// If the key doesn't exist yet, just add the section as is
-			systemInfo[key] = sectionData
-		}
-	}
+	systemInfo := dmi.SystemInfo(sections)
 
 	// Create log data structure
 	timestamp := time.Now().Format("2006-01-02T15:04:05")
@@ -723,6 +807,13 @@ func createOperationLog(action string, success bool, originalSerial string) {
 		EfiSNVarName:    efiSNName,
 		EfiMACVarName:   efiMACName,
 		EfiVarGUID:      efiVarGUID,
+		EfiVerify:       efiVerifications,
+		Operator:        operatorID,
+		StationID:       stationID,
+		SessionID:       os.Getenv("CRYCALLER_SESSION"),
+		MacAllocation:   macAllocation,
+		SerialInfo:      serialInfo,
+		SerialOverride:  serialOverride,
 	}
 
 	// Convert to JSON
@@ -734,7 +825,12 @@ func createOperationLog(action string, success bool, originalSerial string) {
 
 	// Generate filename for the log
 	timeFormat := time.Now().Format("060102150405") // YYMMDDHHMMSS
-	filename := fmt.Sprintf("%s_%s-%s.json", productName, mbSN, timeFormat)
+	filename := fmt.Sprintf("%s_%s-%s", safename.Clean(productName), safename.Clean(mbSN), timeFormat)
+	// Станция и оператор в имени файла, если известны
+	if stamp := safename.Join(stationID, operatorID); stamp != "" {
+		filename += "_" + stamp
+	}
+	filename += ".json"
 
 	// Save log to file if flag is set
 	var logSaved bool = false
@@ -747,19 +843,20 @@ func createOperationLog(action string, success bool, originalSerial string) {
 		if logToFile {
 			logDir := filepath.Join(cDir, "logs")
 			// Create log directory if it doesn't exist
-			if _, err := os.Stat(logDir); os.IsNotExist(err) {
-				if err := os.Mkdir(logDir, 0755); err != nil {
+			if _, err := system.Stat(logDir); os.IsNotExist(err) {
+				if err := system.Mkdir(logDir, 0755); err != nil {
 					fmt.Printf(colorYellow+"[WARNING] Could not create log directory: %v. Retry attempt %d/%d"+colorReset, err, logRetries, maxLogRetries)
 					logDir = cDir
 				}
 			}
 
 			logPath := filepath.Join(logDir, filename)
-			if err := os.WriteFile(logPath, jsonData, 0644); err != nil {
+			if err := system.WriteFile(logPath, jsonData, 0644); err != nil {
 				fmt.Printf(colorYellow+"[WARNING] Could not write log file: %v. Retry attempt %d/%d\n"+colorReset, err, logRetries, maxLogRetries)
-				time.Sleep(500 * time.Millisecond) // Small delay between retries
+				system.Sleep(500 * time.Millisecond) // Small delay between retries
 			} else {
 				fmt.Printf(colorGreen+"[INFO] Log saved to: %s\n"+colorReset, logPath)
+				result.LogFile = logPath
 				logSaved = true
 			}
 		} else {
@@ -770,10 +867,11 @@ func createOperationLog(action string, success bool, originalSerial string) {
 	if !logSaved && logToFile {
 		// Final attempt to save locally in the current directory if all retries failed
 		emergencyLogPath := filepath.Join(cDir, filename)
-		if err := os.WriteFile(emergencyLogPath, jsonData, 0644); err != nil {
+		if err := system.WriteFile(emergencyLogPath, jsonData, 0644); err != nil {
 			criticalError("Failed to save log after multiple attempts. Final error: " + err.Error())
 		} else {
 			fmt.Printf(colorYellow+"[ATTENTION] Log could not be saved to logs directory after %d attempts. Emergency save to current directory: %s\n"+colorReset, maxLogRetries, emergencyLogPath)
+			result.LogFile = emergencyLogPath
 			logSaved = true
 		}
 	}
@@ -786,23 +884,20 @@ func createOperationLog(action string, success bool, originalSerial string) {
 		for !serverLogSent && serverRetries < maxLogRetries {
 			serverRetries++
 
-			// Create temporary file
-			tempFile, err := os.CreateTemp("", "serial-log-*.json")
+			// Write JSON to a temporary file named like the log
+			tempDir, err := system.MkdirTemp("", "serial-log")
 			if err != nil {
-				fmt.Printf(colorYellow+"[WARNING] Could not create temporary file for log: %v. Retry attempt %d/%d"+colorReset, err, serverRetries, maxLogRetries)
-				time.Sleep(500 * time.Millisecond)
+				fmt.Printf(colorYellow+"[WARNING] Could not create temporary directory for log: %v. Retry attempt %d/%d"+colorReset, err, serverRetries, maxLogRetries)
+				system.Sleep(500 * time.Millisecond)
 				continue
 			}
-
-			// Write JSON to file
-			if _, err := tempFile.Write(jsonData); err != nil {
+			tempFile := filepath.Join(tempDir, filename)
+			if err := system.WriteFile(tempFile, jsonData, 0644); err != nil {
 				fmt.Printf(colorYellow+"[WARNING] Could not write to temporary file: %v. Retry attempt %d/%d"+colorReset, err, serverRetries, maxLogRetries)
-				tempFile.Close()
-				os.Remove(tempFile.Name())
-				time.Sleep(500 * time.Millisecond)
+				system.RemoveAll(tempDir)
+				system.Sleep(500 * time.Millisecond)
 				continue
 			}
-			tempFile.Close()
 
 			// Parse server string to host and path
 			var host, remotePath string
@@ -819,9 +914,7 @@ func createOperationLog(action string, success bool, originalSerial string) {
 				remotePath = strings.TrimSuffix(remotePath, "/")
 
 				// Create directory on remote server
-				mkdirCmd := exec.Command("ssh", host, "mkdir", "-p", remotePath)
-				_, err := mkdirCmd.CombinedOutput()
-				if err != nil {
+				if _, err := runCommand("ssh", host, "mkdir", "-p", remotePath); err != nil {
 					fmt.Printf(colorYellow+"[WARNING] Could not create remote directory: %v. Retry attempt %d/%d"+colorReset, err, serverRetries, maxLogRetries)
 				}
 			}
@@ -835,15 +928,14 @@ func createOperationLog(action string, success bool, originalSerial string) {
 			}
 
 			// Send file to server using SCP
-			cmd := exec.Command("scp", tempFile.Name(), destination)
-			output, err := cmd.CombinedOutput()
+			output, err := runCommand("scp", tempFile, destination)
 
 			// Clean up temporary file regardless of the result
-			os.Remove(tempFile.Name())
+			system.RemoveAll(tempDir)
 
 			if err != nil {
 				fmt.Printf(colorYellow+"[WARNING] Could not send log to server: %v\nOutput: %s\nRetry attempt %d/%d\n"+colorReset, err, output, serverRetries, maxLogRetries)
-				time.Sleep(1 * time.Second) // Longer delay for network operations
+				system.Sleep(1 * time.Second) // Longer delay for network operations
 			} else {
 				fmt.Printf(colorGreen+"[INFO] Log sent to server: %s\n"+colorReset, destination)
 				serverLogSent = true
@@ -857,119 +949,6 @@ func createOperationLog(action string, success bool, originalSerial string) {
 	}
 }
 
-// parseDmidecodeOutput parses dmidecode output and splits it into sections
-func parseDmidecodeOutput(output string) ([]Section, error) {
-	var sections []Section
-	var currentSection *Section
-	expectingTitle := false
-	var currentPropKey string
-
-	// Collect header lines (until the first line starting with "Handle")
-	headerLines := []string{}
-	inHeader := true
-
-	scanner := bufio.NewScanner(strings.NewReader(output))
-	for scanner.Scan() {
-		line := scanner.Text()
-		trimmed := strings.TrimSpace(line)
-		if trimmed == "" {
-			continue
-		}
-
-		if inHeader {
-			if strings.HasPrefix(line, "Handle") {
-				// If the header is not empty, add it as a section with "Header" title
-				if len(headerLines) > 0 {
-					headerSection := Section{
-						Title: "Header",
-						Properties: map[string]interface{}{
-							"Content": strings.Join(headerLines, "\n"),
-						},
-					}
-					sections = append(sections, headerSection)
-				}
-				inHeader = false
-				// Process the current line as the beginning of a section
-			} else {
-				headerLines = append(headerLines, line)
-				continue
-			}
-		}
-
-		// Start a new section
-		if strings.HasPrefix(line, "Handle") {
-			if currentSection != nil {
-				// If title is empty, use handle value as title
-				if currentSection.Title == "" {
-					currentSection.Title = currentSection.Handle
-				}
-				sections = append(sections, *currentSection)
-			}
-			currentSection = &Section{
-				Handle:     strings.TrimPrefix(line, "Handle "),
-				Properties: make(map[string]interface{}),
-			}
-			expectingTitle = true
-			currentPropKey = ""
-			continue
-		}
-
-		// If title is expected, assign the current line as section title
-		if expectingTitle {
-			currentSection.Title = trimmed
-			expectingTitle = false
-			continue
-		}
-
-		// Process lines with properties
-		if colonIndex := strings.Index(trimmed, ":"); colonIndex != -1 {
-			key := strings.TrimSpace(trimmed[:colonIndex])
-			value := strings.TrimSpace(trimmed[colonIndex+1:])
-			if existing, ok := currentSection.Properties[key]; ok {
-				// If the property already exists, convert it to an array
-				switch v := existing.(type) {
-				case []string:
-					currentSection.Properties[key] = append(v, value)
-				case string:
-					currentSection.Properties[key] = []string{v, value}
-				default:
-					currentSection.Properties[key] = value
-				}
-			} else {
-				currentSection.Properties[key] = value
-			}
-			currentPropKey = key
-		} else {
-			// If the line does not contain a colon, assume it is a continuation of the previous property
-			if currentPropKey != "" {
-				if existing, ok := currentSection.Properties[currentPropKey]; ok {
-					if str, ok2 := existing.(string); ok2 {
-						currentSection.Properties[currentPropKey] = str + " " + trimmed
-					} else if arr, ok2 := existing.([]string); ok2 {
-						if len(arr) > 0 {
-							arr[len(arr)-1] = arr[len(arr)-1] + " " + trimmed
-							currentSection.Properties[currentPropKey] = arr
-						} else {
-							currentSection.Properties[currentPropKey] = trimmed
-						}
-					}
-				}
-			}
-		}
-	}
-	if err := scanner.Err(); err != nil {
-		return nil, err
-	}
-	if currentSection != nil {
-		// If title is empty, use handle value as title
-		if currentSection.Title == "" {
-			currentSection.Title = currentSection.Handle
-		}
-		sections = append(sections, *currentSection)
-	}
-	return sections, nil
-}
-
 // bootctl mounts external EFI partition, copies contents of efishell directory (ctefi)
 // and sets one-time boot entry (via setOneTimeBoot). Do not change this function!
 func bootctl() error {
@@ -986,11 +965,11 @@ func bootctl() error {
 	}
 
 	// Mount EFI partition to temporary directory
-	mountPoint, err := os.MkdirTemp("", "efi_mount")
+	mountPoint, err := system.MkdirTemp("", "efi_mount")
 	if err != nil {
 		return fmt.Errorf("Could not create temporary mount point: %v", err)
 	}
-	defer os.RemoveAll(mountPoint)
+	defer system.RemoveAll(mountPoint)
 	debugPrint("targetEFI: " + targetEfi)
 
 	if err := runCommandNoOutput("mount", targetEfi, mountPoint); err != nil {
@@ -1011,10 +990,10 @@ func bootctl() error {
 		return fmt.Errorf("setOneTimeBoot error: %v", err)
 	}
 
-	if err = runCommandNoOutput("bootctl", "set-oneshot", "03-efishell.conf"); err != nil {
+	if err = runCommandNoOutput("bootctl", "set-oneshot", efiShellEntry); err != nil {
 		_ = runCommandNoOutput("umount", mountPoint)
 		criticalError("Failed to set one-time boot entry: " + err.Error())
-		os.Exit(1)
+		exit(exitFailed)
 	} else {
 		debugPrint("One-time boot entry set successfully.")
 	}
@@ -1028,24 +1007,6 @@ func bootctl() error {
 	return nil
 }
 
-func runCommand(name string, args ...string) (string, error) {
-	cmd := exec.Command(name, args...)
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = &out
-	err := cmd.Run()
-	return strings.TrimSpace(out.String()), err
-}
-
-func runCommandNoOutput(name string, args ...string) error {
-	cmd := exec.Command(name, args...)
-	// Do not show full output, keep only debug messages
-	var dummy bytes.Buffer
-	cmd.Stdout = &dummy
-	cmd.Stderr = &dummy
-	return cmd.Run()
-}
-
 func findBootDevice() (string, error) {
 	output, err := runCommand("findmnt", "/", "-o", "SOURCE", "-n")
 	if err != nil {
@@ -1120,47 +1081,95 @@ func findExternalEfiPartition(bootDev string) (string, string, error) {
 	return "", "", nil
 }
 
+// errInvalidInput marks values from flags or the job that do not fit the product
+var errInvalidInput = errors.New("invalid input")
+
 func getSerialAndMac() error {
 	output, err := runCommand("dmidecode", "-t", "system")
 	if err != nil {
 		return fmt.Errorf("dmidecode failed: %v", err)
 	}
-	for _, line := range strings.Split(output, "\n") {
-		if strings.Contains(line, "Product Name") {
-			parts := strings.SplitN(line, ":", 2)
-			if len(parts) == 2 {
-				productName = strings.TrimSpace(parts[1])
-				break
-			}
+	dmiName, _ := dmi.Value(output, "Product Name")
+	if dmiName == "" {
+		return errors.New("Could not determine Product Name. Make sure dmidecode is run with sufficient privileges.")
+	}
+	fmt.Printf("Product Name: %s\n", dmiName)
+
+	rulesPath := rulesFile
+	if !filepath.IsAbs(rulesPath) {
+		rulesPath = filepath.Join(cDir, rulesPath)
+	}
+	rules, err := unitrules.LoadOrDefault(rulesPath)
+	if err != nil {
+		return fmt.Errorf("Failed to load product definitions: %v", err)
+	}
+	product, ok := rules.Detect(dmiLookup())
+	if !ok {
+		return fmt.Errorf("Unknown product %s: no definition in %s matches this board", dmiName, rulesFile)
+	}
+	productRule = product
+	productName = product.Name
+	if productName != dmiName {
+		fmt.Printf("Product definition: %s\n", productName)
+	}
+
+	provided := make(map[string]string)
+
+	// Значения из флагов или задания MES должны подходить под правила продукта
+	for name, v := range jobValues {
+		f, ok := product.Field(name)
+		if !ok {
+			return fmt.Errorf("%w: product %s has no %s field", errInvalidInput, productName, name)
+		}
+		if !f.Match(v) {
+			return fmt.Errorf("%w: %s %q does not match %s", errInvalidInput, name, v, f.Pattern)
 		}
+		provided[name] = v
+		fmt.Printf("%s value taken from the job: %s\n", name, v)
 	}
-	if productName == "" {
-		return errors.New("Could not determine Product Name. Make sure dmidecode is run with sufficient privileges.")
+
+	// Значения, уже отсканированные в crycaller, приходят через окружение
+	for _, f := range product.Fields {
+		if _, ok := provided[f.Name]; ok {
+			continue
+		}
+		if v := strings.TrimSpace(os.Getenv(f.Env)); v != "" && f.Match(v) {
+			provided[f.Name] = v
+			fmt.Printf("%s value taken from $%s: %s\n", f.Name, f.Env, v)
+		}
 	}
-	fmt.Printf("Product Name: %s\n", productName)
-
-	requiredFields := map[string]*regexp.Regexp{}
-	switch productName {
-	case "Silver":
-		requiredFields["mbSN"] = regexp.MustCompile(`^INF00A34[0-9]{7}$`)
-		requiredFields["ioSN"] = regexp.MustCompile(`^INF00A44[0-9]{7}$`)
-		requiredFields["mac"] = regexp.MustCompile(`^([0-9A-Fa-f]{2}:){5}[0-9A-Fa-f]{2}$`)
-	case "IFMBH610MTPR":
-		requiredFields["mbSN"] = regexp.MustCompile(`^INF00A95[0-9]{7}$`)
-		requiredFields["mac"] = regexp.MustCompile(`^([0-9A-Fa-f]{2}:){5}[0-9A-Fa-f]{2}$`)
-	default:
-		return fmt.Errorf("Unknown product name: %s", productName)
+
+	// С пулом MAC не обязателен: его выдаст пул
+	missing := func() []string {
+		var names []string
+		for _, f := range product.Fields {
+			if _, ok := provided[f.Name]; !ok && (f.Name != unitrules.FieldMAC || macAllocator == nil) {
+				names = append(names, f.Name)
+			}
+		}
+		return names
 	}
 
-	fmt.Println("Please enter the following values (the program will automatically detect the type):")
-	for key, regex := range requiredFields {
-		fmt.Printf(" - %s (expected format: %s)\n", key, regex.String())
+	if names := missing(); unattended && len(names) > 0 {
+		return fmt.Errorf("%w: missing %s", errInvalidInput, strings.Join(names, ", "))
 	}
 
-	provided := make(map[string]string)
-	reader := bufio.NewReader(os.Stdin)
+	if len(missing()) > 0 {
+		fmt.Println("Please enter the following values (the program will automatically detect the type):")
+		for _, name := range missing() {
+			f, _ := product.Field(name)
+			fmt.Printf(" - %s (expected format: %s)\n", f.Name, f.Pattern)
+		}
+		if macAllocator != nil {
+			fmt.Println("   MAC will be allocated from the pool unless scanned")
+		}
+	}
+
+	reader := system.Stdin()
+	prompted := false
 
-	for len(provided) < len(requiredFields) {
+	for len(missing()) > 0 {
+		prompted = true
 		fmt.Print("Enter value: ")
 		input, err := reader.ReadString('\n')
 		if err != nil {
@@ -1171,71 +1180,64 @@ func getSerialAndMac() error {
 			fmt.Println("Input cannot be empty. Please re-enter.")
 			continue
 		}
-		matched := false
-		for key, regex := range requiredFields {
-			if _, ok := provided[key]; ok {
-				continue
-			}
-			if regex.MatchString(input) {
-				provided[key] = input
-				fmt.Printf("%s value accepted: %s\n", key, input)
-				matched = true
-				break
-			}
-		}
-		if !matched {
+		if key, ok := product.Classify(input, provided); ok {
+			provided[key] = input
+			fmt.Printf("%s value accepted: %s\n", key, input)
+		} else if err := product.Reject(input, provided); err != nil {
+			fmt.Printf("Input rejected: %v. Please try again.\n", err)
+		} else {
 			fmt.Println("Input does not match any expected format. Please try again.")
 		}
 	}
 
 	// Wait for extra (4th) line input, but no more than 500 ms.
-	if _, err := readLineWithTimeout(500 * time.Millisecond); err != nil {
-		debugPrint("No extra input received within 500ms, proceeding...")
+	if prompted {
+		line, err := system.PendingLine(500 * time.Millisecond)
+		if err != nil {
+			debugPrint("No extra input received within 500ms, proceeding...")
+		} else if key, ok := product.Classify(strings.TrimSpace(line), provided); ok && key == unitrules.FieldMAC {
+			// С пулом ввод заканчивается на серийных номерах, но MAC мог быть отсканирован следом
+			provided[key] = strings.TrimSpace(line)
+			fmt.Printf("%s value accepted: %s\n", key, provided[key])
+		}
 	}
 
-	if val, ok := provided["mbSN"]; ok {
+	if val, ok := provided[unitrules.FieldMbSN]; ok {
 		mbSN = val
 	}
-	if val, ok := provided["ioSN"]; ok {
+	if val, ok := provided[unitrules.FieldIoSN]; ok {
 		ioSN = val
 	}
-	if val, ok := provided["mac"]; ok {
+	if val, ok := provided[unitrules.FieldMAC]; ok {
 		mac = val
 	}
 
 	fmt.Println("Collected data:")
 	fmt.Printf("  mbSN: %s\n", mbSN)
-	if productName == "Silver" {
+	if _, ok := product.Field(unitrules.FieldIoSN); ok {
 		fmt.Printf("  ioSN: %s\n", ioSN)
 	}
-	fmt.Printf("  MAC: %s\n", mac)
+	if mac == "" {
+		fmt.Println("  MAC: from the pool")
+	} else {
+		fmt.Printf("  MAC: %s\n", mac)
+	}
 	return nil
 }
 
-// readLineWithTimeout tries to read a line from os.Stdin with a given timeout.
-// Sets non-blocking mode on descriptor and performs cyclic check.
-func readLineWithTimeout(timeout time.Duration) (string, error) {
-	fd := int(os.Stdin.Fd())
-	// Set non-blocking mode.
-	if err := syscall.SetNonblock(fd, true); err != nil {
-		return "", err
-	}
-	// Restore blocking mode when done.
-	defer syscall.SetNonblock(fd, false)
-
-	reader := bufio.NewReader(os.Stdin)
-	deadline := time.Now().Add(timeout)
-	for {
-		// If there's at least one byte, read the whole line.
-		_, err := reader.Peek(1)
-		if err == nil {
-			return reader.ReadString('\n')
-		}
-		// If time is up, stop waiting.
-		if time.Now().After(deadline) {
-			return "", errors.New("timeout reached")
+// dmiLookup returns a lookup for unitrules.Detect that runs dmidecode once per DMI type
+func dmiLookup() func(dmiType, key string) (string, bool) {
+	outputs := map[string]string{}
+	return func(dmiType, key string) (string, bool) {
+		out, ok := outputs[dmiType]
+		if !ok {
+			var err error
+			if out, err = runCommand("dmidecode", "-t", dmiType); err != nil {
+				debugPrint(fmt.Sprintf("dmidecode -t %s failed: %v", dmiType, err))
+			}
+			outputs[dmiType] = out
 		}
-		time.Sleep(10 * time.Millisecond)
+		return dmi.Value(out, key)
 	}
 }
 
@@ -1244,35 +1246,38 @@ func getSystemSerial(dmiType string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	lines := strings.Split(out, "\n")
-	for _, line := range lines {
-		if strings.Contains(line, "Serial Number:") {
-			parts := strings.SplitN(line, ":", 2)
-			if len(parts) == 2 {
-				return strings.TrimSpace(parts[1]), nil
-			}
-		}
+	if serial, ok := dmi.Value(out, "Serial Number"); ok {
+		return serial, nil
 	}
 	return "", errors.New("Serial Number not found")
 }
 
-func getInterfacesWithMAC(targetMAC string) ([]string, error) {
+// listInterfaces returns [name, MAC] of every Ethernet interface from ip -o link show
+func listInterfaces() ([][2]string, error) {
 	output, err := runCommand("ip", "-o", "link", "show")
 	if err != nil {
 		return nil, fmt.Errorf("Failed to get ip link show: %v", err)
 	}
 	re := regexp.MustCompile(`^\d+:\s+([^:]+):.*link/ether\s+([0-9a-f:]+)`)
-	var interfaces []string
+	var interfaces [][2]string
 	scanner := bufio.NewScanner(strings.NewReader(output))
 	for scanner.Scan() {
-		line := scanner.Text()
-		matches := re.FindStringSubmatch(line)
-		if len(matches) == 3 {
-			iface := matches[1]
-			macFound := matches[2]
-			if strings.ToLower(macFound) == strings.ToLower(targetMAC) {
-				interfaces = append(interfaces, iface)
-			}
+		if matches := re.FindStringSubmatch(scanner.Text()); len(matches) == 3 {
+			interfaces = append(interfaces, [2]string{matches[1], matches[2]})
+		}
+	}
+	return interfaces, nil
+}
+
+func getInterfacesWithMAC(targetMAC string) ([]string, error) {
+	all, err := listInterfaces()
+	if err != nil {
+		return nil, err
+	}
+	var interfaces []string
+	for _, iface := range all {
+		if strings.EqualFold(iface[1], targetMAC) {
+			interfaces = append(interfaces, iface[0])
 		}
 	}
 	if len(interfaces) == 0 {
@@ -1291,12 +1296,16 @@ func writeMAcWithRetries(macInput string) error {
 		return nil
 	}
 
+	// Утилита прошивки MAC берётся из описания продукта (по умолчанию rtnicpg)
+	tool := productRule.MACTool
+	isRtnicpg := tool.Kind == unitrules.MACToolRtnicpg
 	out, err := runCommand("uname", "-m")
 	if err != nil {
 		return fmt.Errorf("Failed to get machine architecture: %v", err)
 	}
 	arch := strings.TrimSpace(out)
-	rtnic := filepath.Join(cDir, "rtnicpg", "rtnicpg-"+arch)
+	toolDir := macToolDir(tool)
+	toolBin, toolArgs := macToolCommand(tool, toolDir, arch, macInput)
 
 	oldIface, oldIP, err := getActiveInterfaceAndIP()
 	if err != nil {
@@ -1305,46 +1314,48 @@ func writeMAcWithRetries(macInput string) error {
 		debugPrint("Old IP address for interface " + oldIface + ": " + oldIP)
 	}
 
-	// First attempt to load the driver as is
-	driverErr := loadDriver()
+	if isRtnicpg {
+		// First attempt to load the driver as is
+		driverErr := loadDriver(tool)
 
-	// If driver loading fails, try recompiling and loading again
-	if driverErr != nil {
-		fmt.Printf(colorYellow+"[WARNING] Initial driver load failed: %v\nAttempting to recompile driver..."+colorReset+"\n", driverErr)
+		// If driver loading fails, try recompiling and loading again
+		if driverErr != nil {
+			fmt.Printf(colorYellow+"[WARNING] Initial driver load failed: %v\nAttempting to recompile driver..."+colorReset+"\n", driverErr)
 
-		// Try to recompile the driver
-		rtnicpgPath := filepath.Join(cDir, "rtnicpg")
-		if info, err := os.Stat(rtnicpgPath); err == nil && info.IsDir() {
-			if err := runCommandNoOutput("make", "-C", rtnicpgPath, "clean", "all"); err != nil {
-				criticalError("Failed to recompile driver: " + err.Error())
-				return err
-			}
-			fmt.Println(colorGreen + "[INFO] Driver recompilation successful." + colorReset)
+			// Try to recompile the driver
+			if info, err := system.Stat(toolDir); err == nil && info.IsDir() {
+				if err := runCommandNoOutput("make", "-C", toolDir, "clean", "all"); err != nil {
+					criticalError("Failed to recompile driver: " + err.Error())
+					return err
+				}
+				fmt.Println(colorGreen + "[INFO] Driver recompilation successful." + colorReset)
 
-			// Try loading the driver again after recompilation
-			if driverErr = loadDriver(); driverErr != nil {
-				criticalError("Failed to load driver even after recompilation: " + driverErr.Error())
-				return driverErr
+				// Try loading the driver again after recompilation
+				if driverErr = loadDriver(tool); driverErr != nil {
+					criticalError("Failed to load driver even after recompilation: " + driverErr.Error())
+					return driverErr
+				}
+			} else {
+				criticalError(toolDir + " directory does not exist, cannot recompile driver")
+				return fmt.Errorf("%s directory does not exist, cannot recompile driver", toolDir)
 			}
-		} else {
-			criticalError("rtnicpg directory does not exist, cannot recompile driver")
-			return fmt.Errorf("rtnicpg directory does not exist, cannot recompile driver")
 		}
 	}
 
-	if err := os.Chmod(rtnic, 0755); err != nil {
-		return fmt.Errorf("Failed to chmod %s: %v", rtnic, err)
+	if toolDir != "" {
+		if err := system.Chmod(toolBin, 0755); err != nil {
+			return fmt.Errorf("Failed to chmod %s: %v", toolBin, err)
+		}
 	}
 
-	modmac := strings.ReplaceAll(macInput, ":", "")
-	fmt.Println(modmac)
+	fmt.Println(toolBin, strings.Join(toolArgs, " "))
 
 	// Try to write MAC with retries
 	var macWriteSuccess bool = false
 	var macWriteErr error
 
 	for attempt := 1; attempt <= maxRetries; attempt++ {
-		macWriteErr = runCommandNoOutput(rtnic, "/efuse", "/nodeid", modmac)
+		macWriteErr = runCommandNoOutput(toolBin, toolArgs...)
 
 		if macWriteErr == nil {
 			fmt.Println(colorGreen + "[INFO] MAC address was successfully written, verifying..." + colorReset)
@@ -1353,23 +1364,22 @@ func writeMAcWithRetries(macInput string) error {
 		} else {
 			fmt.Printf(colorYellow+"[WARNING] Attempt %d: Failed to write MAC: %v\n"+colorReset, attempt, macWriteErr)
 
-			if attempt == 1 {
+			if attempt == 1 && isRtnicpg {
 				// On first failure, try to recompile the driver
 				fmt.Println(colorYellow + "[WARNING] MAC write failed. Attempting to recompile driver and try again..." + colorReset)
-				rtnicpgPath := filepath.Join(cDir, "rtnicpg")
-				if info, err := os.Stat(rtnicpgPath); err == nil && info.IsDir() {
-					if err := runCommandNoOutput("make", "-C", rtnicpgPath, "clean", "all"); err != nil {
+				if info, err := system.Stat(toolDir); err == nil && info.IsDir() {
+					if err := runCommandNoOutput("make", "-C", toolDir, "clean", "all"); err != nil {
 						fmt.Printf(colorYellow+"[WARNING] Failed to recompile driver: %v\n"+colorReset, err)
 					} else {
 						fmt.Println(colorGreen + "[INFO] Driver recompilation successful." + colorReset)
-						if err := loadDriver(); err != nil {
+						if err := loadDriver(tool); err != nil {
 							fmt.Printf(colorYellow+"[WARNING] Failed to reload driver after recompilation: %v\n"+colorReset, err)
 						}
 					}
 				}
 			}
 
-			time.Sleep(1 * time.Second) // Longer delay for hardware operations
+			system.Sleep(1 * time.Second) // Longer delay for hardware operations
 		}
 	}
 
@@ -1378,10 +1388,12 @@ func writeMAcWithRetries(macInput string) error {
 		return fmt.Errorf("Failed to write MAC address after %d attempts: %v", maxRetries, macWriteErr)
 	}
 
-	_ = runCommandNoOutput("rmmod", "pgdrv")
-	if rtDrv != "" {
-		if err := runCommandNoOutput("modprobe", rtDrv); err != nil {
-			fmt.Printf(colorYellow+"[WARNING] Failed to modprobe %s: %v\n"+colorReset, rtDrv, err)
+	if isRtnicpg {
+		_ = runCommandNoOutput("rmmod", tool.Module)
+		if rtDrv != "" {
+			if err := runCommandNoOutput("modprobe", rtDrv); err != nil {
+				fmt.Printf(colorYellow+"[WARNING] Failed to modprobe %s: %v\n"+colorReset, rtDrv, err)
+			}
 		}
 	}
 
@@ -1529,12 +1541,36 @@ func getActiveInterfaceAndIP() (string, string, error) {
 	return currentIface, currentIP, nil
 }
 
-func loadDriver() error {
-	moduleDefault := "pgdrv"
-	modulesToRemove := []string{"r8169", "r8168", "r8125", "r8101"}
+// macToolDir returns the directory of the MAC tool, relative to the working directory
+func macToolDir(tool *unitrules.MACTool) string {
+	if tool.Dir == "" || filepath.IsAbs(tool.Dir) {
+		return tool.Dir
+	}
+	return filepath.Join(cDir, tool.Dir)
+}
+
+// macToolCommand expands {arch}, {mac} and {mac_colon} in the tool's binary and arguments
+func macToolCommand(tool *unitrules.MACTool, dir, arch, macInput string) (string, []string) {
+	r := strings.NewReplacer("{arch}", arch, "{mac}", strings.ReplaceAll(macInput, ":", ""), "{mac_colon}", macInput)
+	bin := r.Replace(tool.Binary)
+	if dir != "" && !filepath.IsAbs(bin) {
+		bin = filepath.Join(dir, bin)
+	}
+	args := make([]string, len(tool.Args))
+	for i, a := range tool.Args {
+		args[i] = r.Replace(a)
+	}
+	return bin, args
+}
+
+// loadDriver unloads the conflicting NIC drivers and loads the rtnicpg module,
+// building it in the tool directory if needed
+func loadDriver(tool *unitrules.MACTool) error {
+	moduleDefault := tool.Module
+	modulesToRemove := tool.Conflicts
 
-	rtnicpgPath := filepath.Join(cDir, "rtnicpg")
-	if info, err := os.Stat(rtnicpgPath); err != nil || !info.IsDir() {
+	rtnicpgPath := macToolDir(tool)
+	if info, err := system.Stat(rtnicpgPath); err != nil || !info.IsDir() {
 		return fmt.Errorf("Directory %s does not exist", rtnicpgPath)
 	}
 
@@ -1566,7 +1602,7 @@ func loadDriver() error {
 	targetModulePath := filepath.Join(rtnicpgPath, targetModule)
 
 	// Check if the driver already exists and is loaded
-	if _, err := os.Stat(targetModulePath); err == nil {
+	if _, err := system.Stat(targetModulePath); err == nil {
 		fmt.Printf("[INFO] Found existing driver file %s. Loading it...\n", targetModulePath)
 		modName := strings.TrimSuffix(targetModule, ".ko")
 		if isModuleLoaded(modName) {
@@ -1588,13 +1624,13 @@ func loadDriver() error {
 	fmt.Println("[INFO] Compilation completed successfully.")
 
 	builtModule := filepath.Join(rtnicpgPath, moduleDefault+".ko")
-	if _, err := os.Stat(builtModule); errors.Is(err, fs.ErrNotExist) {
+	if _, err := system.Stat(builtModule); errors.Is(err, fs.ErrNotExist) {
 		return fmt.Errorf("Compiled module %s not found", builtModule)
 	}
 
 	// Rename the module if necessary
 	if rtDrv != "" {
-		err := os.Rename(builtModule, targetModulePath)
+		err := system.Rename(builtModule, targetModulePath)
 		if err != nil {
 			return fmt.Errorf("Failed to rename %s to %s: %v", builtModule, targetModulePath, err)
 		}
@@ -1626,24 +1662,44 @@ func isModuleLoaded(mod string) bool {
 	return false
 }
 
-// setOneTimeBoot creates a new one-time boot entry and sets BootNext
-func setOneTimeBoot(targetDevice, targetEfi string) error {
-	// Use the regular expression that should not be changed - DO NOT TOUCH!
-	re := regexp.MustCompile(`(?im)^Boot([0-9A-Fa-f]{4})(\*?)\s+OneTimeBoot\t(.+)$`)
+// oneTimeBootRe matches the OneTimeBoot entries in the efibootmgr listing.
+// Use the regular expression that should not be changed - DO NOT TOUCH!
+var oneTimeBootRe = regexp.MustCompile(`(?im)^Boot([0-9A-Fa-f]{4})(\*?)\s+OneTimeBoot\t(.+)$`)
 
-	// Check if there are conflicting entries
+// targetBootPath is the boot path of the OneTimeBoot entry
+const targetBootPath = "\\EFI\\BOOT\\bootx64.efi"
+
+// oneTimeBootEntry is an existing OneTimeBoot entry. Conflicts is set when it
+// has our boot path and has to be removed before a new entry is created.
+type oneTimeBootEntry struct {
+	BootNum   string
+	Conflicts bool
+}
+
+// listOneTimeBootEntries reads the OneTimeBoot entries from efibootmgr
+func listOneTimeBootEntries() ([]oneTimeBootEntry, error) {
 	out, err := runCommand("efibootmgr")
 	if err != nil {
-		return fmt.Errorf("efibootmgr failed: %v", err)
+		return nil, fmt.Errorf("efibootmgr failed: %v", err)
 	}
+	var entries []oneTimeBootEntry
+	for _, match := range oneTimeBootRe.FindAllStringSubmatch(out, -1) {
+		bootNum := match[1]
 
-	// Find only entries that conflict (have the same boot path)
-	matches := re.FindAllStringSubmatch(out, -1)
-
-	// Define the boot path for our new entry
-	targetBootPath := "\\EFI\\BOOT\\bootx64.efi"
+		// Get more detailed info about the entry
+		bootInfo, err := runCommand("efibootmgr", "-v", "-b", bootNum)
+		if err != nil {
+			debugPrint(fmt.Sprintf("[WARNING] Failed to get info for Boot%s: %v", bootNum, err))
+			continue
+		}
+		// Only entries with the same boot path conflict
+		entries = append(entries, oneTimeBootEntry{BootNum: bootNum, Conflicts: strings.Contains(bootInfo, targetBootPath)})
+	}
+	return entries, nil
+}
 
-	// Determine partition number for the new device
+// efiPartitionNumber returns the partition number of targetEfi on targetDevice
+func efiPartitionNumber(targetDevice, targetEfi string) (string, error) {
 	var partition string
 	// For NVMe devices, name looks like "/dev/nvme0n1p1" - parent disk: "/dev/nvme0n1"
 	if strings.Contains(targetDevice, "nvme") {
@@ -1652,28 +1708,34 @@ func setOneTimeBoot(targetDevice, targetEfi string) error {
 		partition = strings.TrimPrefix(targetEfi, targetDevice)
 	}
 	if partition == "" {
-		return errors.New("could not determine partition number from targetEfi")
+		return "", errors.New("could not determine partition number from targetEfi")
 	}
+	return partition, nil
+}
 
-	// Remove only entries that conflict with our target entry
-	for _, match := range matches {
-		bootNum := match[1]
+// setOneTimeBoot creates a new one-time boot entry and sets BootNext
+func setOneTimeBoot(targetDevice, targetEfi string) error {
+	// Check if there are conflicting entries
+	entries, err := listOneTimeBootEntries()
+	if err != nil {
+		return err
+	}
 
-		// Get more detailed info about the entry
-		bootInfo, err := runCommand("efibootmgr", "-v", "-b", bootNum)
-		if err != nil {
-			debugPrint(fmt.Sprintf("[WARNING] Failed to get info for Boot%s: %v", bootNum, err))
-			continue
-		}
+	// Determine partition number for the new device
+	partition, err := efiPartitionNumber(targetDevice, targetEfi)
+	if err != nil {
+		return err
+	}
 
-		// Check if the entry contains the same boot path
-		if strings.Contains(bootInfo, targetBootPath) {
-			debugPrint("[INFO] Removing conflicting OneTimeBoot entry: Boot" + bootNum)
-			if err := runCommandNoOutput("efibootmgr", "-B", "-b", bootNum); err != nil {
-				debugPrint(fmt.Sprintf("[WARNING] Failed to remove Boot%s: %v", bootNum, err))
+	// Remove only entries that conflict with our target entry
+	for _, e := range entries {
+		if e.Conflicts {
+			debugPrint("[INFO] Removing conflicting OneTimeBoot entry: Boot" + e.BootNum)
+			if err := runCommandNoOutput("efibootmgr", "-B", "-b", e.BootNum); err != nil {
+				debugPrint(fmt.Sprintf("[WARNING] Failed to remove Boot%s: %v", e.BootNum, err))
 			}
 		} else {
-			debugPrint("[INFO] Keeping non-conflicting OneTimeBoot entry: Boot" + bootNum)
+			debugPrint("[INFO] Keeping non-conflicting OneTimeBoot entry: Boot" + e.BootNum)
 		}
 	}
 
@@ -1681,27 +1743,24 @@ func setOneTimeBoot(targetDevice, targetEfi string) error {
 
 	debugPrint("[INFO] Creating new OneTimeBoot entry")
 	// Create a new entry without displaying command result
-	createCmd := exec.Command("efibootmgr",
+	createOut, err := runCommand("efibootmgr",
 		"-c",
 		"-d", targetDevice,
 		"-p", partition,
 		"-L", "OneTimeBoot",
 		"-l", targetBootPath)
 	// Hide efibootmgr output, keep only debug messages
-	var createOut bytes.Buffer
-	createCmd.Stdout = &createOut
-	createCmd.Stderr = &createOut
-	if err := createCmd.Run(); err != nil {
-		debugPrint("[ERROR] efibootmgr create output: " + createOut.String())
+	if err != nil {
+		debugPrint("[ERROR] efibootmgr create output: " + createOut)
 		return fmt.Errorf("failed to create new boot entry: %v", err)
 	}
 
 	// Find the created entry with OneTimeBoot label
-	out, err = runCommand("efibootmgr", "-v")
+	out, err := runCommand("efibootmgr", "-v")
 	if err != nil {
 		return fmt.Errorf("efibootmgr failed after creation: %v", err)
 	}
-	matches = re.FindAllStringSubmatch(out, -1)
+	matches := oneTimeBootRe.FindAllStringSubmatch(out, -1)
 	if len(matches) == 0 {
 		return errors.New("new OneTimeBoot entry not found after creation")
 	}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"crycaller/internal/provision"
+	"crycaller/internal/unitrules"
+)
+
+// The logs in testdata were written by the former serial_dir tool. It also
+// compared ioSN with the DMI system serial, so it flashed units whose
+// motherboard serial was already correct. The merged tool must not.
+func TestLegacySerialDirLogs(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.json"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no legacy logs: %v", err)
+	}
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			raw, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var log LogData
+			if err := json.Unmarshal(raw, &log); err != nil {
+				t.Fatal(err)
+			}
+			if log.ActionPerformed != provision.ActionSerialOnly || log.MbSerialNumber != log.OriginalSerial {
+				t.Fatalf("unexpected legacy log: %s, mbSN %s, original %s", log.ActionPerformed, log.MbSerialNumber, log.OriginalSerial)
+			}
+			product, ok := unitrules.Default().Product(log.ProductName)
+			if !ok {
+				t.Fatalf("no definition for %s", log.ProductName)
+			}
+			plan, err := provision.Decide(provision.ProfileFor(product), provision.Input{
+				Values: map[string]string{
+					unitrules.FieldMbSN: log.MbSerialNumber,
+					unitrules.FieldIoSN: log.IoSerialNumber,
+					unitrules.FieldMAC:  log.MacAddress,
+				},
+				DMI:        map[string]string{provision.DMIBaseboard: log.OriginalSerial},
+				MACPresent: true,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if plan.FlashSerial {
+				t.Fatalf("serial would be reflashed: %v", plan.Mismatches)
+			}
+		})
+	}
+}
+
+func TestUnattendedArgs(t *testing.T) {
+	for _, c := range []struct {
+		args []string
+		want bool
+	}{
+		{[]string{"-mac", "00:11:22:33:44:55", "-bogus"}, true},
+		{[]string{"--mb-sn=INF1", "-x"}, true},
+		{[]string{"-job", "job.json"}, true},
+		{[]string{"-operator", "mac", "-bogus"}, false},
+		{[]string{"-bogus", "--", "-mac"}, false},
+		{nil, false},
+	} {
+		if got := unattendedArgs(c.args); got != c.want {
+			t.Errorf("unattendedArgs(%q) = %v, want %v", c.args, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"crycaller/internal/history"
+	"crycaller/internal/macpool"
+)
+
+// MAC pool: with mac_pool.json next to the tool the MAC is no longer typed
+// by hand. It is reserved for the board's mbSN from the ledger or the remote
+// allocator; a scanned MAC is claimed instead and must lie in the pool. The
+// lease is committed once the MAC is on the board and released otherwise.
+// Before a MAC is flashed it is looked up in the logs of flashed units; a
+// pool MAC found there is retired in the allocator and the next one is taken.
+
+// MacAllocation records where the MAC came from, for the operation log
+type MacAllocation struct {
+	Source  string `json:"source"` // ledger или http
+	Pool    string `json:"pool"`
+	Lease   string `json:"lease,omitempty"`
+	MAC     string `json:"mac"`
+	Scanned bool   `json:"scanned"` // MAC отсканирован, а не выдан пулом
+	State   string `json:"state"`   // reserved, committed или released
+	Error   string `json:"error,omitempty"`
+}
+
+var (
+	macPoolFile   string            // -mac-pool: конфигурация пула MAC
+	macAllocator  macpool.Allocator // nil – пул не настроен, MAC вводится вручную
+	macPoolRange  macpool.Pool      // диапазон пула
+	macLease      *macpool.Lease    // зарезервированный MAC, пока не закоммичен/освобождён
+	macAllocation *MacAllocation    // что записать в лог
+	macOnUnit     bool              // MAC уже на плате (был или прошит) – лизинг коммитится
+)
+
+// openMACPool loads the pool configuration. A missing default file means
+// there is no pool; a missing file given with -mac-pool is an error.
+func openMACPool() error {
+	path := macPoolFile
+	if path == "" {
+		return nil
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(cDir, path)
+	}
+	cfg, err := macpool.LoadConfig(path)
+	if errors.Is(err, os.ErrNotExist) && macPoolFile == macpool.DefaultFile {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if macPoolRange, err = cfg.Pool(); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	if macAllocator, err = cfg.Allocator(cDir); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	source := "ledger"
+	if cfg.URL != "" {
+		source = "http"
+	}
+	macAllocation = &MacAllocation{Source: source, Pool: macPoolRange.String()}
+	debugPrint(fmt.Sprintf("MAC pool %s (%s)", macPoolRange, source))
+	return nil
+}
+
+// reserveMAC takes the MAC from the pool, or claims the scanned one, and
+// refuses a MAC that the logs show on another unit. present means the MAC
+// is already on this board, nothing is flashed then.
+func reserveMAC(present bool) error {
+	if macAllocator != nil && !present {
+		scanned := mac != ""
+		lease, err := reservePoolMAC(scanned)
+		if err != nil {
+			return err
+		}
+		macLease = &lease
+		macAllocation.Lease, macAllocation.MAC, macAllocation.Scanned, macAllocation.State = lease.ID, lease.MAC, scanned, lease.State
+		if scanned {
+			fmt.Printf("MAC %s reserved in the pool (lease %s)\n", lease.MAC, lease.ID)
+		} else {
+			mac = lease.MAC
+			result.MAC = mac
+			fmt.Printf(colorGreen+"MAC %s allocated from the pool (lease %s)\n"+colorReset, mac, lease.ID)
+		}
+	}
+	if present {
+		return nil
+	}
+	if err := checkMACHistory(); err != nil {
+		settleMACLease(false)
+		return err
+	}
+	return nil
+}
+
+// maxRetired bounds how many pool MACs one run may retire
+const maxRetired = 16
+
+// reservePoolMAC reserves the scanned MAC or the next free one of the pool.
+// A pool MAC that the logs already show on another unit was flashed outside
+// the pool; it is retired so that no later run gets it, and the next one is
+// reserved instead.
+func reservePoolMAC(scanned bool) (macpool.Lease, error) {
+	for retired := 0; ; retired++ {
+		lease, err := macAllocator.Reserve(mbSN, mac)
+		if err != nil {
+			if errors.Is(err, macpool.ErrTaken) || (scanned && macPoolRange.Validate(mac) != nil) {
+				err = fmt.Errorf("%w: %v", errInvalidInput, err)
+			}
+			return lease, err
+		}
+		if scanned || lease.State == macpool.StateCommitted || retired == maxRetired {
+			return lease, nil
+		}
+		// Ошибку чтения истории сообщит checkMACHistory
+		conflicts, err := macConflicts(lease.MAC)
+		if err != nil || len(conflicts) == 0 {
+			return lease, nil
+		}
+		lease.Unit = conflicts[0].MbSN
+		if err := macAllocator.Retire(lease); err != nil {
+			_ = macAllocator.Release(lease)
+			return macpool.Lease{}, fmt.Errorf("MAC pool: could not retire %s: %v", lease.MAC, err)
+		}
+		fmt.Printf(colorYellow+"[WARNING] MAC %s of the pool was already flashed onto %s, retired it\n"+colorReset, lease.MAC, lease.Unit)
+	}
+}
+
+// macConflicts returns the logs of other units that got mac
+func macConflicts(mac string) ([]history.Record, error) {
+	db, err := history.Load(filepath.Join(cDir, "logs"), cDir)
+	if err != nil {
+		return nil, fmt.Errorf("read the history of flashed units: %v", err)
+	}
+	return db.MACConflicts(mac, mbSN), nil
+}
+
+// checkMACHistory refuses a MAC that was already flashed onto another unit
+func checkMACHistory() error {
+	if mac == "" {
+		return nil
+	}
+	conflicts, err := macConflicts(mac)
+	if err != nil {
+		return err
+	}
+	if len(conflicts) == 0 {
+		return nil
+	}
+	var units []string
+	for _, r := range conflicts {
+		units = append(units, fmt.Sprintf("%s (%s, %s)", r.MbSN, r.Timestamp, filepath.Base(r.File)))
+	}
+	return fmt.Errorf("%w: MAC %s was already flashed onto %s", errInvalidInput, mac, strings.Join(units, ", "))
+}
+
+// settleMACLease commits the lease when the MAC is on the board and releases
+// it otherwise. It is safe to call more than once.
+func settleMACLease(committed bool) {
+	if macLease == nil {
+		return
+	}
+	lease := *macLease
+	macLease = nil
+	if lease.State == macpool.StateCommitted {
+		// Плата уже получала этот MAC раньше
+		macAllocation.State = macpool.StateCommitted
+		return
+	}
+	op, settle := "release", macAllocator.Release
+	macAllocation.State = macpool.StateReleased
+	if committed {
+		op, settle = "commit", macAllocator.Commit
+		macAllocation.State = macpool.StateCommitted
+	}
+	if err := settle(lease); err != nil {
+		macAllocation.Error = err.Error()
+		criticalError(fmt.Sprintf("MAC pool: could not %s %s: %v", op, lease.MAC, err))
+		return
+	}
+	debugPrint(fmt.Sprintf("MAC %s %s in the pool", lease.MAC, macAllocation.State))
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"crycaller/internal/history"
+	"crycaller/internal/unitrules"
+)
+
+// Serial numbers must be unique: before flashing, the scanned serials are
+// looked up in the logs of provisioned units. A serial that another board
+// already got is only accepted with a supervisor's badge (-supervisor, the
+// job file or the prompt), and the override is written to the log.
+
+// SerialOverride records a supervisor's permission to reuse serial numbers
+type SerialOverride struct {
+	Supervisor string   `json:"supervisor"`
+	Serials    []string `json:"serials"`
+	Previous   []string `json:"previous"` // логи прежних прошивок этих SN
+}
+
+// DecodedSerials holds the decode segments of the serials by field name
+type DecodedSerials map[string]map[string]string
+
+var (
+	supervisorID   string          // -supervisor: разрешение на повторное использование SN
+	serialOverride *SerialOverride // что записать в лог
+	serialInfo     DecodedSerials  // расшифровка SN (завод, год, неделя) по полям
+)
+
+// checkSerials decodes the scanned serials and refuses the ones that were
+// already provisioned on another board unless a supervisor overrides it.
+// A dry run only reports.
+func checkSerials() error {
+	values := scannedValues()
+	var serials []string
+	for _, f := range productRule.Fields {
+		v := values[f.Name]
+		if f.Name == unitrules.FieldMAC || v == "" {
+			continue
+		}
+		serials = append(serials, v)
+		if decoded, err := f.DecodeValue(v); err == nil && decoded != nil {
+			if serialInfo == nil {
+				serialInfo = DecodedSerials{}
+			}
+			serialInfo[f.Name] = decoded
+			debugPrint(fmt.Sprintf("%s %s: %v", f.Name, v, decoded))
+		}
+	}
+
+	db, err := history.Load(filepath.Join(cDir, "logs"), cDir)
+	if err != nil {
+		return fmt.Errorf("read the history of provisioned units: %v", err)
+	}
+	uuid, _ := dmiLookup()(unitrules.DMISystem, "UUID")
+	macs := boardMACs()
+	var reused, previous []string
+	for _, sn := range serials {
+		conflicts := db.SerialConflicts(sn, uuid, macs)
+		if len(conflicts) == 0 {
+			continue
+		}
+		reused = append(reused, sn)
+		for _, r := range conflicts {
+			previous = append(previous, filepath.Base(r.File))
+			fmt.Printf(colorYellow+"[WARNING] %s was already provisioned on another board: %s, MAC %s, %s\n"+colorReset, sn, r.Timestamp, r.MAC, filepath.Base(r.File))
+		}
+	}
+	if len(reused) == 0 {
+		return nil
+	}
+	if dryRun {
+		return fmt.Errorf("serial number %s is already in use; a real run needs a supervisor override", strings.Join(reused, ", "))
+	}
+
+	supervisor := supervisorID
+	if supervisor == "" && !unattended {
+		fmt.Print("Re-using a serial number needs a supervisor override. Supervisor badge (empty to abort): ")
+		line, _ := system.Stdin().ReadString('\n')
+		supervisor = strings.TrimSpace(line)
+	}
+	switch {
+	case supervisor == "":
+		return fmt.Errorf("%w: serial number %s is already in use, a supervisor override (-supervisor) is required", errInvalidInput, strings.Join(reused, ", "))
+	case strings.EqualFold(supervisor, operatorID):
+		return fmt.Errorf("%w: the supervisor override must come from someone other than the operator", errInvalidInput)
+	}
+
+	serialOverride = &SerialOverride{Supervisor: supervisor, Serials: reused, Previous: previous}
+	fmt.Printf(colorYellow+"[ATTENTION] Serial number %s re-used with the override of supervisor %s\n"+colorReset, strings.Join(reused, ", "), supervisor)
+	return nil
+}
+
+// boardMACs returns the MACs that tell this board apart when it has no UUID:
+// the MACs on its interfaces and the scanned one. The check runs before a MAC
+// is taken from the pool, and a pool MAC would not tell anyway: the pool gives
+// a serial number the MAC it got before, whichever board that was.
+func boardMACs() []string {
+	var macs []string
+	if ifaces, err := listInterfaces(); err != nil {
+		debugPrint(err.Error())
+	} else {
+		for _, iface := range ifaces {
+			macs = append(macs, iface[1])
+		}
+	}
+	if mac != "" {
+		macs = append(macs, mac)
+	}
+	return macs
+}
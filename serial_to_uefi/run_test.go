@@ -0,0 +1,1012 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"crycaller/internal/efivarfs"
+	"crycaller/internal/macpool"
+	"crycaller/internal/provision"
+)
+
+const (
+	testMbSN = "INF00A340242149"
+	testIoSN = "INF00A441241919"
+	testMAC  = "00:E0:4C:68:2D:2C"
+	oldMAC   = "00:e0:4c:00:00:01"
+)
+
+// exitCode is what fakeSystem.Exit panics with
+type exitCode int
+
+// fakeSystem answers commands with canned outputs and records every call.
+// The MAC tool changes the MAC that `ip -o link show` reports.
+type fakeSystem struct {
+	wd      string
+	efi     *efivarfs.FS
+	stdin   *bufio.Reader
+	euid    int
+	outputs map[string]string // exact command line -> output
+	fail    []string          // commands containing any of these fail
+	mac     string            // current MAC of enp1s0
+	calls   []string
+	onSleep func()
+}
+
+func (f *fakeSystem) Run(name string, args ...string) (string, error) {
+	line := strings.Join(append([]string{name}, args...), " ")
+	f.calls = append(f.calls, line)
+	for _, part := range f.fail {
+		if strings.Contains(line, part) {
+			return "", errors.New("exit status 1")
+		}
+	}
+	switch {
+	case line == "ip -o link show":
+		return "1: lo: <LOOPBACK,UP,LOWER_UP> mtu 65536 qdisc noqueue state UNKNOWN mode DEFAULT\\    link/loopback 00:00:00:00:00:00 brd 00:00:00:00:00:00\n" +
+			"2: enp1s0: <BROADCAST,MULTICAST,UP,LOWER_UP> mtu 1500 qdisc fq_codel state UP mode DEFAULT\\    link/ether " + f.mac + " brd ff:ff:ff:ff:ff:ff", nil
+	case strings.HasSuffix(name, "rtnicpg-x86_64"):
+		// rtnicpg /efuse /nodeid 00E04C682D2C
+		hex := strings.ToLower(args[len(args)-1])
+		var parts []string
+		for i := 0; i+2 <= len(hex); i += 2 {
+			parts = append(parts, hex[i:i+2])
+		}
+		f.mac = strings.Join(parts, ":")
+		return "", nil
+	}
+	return f.outputs[line], nil
+}
+
+func (f *fakeSystem) Stdin() *bufio.Reader { return f.stdin }
+
+// The scanner never sends an extra line in tests
+func (f *fakeSystem) PendingLine(time.Duration) (string, error) {
+	return "", errors.New("timeout reached")
+}
+
+func (f *fakeSystem) Stat(name string) (os.FileInfo, error)     { return os.Stat(name) }
+func (f *fakeSystem) Mkdir(name string, perm os.FileMode) error { return os.Mkdir(name, perm) }
+func (f *fakeSystem) Rename(oldpath, newpath string) error      { return os.Rename(oldpath, newpath) }
+func (f *fakeSystem) Chmod(name string, mode os.FileMode) error { return os.Chmod(name, mode) }
+func (f *fakeSystem) RemoveAll(path string) error               { return os.RemoveAll(path) }
+func (f *fakeSystem) Geteuid() int                              { return f.euid }
+func (f *fakeSystem) Getwd() (string, error)                    { return f.wd, nil }
+func (f *fakeSystem) EfiVars() EfiStore                         { return f.efi }
+func (f *fakeSystem) Exit(code int)                             { panic(exitCode(code)) }
+
+func (f *fakeSystem) MkdirTemp(dir, pattern string) (string, error) {
+	return os.MkdirTemp(dir, pattern)
+}
+
+func (f *fakeSystem) WriteFile(name string, data []byte, perm os.FileMode) error {
+	return os.WriteFile(name, data, perm)
+}
+
+func (f *fakeSystem) Sleep(time.Duration) {
+	if f.onSleep != nil {
+		f.onSleep()
+	}
+}
+
+// ran reports whether a command line containing s was run; tool binaries
+// are run by absolute path
+func (f *fakeSystem) ran(s string) bool {
+	for _, c := range f.calls {
+		if strings.Contains(c, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// newFakeSystem is a Silver board with an rtnicpg setup, a boot disk sda and
+// a flasher stick sdb with an EFI partition and a stale OneTimeBoot entry
+func newFakeSystem(t *testing.T, baseboardSerial string, macPresent bool) *fakeSystem {
+	t.Helper()
+	wd := t.TempDir()
+	for _, dir := range []string{"rtnicpg", efiCont, "efivars"} {
+		if err := os.Mkdir(filepath.Join(wd, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, file := range []string{"rtnicpg/rtnicpg-x86_64", "rtnicpg/r8169_mod_6.1.0.ko"} {
+		if err := os.WriteFile(filepath.Join(wd, file), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, env := range []string{"UNIT_SN", "UNIT_IO_SN", "UNIT_MAC"} {
+		t.Setenv(env, "")
+	}
+
+	f := &fakeSystem{
+		wd:    wd,
+		efi:   efivarfs.New(filepath.Join(wd, "efivars")),
+		stdin: bufio.NewReader(strings.NewReader(testMbSN + "\n" + testIoSN + "\n" + testMAC + "\nn\n")),
+		mac:   oldMAC,
+		outputs: map[string]string{
+			"dmidecode -t system":        "Handle 0x0001, DMI type 1, 27 bytes\nSystem Information\n\tProduct Name: Silver\n\tSerial Number: Default string",
+			"dmidecode -t baseboard":     "Handle 0x0002, DMI type 2, 15 bytes\nBase Board Information\n\tSerial Number: " + baseboardSerial,
+			"uname -m":                   "x86_64",
+			"uname -r":                   "6.1.0",
+			"ip a":                       "2: enp1s0: <BROADCAST,MULTICAST,UP,LOWER_UP> mtu 1500\n    link/ether 00:e0:4c:00:00:01 brd ff:ff:ff:ff:ff:ff\n    inet 10.0.0.5/24 brd 10.0.0.255 scope global enp1s0",
+			"lsmod":                      "Module                  Size  Used by\nr8169                 110592  0",
+			"findmnt / -o SOURCE -n":     "/dev/sda2",
+			"lsblk -d -o NAME,TYPE -rn":  "sda disk\nsdb disk",
+			"lsblk -ln -o NAME /dev/sdb": "sdb\nsdb1",
+			"blkid -o export /dev/sdb1":  "DEVNAME=/dev/sdb1\nTYPE=vfat",
+			"efibootmgr":                 "BootCurrent: 0001\nBoot0001* Linux Boot Manager\tHD(1)\nBoot0003* OneTimeBoot\tHD(1)",
+			"efibootmgr -v -b 0003":      "Boot0003* OneTimeBoot\tHD(1,GPT)/File(\\EFI\\BOOT\\bootx64.efi)",
+			"efibootmgr -v":              "BootNext: 0004\nBoot0004* OneTimeBoot\tHD(1,GPT)/File(\\EFI\\BOOT\\bootx64.efi)",
+		},
+	}
+	if macPresent {
+		f.mac = strings.ToLower(testMAC)
+	}
+	old := system
+	system = f
+	t.Cleanup(func() { system = old })
+	return f
+}
+
+// runMain runs main's body and returns the exit code
+func runMain(args ...string) (code int) {
+	stdout := os.Stdout
+	defer func() {
+		os.Stdout = stdout
+		if r := recover(); r != nil {
+			c, ok := r.(exitCode)
+			if !ok {
+				panic(r)
+			}
+			code = int(c)
+		}
+	}()
+	run(args)
+	return 0
+}
+
+func TestRun(t *testing.T) {
+	cases := []struct {
+		name       string
+		args       []string
+		baseboard  string // DMI baseboard serial
+		macPresent bool
+		euid       int
+		noEFIDisk  bool
+		fail       []string
+
+		wantExit   int
+		wantAction string            // action_performed of the log, "" if no log
+		wantVars   map[string]string // EFI variables that must exist, by name
+		wantSerial bool              // ctefi/SERIAL written
+		wantCalls  []string
+		noCalls    []string
+	}{
+		{
+			name:       "no change",
+			baseboard:  testMbSN,
+			macPresent: true,
+			wantAction: provision.ActionNone,
+			noCalls:    []string{"rmmod", "insmod", filepath.Join("rtnicpg", "rtnicpg-"), "efibootmgr -c", "mount", "poweroff"},
+		},
+		{
+			name:       "MAC only",
+			baseboard:  testMbSN,
+			wantAction: provision.ActionMACOnly,
+			wantVars:   map[string]string{"HexMac": testMAC},
+			wantCalls:  []string{"rmmod r8169", "insmod", "rtnicpg-x86_64 /efuse /nodeid 00E04C682D2C", "rmmod pgdrv", "modprobe r8169", "ip addr add 10.0.0.5/24 dev enp1s0"},
+			noCalls:    []string{"efibootmgr -c", "bootctl"},
+		},
+		{
+			name:       "serial only",
+			baseboard:  "Default string",
+			macPresent: true,
+			wantAction: provision.ActionSerialOnly,
+			wantVars:   map[string]string{"SerialNumber": testMbSN, "HexMac": testMAC},
+			wantSerial: true,
+			wantCalls:  []string{"mount /dev/sdb1", "efibootmgr -B -b 0003", "efibootmgr -c -d /dev/sdb -p 1 -L OneTimeBoot", "efibootmgr -n 0004", "bootctl set-oneshot 03-efishell.conf", "umount"},
+			noCalls:    []string{"insmod", "rtnicpg-x86_64"},
+		},
+		{
+			name:       "serial and MAC",
+			baseboard:  "Default string",
+			wantAction: provision.ActionSerialAndMAC,
+			wantVars:   map[string]string{"SerialNumber": testMbSN, "HexMac": testMAC},
+			wantSerial: true,
+			wantCalls:  []string{"rtnicpg-x86_64 /efuse /nodeid 00E04C682D2C", "efibootmgr -c -d /dev/sdb -p 1", "bootctl set-oneshot 03-efishell.conf"},
+		},
+		{
+			name:       "serial backend file only",
+			args:       []string{"-backend", "file"},
+			baseboard:  "Default string",
+			macPresent: true,
+			wantAction: provision.ActionSerialOnly,
+			wantSerial: true,
+			wantCalls:  []string{"bootctl set-oneshot"},
+		},
+		{
+			name:       "MAC write fails",
+			baseboard:  "Default string",
+			fail:       []string{"rtnicpg-x86_64"},
+			wantExit:   1,
+			wantAction: "MAC address update failed",
+			wantCalls:  []string{"make -C"},
+			noCalls:    []string{"efibootmgr -c", "bootctl"},
+		},
+		{
+			name:       "no external EFI partition",
+			baseboard:  "Default string",
+			macPresent: true,
+			noEFIDisk:  true,
+			wantExit:   1,
+			wantVars:   map[string]string{"SerialNumber": testMbSN, "HexMac": testMAC},
+			wantSerial: true,
+			noCalls:    []string{"mount", "efibootmgr -c", "bootctl"},
+		},
+		{
+			name:       "efibootmgr fails",
+			baseboard:  "Default string",
+			fail:       []string{"efibootmgr -c"},
+			wantExit:   1,
+			wantVars:   map[string]string{"SerialNumber": testMbSN, "HexMac": testMAC},
+			wantSerial: true,
+			noCalls:    []string{"efibootmgr -n", "bootctl"},
+		},
+		{
+			name:     "not root",
+			euid:     1000,
+			wantExit: 1,
+			noCalls:  []string{"dmidecode"},
+		},
+		{
+			name:      "dry run",
+			args:      []string{"-dry-run"},
+			baseboard: "Default string",
+			wantCalls: []string{"efibootmgr", "lsmod"},
+			noCalls:   []string{"rmmod", "insmod", "rtnicpg-x86_64", "mount", "efibootmgr -c", "efibootmgr -B", "bootctl", "poweroff", "reboot"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			f := newFakeSystem(t, c.baseboard, c.macPresent)
+			f.euid = c.euid
+			f.fail = c.fail
+			if c.noEFIDisk {
+				f.outputs["lsblk -d -o NAME,TYPE -rn"] = "sda disk"
+			}
+
+			if code := runMain(c.args...); code != c.wantExit {
+				t.Fatalf("exit code %d, want %d; calls:\n%s", code, c.wantExit, strings.Join(f.calls, "\n"))
+			}
+
+			for _, want := range c.wantCalls {
+				if !f.ran(want) {
+					t.Errorf("%q was not run", want)
+				}
+			}
+			for _, not := range c.noCalls {
+				if f.ran(not) {
+					t.Errorf("%q was run", not)
+				}
+			}
+
+			for _, name := range []string{"SerialNumber", "HexMac"} {
+				vars, err := f.efi.ListName(name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want, ok := c.wantVars[name]
+				switch {
+				case !ok && len(vars) > 0:
+					t.Errorf("unexpected EFI variable %s", vars[0])
+				case ok && len(vars) != 1:
+					t.Errorf("%d %s variables, want 1", len(vars), name)
+				case ok:
+					if _, data, err := f.efi.Read(vars[0]); err != nil || string(data) != want {
+						t.Errorf("%s = %q, %v; want %q", vars[0], data, err, want)
+					}
+				}
+			}
+
+			serial, err := os.ReadFile(filepath.Join(f.wd, efiCont, serialFile))
+			if c.wantSerial != (err == nil) || (err == nil && string(serial) != testMbSN) {
+				t.Errorf("ctefi/SERIAL = %q, %v; want written: %v", serial, err, c.wantSerial)
+			}
+
+			logs, _ := filepath.Glob(filepath.Join(f.wd, "logs", "*.json"))
+			if c.wantAction == "" {
+				if len(logs) > 0 {
+					t.Errorf("unexpected log %s", logs[0])
+				}
+				return
+			}
+			if len(logs) != 1 {
+				t.Fatalf("%d logs, want 1", len(logs))
+			}
+			raw, err := os.ReadFile(logs[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			var entry LogData
+			if err := json.Unmarshal(raw, &entry); err != nil {
+				t.Fatal(err)
+			}
+			if entry.ActionPerformed != c.wantAction || entry.Success != (c.wantExit == 0) {
+				t.Errorf("log action %q success %v, want %q %v", entry.ActionPerformed, entry.Success, c.wantAction, c.wantExit == 0)
+			}
+			if entry.MbSerialNumber != testMbSN || entry.IoSerialNumber != testIoSN || entry.OriginalSerial != c.baseboard {
+				t.Errorf("log identity %s/%s original %s", entry.MbSerialNumber, entry.IoSerialNumber, entry.OriginalSerial)
+			}
+		})
+	}
+}
+
+func TestRunKeepsForeignEfiVars(t *testing.T) {
+	f := newFakeSystem(t, "Default string", false)
+	foreign := efivarfs.VarID{Name: "SerialNumber", GUID: efivarfs.MustParseGUID("8be4df61-93ca-11d2-aa0d-00e098032b8c")}
+	if err := f.efi.Write(foreign, efivarfs.DefaultAttributes, []byte("OTHER")); err != nil {
+		t.Fatal(err)
+	}
+	// Переменная другого известного продукта удаляется
+	stale := efivarfs.VarID{Name: "HexMac", GUID: efivarfs.NameGUID(vendorNamespace, "IFMBH610MTPR")}
+	if err := f.efi.Write(stale, efivarfs.DefaultAttributes, []byte(oldMAC)); err != nil {
+		t.Fatal(err)
+	}
+	if code := runMain(); code != 0 {
+		t.Fatalf("exit code %d; calls:\n%s", code, strings.Join(f.calls, "\n"))
+	}
+
+	if _, data, err := f.efi.Read(foreign); err != nil || string(data) != "OTHER" {
+		t.Errorf("%s of another vendor = %q, %v; want it kept", foreign, data, err)
+	}
+	if _, _, err := f.efi.Read(stale); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("%s of another product: %v; want it deleted", stale, err)
+	}
+	if vars, _ := f.efi.ListName("HexMac"); len(vars) != 1 || vars[0].GUID != efivarfs.NameGUID(vendorNamespace, "Silver") {
+		t.Errorf("HexMac variables %v", vars)
+	}
+}
+
+func TestRunPurgeLegacyEfiVars(t *testing.T) {
+	f := newFakeSystem(t, "Default string", false)
+	legacy := []efivarfs.VarID{
+		{Name: "SerialNumber", GUID: efivarfs.MustParseGUID("1a2b3c4d-0f1e-2d3c-4b5a-696877665544")},
+		{Name: "HexMac", GUID: efivarfs.MustParseGUID("1a2b3c4d-aaaa-bbbb-cccc-ddddeeeeffff")},
+	}
+	other := efivarfs.VarID{Name: "SerialNumber", GUID: efivarfs.MustParseGUID("8be4df61-93ca-11d2-aa0d-00e098032b8c")}
+	known := efivarfs.VarID{Name: "HexMac", GUID: efivarfs.NameGUID(vendorNamespace, "Silver")}
+	for _, v := range append(legacy, other, known) {
+		if err := f.efi.Write(v, efivarfs.DefaultAttributes, []byte("X")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if code := runMain("-purge-legacy-efivars", "-guid-prefix", "1A2B3C4D"); code != 0 {
+		t.Fatalf("exit code %d", code)
+	}
+	for _, v := range legacy {
+		if _, _, err := f.efi.Read(v); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("legacy %s: %v; want it deleted", v, err)
+		}
+	}
+	for _, v := range []efivarfs.VarID{other, known} {
+		if _, _, err := f.efi.Read(v); err != nil {
+			t.Errorf("%s: %v; want it kept", v, err)
+		}
+	}
+	if f.ran("dmidecode") {
+		t.Error("purge went on to provisioning")
+	}
+
+	// Without a prefix every unknown GUID goes
+	if code := runMain("-purge-legacy-efivars"); code != 0 {
+		t.Fatalf("exit code %d", code)
+	}
+	if _, _, err := f.efi.Read(other); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("%s: %v; want it deleted", other, err)
+	}
+	if _, _, err := f.efi.Read(known); err != nil {
+		t.Errorf("%s: %v; want it kept", known, err)
+	}
+
+	f.euid = 1000
+	if code := runMain("-purge-legacy-efivars"); code != exitFailed {
+		t.Errorf("exit code without root %d, want %d", code, exitFailed)
+	}
+}
+
+func TestRunDryRun(t *testing.T) {
+	f := newFakeSystem(t, "Default string", false)
+	stale := efivarfs.VarID{Name: "HexMac", GUID: efivarfs.NameGUID(vendorNamespace, "Silver")}
+	if err := f.efi.Write(stale, efivarfs.DefaultAttributes, []byte(oldMAC)); err != nil {
+		t.Fatal(err)
+	}
+	out, err := os.CreateTemp(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = out
+	code := runMain("-dry-run", "-operator", "op1", "-station", "st1", "-server", "logs@host:/srv/logs")
+	os.Stdout = stdout
+	if code != 0 {
+		t.Fatalf("exit code %d; calls:\n%s", code, strings.Join(f.calls, "\n"))
+	}
+	raw, err := os.ReadFile(out.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, plan, ok := strings.Cut(string(raw), "=== Plan: "+provision.ActionSerialAndMAC+" ===")
+	if !ok {
+		t.Fatalf("no plan in the output:\n%s", raw)
+	}
+
+	// Шаги настоящего запуска в его порядке
+	snVar := efivarfs.VarID{Name: "SerialNumber", GUID: stale.GUID}
+	rest := plan
+	for _, want := range []string{
+		"rmmod r8169",
+		"insmod " + filepath.Join(f.wd, "rtnicpg", "r8169_mod_6.1.0.ko"),
+		"chmod 755 " + filepath.Join(f.wd, "rtnicpg", "rtnicpg-x86_64"),
+		"rtnicpg-x86_64 /efuse /nodeid 00E04C682D2C",
+		"rmmod pgdrv",
+		"modprobe r8169",
+		"ip addr add 10.0.0.5/24 dev enp1s0",
+		"delete EFI variable " + stale.String(),
+		"write EFI variable " + snVar.String() + ` = "` + testMbSN + `"`,
+		`write "` + testMbSN + `" to ` + filepath.Join(f.wd, efiCont, serialFile),
+		"write EFI variable " + stale.String() + ` = "` + testMAC + `"`,
+		"mkdir " + filepath.Join(os.TempDir(), "efi_mountXXXXXX"),
+		"mount /dev/sdb1",
+		"sh -c cp -r ctefi/*",
+		"efibootmgr -B -b 0003",
+		"efibootmgr -c -d /dev/sdb -p 1 -L OneTimeBoot",
+		"efibootmgr -n 0004",
+		"bootctl set-oneshot 03-efishell.conf",
+		"umount",
+		"remove " + filepath.Join(os.TempDir(), "efi_mountXXXXXX"),
+		"mkdir " + filepath.Join(f.wd, "logs"),
+		"_st1_op1.json (",
+		"mkdir " + filepath.Join(os.TempDir(), "serial-logXXXXXX"),
+		"_st1_op1.json (",
+		"ssh logs@host mkdir -p /srv/logs",
+		"scp " + filepath.Join(os.TempDir(), "serial-logXXXXXX") + "/",
+		"remove " + filepath.Join(os.TempDir(), "serial-logXXXXXX"),
+		"reboot",
+		"Dry run finished, nothing was changed.",
+	} {
+		i := strings.Index(rest, want)
+		if i < 0 {
+			t.Fatalf("%q missing or out of order in the plan:\n%s", want, plan)
+		}
+		rest = rest[i+len(want):]
+	}
+	if strings.Contains(plan, "FAIL") {
+		t.Errorf("plan with failures:\n%s", plan)
+	}
+
+	// Ничего не изменено
+	for _, c := range f.calls {
+		if !dryRunReads(strings.Fields(c)[0], strings.Fields(c)[1:]) {
+			t.Errorf("%q was run", c)
+		}
+	}
+	if _, data, err := f.efi.Read(stale); err != nil || string(data) != oldMAC {
+		t.Errorf("%s = %q, %v; want it unchanged", stale, data, err)
+	}
+	if vars, _ := f.efi.ListName("SerialNumber"); len(vars) != 0 {
+		t.Errorf("SerialNumber variables %v", vars)
+	}
+	for _, path := range []string{filepath.Join(efiCont, serialFile), "logs"} {
+		if _, err := os.Stat(filepath.Join(f.wd, path)); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s was created", path)
+		}
+	}
+}
+
+// breakEfiVar makes the read-back of v fail: the file is a link to
+// /dev/null, writes succeed and reads return nothing
+func breakEfiVar(t *testing.T, f *fakeSystem, v efivarfs.VarID) {
+	t.Helper()
+	if err := os.Symlink(os.DevNull, filepath.Join(f.wd, "efivars", v.FileName())); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriteEfiVar(t *testing.T) {
+	setup := func(t *testing.T) (*fakeSystem, efivarfs.VarID) {
+		f := newFakeSystem(t, "Default string", false)
+		resetState()
+		efiVarGUID = efivarfs.NameGUID(vendorNamespace, "Silver").String()
+		t.Cleanup(func() { efiVarGUID = "" })
+		return f, efivarfs.VarID{Name: "HexMac", GUID: efivarfs.NameGUID(vendorNamespace, "Silver")}
+	}
+
+	t.Run("retry", func(t *testing.T) {
+		f, v := setup(t)
+		breakEfiVar(t, f, v)
+		// После первой неудачи переменная снова читается
+		f.onSleep = func() { os.Remove(filepath.Join(f.wd, "efivars", v.FileName())) }
+		if _, err := writeEfiVar("HexMac", testMAC); err != nil {
+			t.Fatal(err)
+		}
+		if r := efiVerifications; len(r) != 1 || !r[0].Verified || r[0].Attempts != 2 || r[0].RolledBack {
+			t.Errorf("verifications %+v", r)
+		}
+		if _, data, err := f.efi.Read(v); err != nil || string(data) != testMAC {
+			t.Errorf("%s = %q, %v", v, data, err)
+		}
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		f, v := setup(t)
+		breakEfiVar(t, f, v)
+		if _, err := writeEfiVar("HexMac", testMAC); err == nil {
+			t.Fatal("a variable that never reads back was accepted")
+		}
+		if r := efiVerifications; len(r) != 1 || r[0].Verified || r[0].Attempts != maxRetries || !r[0].RolledBack {
+			t.Errorf("verifications %+v", r)
+		}
+		if _, err := os.Lstat(filepath.Join(f.wd, "efivars", v.FileName())); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s not rolled back: %v", v, err)
+		}
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		f, v := setup(t)
+		for _, c := range []struct {
+			attrs   efivarfs.Attributes
+			data    string
+			wantErr string
+		}{
+			{efivarfs.DefaultAttributes, testMAC, ""},
+			{efivarfs.DefaultAttributes, oldMAC, "payload mismatch"},
+			{efivarfs.NonVolatile | efivarfs.BootserviceAccess, testMAC, "attributes mismatch"},
+		} {
+			if err := f.efi.Write(v, c.attrs, []byte(c.data)); err != nil {
+				t.Fatal(err)
+			}
+			var res EfiVerification
+			err := verifyEfiVar(v, testMAC, &res)
+			if (c.wantErr == "") != (err == nil) || (err != nil && !strings.Contains(err.Error(), c.wantErr)) {
+				t.Errorf("%s %q: %v, want %q", c.attrs, c.data, err, c.wantErr)
+			}
+			if res.Actual != c.data || res.Attributes != c.attrs.String() {
+				t.Errorf("result %+v", res)
+			}
+		}
+	})
+}
+
+func TestRunEfiMACFails(t *testing.T) {
+	v := efivarfs.VarID{Name: "HexMac", GUID: efivarfs.NameGUID(vendorNamespace, "Silver")}
+	for _, c := range []struct {
+		name, baseboard, action string
+	}{
+		{"MAC only", testMbSN, provision.ActionMACOnly},
+		{"serial and MAC", "Default string", "MAC EFI variable update failed"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			f := newFakeSystem(t, c.baseboard, false)
+			// Каталог вместо файла: очистка его не видит, запись не проходит
+			if err := os.Mkdir(filepath.Join(f.wd, "efivars", v.FileName()), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if code := runMain(); code != exitFailed {
+				t.Fatalf("exit code %d, want %d", code, exitFailed)
+			}
+			if f.ran("bootctl") {
+				t.Error("the flasher was armed without the HexMac variable")
+			}
+			logs, _ := filepath.Glob(filepath.Join(f.wd, "logs", "*.json"))
+			if len(logs) != 1 {
+				t.Fatalf("%d logs, want 1", len(logs))
+			}
+			raw, err := os.ReadFile(logs[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			var entry LogData
+			if err := json.Unmarshal(raw, &entry); err != nil {
+				t.Fatal(err)
+			}
+			if entry.Success || entry.ActionPerformed != c.action {
+				t.Errorf("log action %q success %v", entry.ActionPerformed, entry.Success)
+			}
+			if r := entry.EfiVerify; len(r) == 0 || !r[len(r)-1].RolledBack {
+				t.Errorf("log verifications %+v, want the HexMac write rolled back", r)
+			}
+		})
+	}
+}
+
+// runUnattended runs main with os.Stdout captured and decodes the Result
+func runUnattended(t *testing.T, args ...string) (int, Result) {
+	t.Helper()
+	out, err := os.Create(filepath.Join(t.TempDir(), "stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	stdout := os.Stdout
+	os.Stdout = out
+	code := runMain(args...)
+	os.Stdout = stdout
+
+	raw, err := os.ReadFile(out.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res Result
+	if err := json.Unmarshal(raw, &res); err != nil {
+		t.Fatalf("stdout is not a single Result: %v\n%s", err, raw)
+	}
+	return code, res
+}
+
+func TestRunUnattended(t *testing.T) {
+	values := []string{"-mb-sn", testMbSN, "-io-sn", testIoSN, "-mac", testMAC}
+
+	t.Run("flags", func(t *testing.T) {
+		f := newFakeSystem(t, "Default string", false)
+		f.stdin = bufio.NewReader(strings.NewReader(""))
+		code, res := runUnattended(t, append(values, "-post-action", "reboot")...)
+		if code != 0 || !res.Success || res.ExitCode != 0 {
+			t.Fatalf("exit %d, result %+v", code, res)
+		}
+		if res.Action != provision.ActionSerialAndMAC || res.MbSN != testMbSN || res.IoSN != testIoSN || res.MAC != testMAC || res.PostAction != postReboot {
+			t.Errorf("result %+v", res)
+		}
+		if res.LogFile == "" || len(res.EfiVerify) == 0 {
+			t.Errorf("no log file or EFI verification in %+v", res)
+		}
+		if !f.ran("reboot") {
+			t.Error("reboot was not run")
+		}
+	})
+
+	t.Run("job file", func(t *testing.T) {
+		f := newFakeSystem(t, testMbSN, false)
+		job := filepath.Join(t.TempDir(), "job.json")
+		data := `{"mb_sn": "` + testMbSN + `", "io_sn": "` + testIoSN + `", "mac": "` + testMAC + `", "post_action": "poweroff", "operator": "op7"}`
+		if err := os.WriteFile(job, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		code, res := runUnattended(t, "-job", job)
+		if code != 0 || res.Action != provision.ActionMACOnly || res.PostAction != postPoweroff {
+			t.Fatalf("exit %d, result %+v", code, res)
+		}
+		if !f.ran("poweroff") {
+			t.Error("poweroff was not run")
+		}
+	})
+
+	t.Run("flags override the job", func(t *testing.T) {
+		f := newFakeSystem(t, testMbSN, true)
+		job := filepath.Join(t.TempDir(), "job.json")
+		if err := os.WriteFile(job, []byte(`{"mb_sn": "bad", "post_action": "reboot"}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+		code, res := runUnattended(t, append(values, "-job", job, "-post-action", "none")...)
+		if code != 0 || res.Action != provision.ActionNone || res.PostAction != postNone {
+			t.Fatalf("exit %d, result %+v", code, res)
+		}
+		if f.ran("poweroff") || f.ran("reboot") {
+			t.Error("post action was run")
+		}
+	})
+
+	t.Run("bad flag", func(t *testing.T) {
+		f := newFakeSystem(t, "Default string", false)
+		code, res := runUnattended(t, append(values, "-no-such-flag")...)
+		if code != exitBadArgs || res.Success || res.ExitCode != exitBadArgs || len(res.Errors) == 0 {
+			t.Fatalf("exit %d, result %+v", code, res)
+		}
+		if len(f.calls) != 0 {
+			t.Errorf("commands run after a bad flag: %v", f.calls)
+		}
+	})
+
+	t.Run("invalid value", func(t *testing.T) {
+		f := newFakeSystem(t, "Default string", false)
+		code, res := runUnattended(t, "-mb-sn", "12345", "-io-sn", testIoSN, "-mac", testMAC)
+		if code != exitBadArgs || res.Success || len(res.Errors) == 0 {
+			t.Fatalf("exit %d, result %+v", code, res)
+		}
+		if f.ran("rtnicpg-x86_64") || f.ran("efibootmgr -c") {
+			t.Error("flashing started with an invalid value")
+		}
+	})
+
+	t.Run("missing value", func(t *testing.T) {
+		newFakeSystem(t, "Default string", false)
+		if code, res := runUnattended(t, "-mb-sn", testMbSN); code != exitBadArgs || res.Success {
+			t.Fatalf("exit %d, result %+v", code, res)
+		}
+	})
+
+	t.Run("invalid post action", func(t *testing.T) {
+		newFakeSystem(t, "Default string", false)
+		if code, _ := runUnattended(t, append(values, "-post-action", "halt")...); code != exitBadArgs {
+			t.Fatalf("exit %d, want %d", code, exitBadArgs)
+		}
+	})
+
+	t.Run("MAC write fails", func(t *testing.T) {
+		f := newFakeSystem(t, "Default string", false)
+		f.fail = []string{"rtnicpg-x86_64"}
+		code, res := runUnattended(t, append(values, "-post-action", "reboot")...)
+		if code != exitFailed || res.Success || res.Action != "MAC address update failed" {
+			t.Fatalf("exit %d, result %+v", code, res)
+		}
+		// После ошибки перезагрузка в прошивальщик не выполняется
+		if res.PostAction != postNone || f.ran("reboot") {
+			t.Errorf("post action %q after a failure", res.PostAction)
+		}
+	})
+}
+
+func TestRunMACPool(t *testing.T) {
+	const poolFirst = "00:E0:4C:68:2D:00"
+	writePool := func(t *testing.T, f *fakeSystem) {
+		t.Helper()
+		cfg := `{"oui": "00:E0:4C", "first": "` + poolFirst + `", "last": "00:E0:4C:68:2D:FF"}`
+		if err := os.WriteFile(filepath.Join(f.wd, "mac_pool.json"), []byte(cfg), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ledger := func(t *testing.T, f *fakeSystem) []macpool.Lease {
+		t.Helper()
+		var file struct{ Entries []macpool.Lease }
+		if data, err := os.ReadFile(filepath.Join(f.wd, "mac_ledger.json")); err == nil {
+			if err := json.Unmarshal(data, &file); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return file.Entries
+	}
+	readLog := func(t *testing.T, f *fakeSystem) LogData {
+		t.Helper()
+		logs, _ := filepath.Glob(filepath.Join(f.wd, "logs", "*.json"))
+		if len(logs) != 1 {
+			t.Fatalf("%d logs, want 1", len(logs))
+		}
+		raw, err := os.ReadFile(logs[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		var entry LogData
+		if err := json.Unmarshal(raw, &entry); err != nil {
+			t.Fatal(err)
+		}
+		return entry
+	}
+
+	t.Run("allocated", func(t *testing.T) {
+		f := newFakeSystem(t, "Default string", false)
+		writePool(t, f)
+		f.stdin = bufio.NewReader(strings.NewReader(testMbSN + "\n" + testIoSN + "\nn\n"))
+		if code := runMain(); code != 0 {
+			t.Fatalf("exit code %d; calls:\n%s", code, strings.Join(f.calls, "\n"))
+		}
+		if !f.ran("rtnicpg-x86_64 /efuse /nodeid 00E04C682D00") {
+			t.Error("the first MAC of the pool was not burned")
+		}
+		entry := readLog(t, f)
+		if a := entry.MacAllocation; entry.MacAddress != poolFirst || a == nil || a.State != macpool.StateCommitted || a.Scanned || a.Source != "ledger" {
+			t.Errorf("log MAC %s allocation %+v", entry.MacAddress, entry.MacAllocation)
+		}
+		if l := ledger(t, f); len(l) != 1 || l[0].MAC != poolFirst || l[0].Unit != testMbSN || l[0].State != macpool.StateCommitted {
+			t.Errorf("ledger %+v", l)
+		}
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		f := newFakeSystem(t, "Default string", false)
+		writePool(t, f)
+		f.stdin = bufio.NewReader(strings.NewReader(testMbSN + "\n" + testIoSN + "\n"))
+		if code := runMain("-dry-run"); code != 0 {
+			t.Fatalf("exit code %d; calls:\n%s", code, strings.Join(f.calls, "\n"))
+		}
+		if f.ran("rtnicpg-x86_64") || len(ledger(t, f)) != 0 {
+			t.Error("a dry run flashed or reserved a MAC")
+		}
+		if _, err := os.Stat(filepath.Join(f.wd, "mac_ledger.json")); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("ledger written: %v", err)
+		}
+	})
+
+	t.Run("scanned outside the pool", func(t *testing.T) {
+		f := newFakeSystem(t, "Default string", false)
+		writePool(t, f)
+		f.stdin = bufio.NewReader(strings.NewReader(testMbSN + "\n" + testIoSN + "\nn\n"))
+		t.Setenv("UNIT_MAC", "00:E0:4C:68:2E:00")
+		if code := runMain(); code != exitBadArgs {
+			t.Fatalf("exit code %d, want %d", code, exitBadArgs)
+		}
+		if f.ran("rtnicpg-x86_64") || len(ledger(t, f)) != 0 {
+			t.Error("a MAC outside the pool was flashed or reserved")
+		}
+	})
+
+	t.Run("MAC write fails", func(t *testing.T) {
+		f := newFakeSystem(t, "Default string", false)
+		writePool(t, f)
+		f.stdin = bufio.NewReader(strings.NewReader(testMbSN + "\n" + testIoSN + "\nn\n"))
+		t.Setenv("UNIT_MAC", testMAC)
+		f.fail = []string{"rtnicpg-x86_64"}
+		if code := runMain(); code != exitFailed {
+			t.Fatalf("exit code %d, want %d", code, exitFailed)
+		}
+		if a := readLog(t, f).MacAllocation; a == nil || a.State != macpool.StateReleased || !a.Scanned || a.MAC != testMAC {
+			t.Errorf("log allocation %+v", a)
+		}
+		if l := ledger(t, f); len(l) != 0 {
+			t.Errorf("ledger %+v, want the lease released", l)
+		}
+	})
+
+	t.Run("pool MAC flashed by hand", func(t *testing.T) {
+		f := newFakeSystem(t, "Default string", false)
+		writePool(t, f)
+		if err := os.Mkdir(filepath.Join(f.wd, "logs"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		old := `{"timestamp": "2025-02-28T10:06:02", "mb_serial_number": "INF00A340242150", "mac_address": "` + poolFirst + `", "success": true}`
+		if err := os.WriteFile(filepath.Join(f.wd, "logs", "Silver_INF00A340242150-250228100602.json"), []byte(old), 0644); err != nil {
+			t.Fatal(err)
+		}
+		f.stdin = bufio.NewReader(strings.NewReader(testMbSN + "\n" + testIoSN + "\nn\n"))
+		if code := runMain(); code != 0 {
+			t.Fatalf("exit code %d; calls:\n%s", code, strings.Join(f.calls, "\n"))
+		}
+		if !f.ran("rtnicpg-x86_64 /efuse /nodeid 00E04C682D01") {
+			t.Error("the next MAC of the pool was not burned")
+		}
+		l := ledger(t, f)
+		if len(l) != 2 || l[0].MAC != poolFirst || l[0].State != macpool.StateRetired || l[0].Unit != "INF00A340242150" ||
+			l[1].MAC != "00:E0:4C:68:2D:01" || l[1].State != macpool.StateCommitted {
+			t.Errorf("ledger %+v", l)
+		}
+	})
+
+	t.Run("MAC flashed onto another unit", func(t *testing.T) {
+		f := newFakeSystem(t, "Default string", false)
+		if err := os.Mkdir(filepath.Join(f.wd, "logs"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		old := `{"timestamp": "2025-02-28T10:06:02", "mb_serial_number": "INF00A340242150", "mac_address": "` + testMAC + `", "success": true}`
+		if err := os.WriteFile(filepath.Join(f.wd, "logs", "Silver_INF00A340242150-250228100602.json"), []byte(old), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if code := runMain(); code != exitBadArgs {
+			t.Fatalf("exit code %d, want %d", code, exitBadArgs)
+		}
+		if f.ran("rtnicpg-x86_64") || f.ran("efibootmgr -c") {
+			t.Error("a duplicate MAC was flashed")
+		}
+	})
+}
+
+func TestRunSerialReuse(t *testing.T) {
+	// Прошлая прошивка того же SN на плату с другим MAC
+	writeHistory := func(t *testing.T, f *fakeSystem, mac string) {
+		t.Helper()
+		if err := os.Mkdir(filepath.Join(f.wd, "logs"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		old := `{"timestamp": "2025-02-28T10:06:02", "mb_serial_number": "` + testMbSN + `", "mac_address": "` + mac + `", "success": true}`
+		if err := os.WriteFile(filepath.Join(f.wd, "logs", "Silver_"+testMbSN+"-250228100602.json"), []byte(old), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	newLog := func(t *testing.T, f *fakeSystem) *LogData {
+		t.Helper()
+		logs, _ := filepath.Glob(filepath.Join(f.wd, "logs", "*.json"))
+		for _, path := range logs {
+			if strings.HasSuffix(path, "-250228100602.json") {
+				continue
+			}
+			raw, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var entry LogData
+			if err := json.Unmarshal(raw, &entry); err != nil {
+				t.Fatal(err)
+			}
+			return &entry
+		}
+		return nil
+	}
+	const otherMAC = "00:E0:4C:68:2D:99"
+
+	t.Run("refused without a supervisor", func(t *testing.T) {
+		f := newFakeSystem(t, "Default string", false)
+		writeHistory(t, f, otherMAC)
+		f.stdin = bufio.NewReader(strings.NewReader(testMbSN + "\n" + testIoSN + "\n" + testMAC + "\n\n"))
+		if code := runMain(); code != exitBadArgs {
+			t.Fatalf("exit code %d, want %d", code, exitBadArgs)
+		}
+		if f.ran("rtnicpg-x86_64") || newLog(t, f) != nil {
+			t.Error("a re-used serial was flashed")
+		}
+	})
+
+	t.Run("supervisor override", func(t *testing.T) {
+		f := newFakeSystem(t, "Default string", false)
+		writeHistory(t, f, otherMAC)
+		f.stdin = bufio.NewReader(strings.NewReader(testMbSN + "\n" + testIoSN + "\n" + testMAC + "\nsup-7\nn\n"))
+		if code := runMain("-operator", "op-1"); code != 0 {
+			t.Fatalf("exit code %d; calls:\n%s", code, strings.Join(f.calls, "\n"))
+		}
+		entry := newLog(t, f)
+		if entry == nil || entry.SerialOverride == nil {
+			t.Fatal("override not logged")
+		}
+		if o := entry.SerialOverride; o.Supervisor != "sup-7" || len(o.Serials) != 1 || o.Serials[0] != testMbSN || len(o.Previous) != 1 {
+			t.Errorf("override %+v", o)
+		}
+	})
+
+	t.Run("supervisor is the operator", func(t *testing.T) {
+		f := newFakeSystem(t, "Default string", false)
+		writeHistory(t, f, otherMAC)
+		code, res := runUnattended(t, "-mb-sn", testMbSN, "-io-sn", testIoSN, "-mac", testMAC, "-operator", "op-1", "-supervisor", "OP-1")
+		if code != exitBadArgs || res.SerialOverride != nil {
+			t.Fatalf("exit %d, result %+v", code, res)
+		}
+	})
+
+	t.Run("same board again", func(t *testing.T) {
+		f := newFakeSystem(t, "Default string", false)
+		writeHistory(t, f, testMAC)
+		if code := runMain(); code != 0 {
+			t.Fatalf("exit code %d", code)
+		}
+		if entry := newLog(t, f); entry == nil || entry.SerialOverride != nil {
+			t.Errorf("log %+v, want no override", entry)
+		}
+	})
+
+	// С пулом MAC не сканируется: плату без UUID узнаём по MAC на её интерфейсах
+	writePool := func(t *testing.T, f *fakeSystem) {
+		t.Helper()
+		cfg := `{"oui": "00:E0:4C", "first": "00:E0:4C:68:2D:00", "last": "00:E0:4C:68:2D:FF"}`
+		if err := os.WriteFile(filepath.Join(f.wd, "mac_pool.json"), []byte(cfg), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Run("pool, same board again", func(t *testing.T) {
+		f := newFakeSystem(t, "Default string", true)
+		writePool(t, f)
+		writeHistory(t, f, testMAC)
+		f.stdin = bufio.NewReader(strings.NewReader(testMbSN + "\n" + testIoSN + "\nn\n"))
+		if code := runMain(); code != 0 {
+			t.Fatalf("exit code %d", code)
+		}
+		if entry := newLog(t, f); entry == nil || entry.SerialOverride != nil {
+			t.Errorf("log %+v, want no override", entry)
+		}
+	})
+
+	t.Run("pool, another board", func(t *testing.T) {
+		f := newFakeSystem(t, "Default string", false)
+		writePool(t, f)
+		writeHistory(t, f, otherMAC)
+		f.stdin = bufio.NewReader(strings.NewReader(testMbSN + "\n" + testIoSN + "\n\n"))
+		if code := runMain(); code != exitBadArgs {
+			t.Fatalf("exit code %d, want %d", code, exitBadArgs)
+		}
+		if f.ran("rtnicpg-x86_64") {
+			t.Error("a re-used serial was flashed")
+		}
+	})
+}
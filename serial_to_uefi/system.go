@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+
+	"crycaller/internal/efivarfs"
+)
+
+// Executor runs an external command and returns its combined, trimmed output.
+type Executor interface {
+	Run(name string, args ...string) (string, error)
+}
+
+// EfiStore is the store of EFI variables: efivarfs on the machine.
+type EfiStore interface {
+	fmt.Stringer
+	ListName(name string) ([]efivarfs.VarID, error)
+	Read(v efivarfs.VarID) (efivarfs.Attributes, []byte, error)
+	Write(v efivarfs.VarID, attrs efivarfs.Attributes, data []byte) error
+	Delete(v efivarfs.VarID) error
+}
+
+// System is what serial_to_uefi needs from the machine: external commands
+// (dmidecode, ip, lsmod, insmod, efibootmgr, blkid, lsblk, mount, ...), the
+// files it changes, the operator's terminal, efivarfs and process control.
+// Files are only read directly. Tests replace it with a fake that returns
+// canned outputs; a dry run wraps it in one that records every change.
+type System interface {
+	Executor
+	Stat(name string) (os.FileInfo, error)
+	WriteFile(name string, data []byte, perm os.FileMode) error
+	Mkdir(name string, perm os.FileMode) error
+	Rename(oldpath, newpath string) error
+	Chmod(name string, mode os.FileMode) error
+	MkdirTemp(dir, pattern string) (string, error)
+	RemoveAll(path string) error
+	// Stdin is the single buffered reader of the operator's input.
+	Stdin() *bufio.Reader
+	// PendingLine returns a line that arrives on stdin within timeout.
+	PendingLine(timeout time.Duration) (string, error)
+	Geteuid() int
+	Getwd() (string, error)
+	EfiVars() EfiStore
+	Sleep(d time.Duration)
+	// Exit ends the program; it does not return.
+	Exit(code int)
+}
+
+// system is the machine serial_to_uefi runs on
+var system System = newHostSystem()
+
+func runCommand(name string, args ...string) (string, error) {
+	return system.Run(name, args...)
+}
+
+func runCommandNoOutput(name string, args ...string) error {
+	// Do not show full output, keep only debug messages
+	_, err := system.Run(name, args...)
+	return err
+}
+
+// hostSystem is the real machine
+type hostSystem struct {
+	stdin *bufio.Reader
+}
+
+func newHostSystem() *hostSystem {
+	return &hostSystem{stdin: bufio.NewReader(os.Stdin)}
+}
+
+func (h *hostSystem) Run(name string, args ...string) (string, error) {
+	cmd := exec.Command(name, args...)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := cmd.Run()
+	return strings.TrimSpace(out.String()), err
+}
+
+func (h *hostSystem) Stdin() *bufio.Reader { return h.stdin }
+
+// PendingLine tries to read a line from os.Stdin with a given timeout.
+// Sets non-blocking mode on descriptor and performs cyclic check.
+func (h *hostSystem) PendingLine(timeout time.Duration) (string, error) {
+	if h.stdin.Buffered() > 0 {
+		return h.stdin.ReadString('\n')
+	}
+	fd := int(os.Stdin.Fd())
+	// Set non-blocking mode.
+	if err := syscall.SetNonblock(fd, true); err != nil {
+		return "", err
+	}
+	// Restore blocking mode when done.
+	defer syscall.SetNonblock(fd, false)
+
+	deadline := time.Now().Add(timeout)
+	for {
+		// If there's at least one byte, read the whole line.
+		_, err := h.stdin.Peek(1)
+		if err == nil {
+			return h.stdin.ReadString('\n')
+		}
+		// If time is up, stop waiting.
+		if time.Now().After(deadline) {
+			return "", errors.New("timeout reached")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (h *hostSystem) Stat(name string) (os.FileInfo, error)     { return os.Stat(name) }
+func (h *hostSystem) Mkdir(name string, perm os.FileMode) error { return os.Mkdir(name, perm) }
+func (h *hostSystem) Rename(oldpath, newpath string) error      { return os.Rename(oldpath, newpath) }
+func (h *hostSystem) Chmod(name string, mode os.FileMode) error { return os.Chmod(name, mode) }
+func (h *hostSystem) RemoveAll(path string) error               { return os.RemoveAll(path) }
+func (h *hostSystem) Geteuid() int                              { return os.Geteuid() }
+func (h *hostSystem) Getwd() (string, error)                    { return os.Getwd() }
+func (h *hostSystem) EfiVars() EfiStore                         { return efivarfs.Default() }
+func (h *hostSystem) Sleep(d time.Duration)                     { time.Sleep(d) }
+func (h *hostSystem) Exit(code int)                             { os.Exit(code) }
+
+func (h *hostSystem) MkdirTemp(dir, pattern string) (string, error) {
+	return os.MkdirTemp(dir, pattern)
+}
+
+func (h *hostSystem) WriteFile(name string, data []byte, perm os.FileMode) error {
+	return os.WriteFile(name, data, perm)
+}
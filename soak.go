@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ================= SOAK MODE =================
+// -cycles N и/или -duration 8h повторяют набор тестов по кругу (burn-in).
+// Результаты каждого цикла сохраняются, по каждому тесту считается доля
+// падений. По умолчанию прогон останавливается после первого цикла с
+// падением, с -keep-going идёт до конца. Новый цикл не начинается после
+// истечения -duration, текущий доигрывается. Тесты с reboot_required
+// выполняются только в первом цикле; если кроме них (и информационных)
+// повторять нечего, прогон останавливается. Soak-прогон хранится в журнале,
+// и после перезагрузки или сбоя продолжается с того же цикла.
+
+type SoakResult struct {
+	Key      string        `json:"key"`
+	Status   string        `json:"status"`
+	Code     int           `json:"code"`
+	Duration time.Duration `json:"duration_ns"`
+	Reason   string        `json:"reason,omitempty"`
+}
+
+type SoakCycle struct {
+	N          int          `json:"n"`
+	StartedAt  time.Time    `json:"started_at"`
+	FinishedAt time.Time    `json:"finished_at"`
+	Failed     []string     `json:"failed,omitempty"`
+	Results    []SoakResult `json:"results"`
+}
+
+type SoakStat struct {
+	Key      string `json:"key"`
+	Path     string `json:"path"`
+	Runs     int    `json:"runs"`
+	Failures int    `json:"failures"`
+}
+
+type SoakRun struct {
+	MaxCycles  int           `json:"max_cycles,omitempty"`
+	Duration   time.Duration `json:"duration_ns,omitempty"`
+	StopOnFail bool          `json:"stop_on_fail"`
+	StartedAt  time.Time     `json:"started_at"`
+	StopReason string        `json:"stop_reason,omitempty"`
+	Cycles     []SoakCycle   `json:"cycles"`
+	Stats      []*SoakStat   `json:"stats"`
+	CycleStart time.Time     `json:"cycle_started_at"`
+
+	done bool
+}
+
+// soak == nil – обычный одиночный прогон
+var soak *SoakRun
+
+func newSoakRun(cycles int, duration time.Duration, keepGoing bool) *SoakRun {
+	if cycles <= 0 && duration <= 0 {
+		return nil
+	}
+	now := time.Now()
+	return &SoakRun{
+		MaxCycles:  cycles,
+		Duration:   duration,
+		StopOnFail: !keepGoing,
+		StartedAt:  now,
+		CycleStart: now,
+	}
+}
+
+func (s *SoakRun) stat(key, path string) *SoakStat {
+	for _, st := range s.Stats {
+		if st.Key == key {
+			return st
+		}
+	}
+	st := &SoakStat{Key: key, Path: path}
+	s.Stats = append(s.Stats, st)
+	return st
+}
+
+func (s *SoakRun) add(c *SoakCycle, key, path string, info bool, st ScriptStatus, code int, dur time.Duration, reason string, cutOff bool) {
+	c.Results = append(c.Results, SoakResult{Key: key, Status: st.String(), Code: code, Duration: dur, Reason: reason})
+	// Информационные тесты и тесты, прерванные по концу цикла, на результат не влияют
+	if info || cutOff {
+		return
+	}
+	stat := s.stat(key, path)
+	stat.Runs++
+	if st == StatusFailed || st == StatusAborted {
+		stat.Failures++
+		c.Failed = append(c.Failed, path)
+	}
+}
+
+// finishCycle сохраняет результаты завершившегося цикла и решает, нужен ли следующий
+func (s *SoakRun) finishCycle(bgs []*BgScript, ints []*IntScript) bool {
+	c := SoakCycle{N: len(s.Cycles) + 1, StartedAt: s.CycleStart, FinishedAt: time.Now()}
+	for _, b := range bgs {
+		s.add(&c, b.Key, b.Path, b.Info, b.Status, b.Code, b.Duration, b.Reason, b.CutOff)
+	}
+	for _, i := range ints {
+		s.add(&c, i.Key, i.Path, i.Info, i.Status, i.Code, i.Duration, i.Reason, i.CutOff)
+	}
+	s.Cycles = append(s.Cycles, c)
+	bareLog.Printf("Soak cycle %d finished in %v, failed: %v", c.N, c.FinishedAt.Sub(c.StartedAt).Truncate(time.Second), c.Failed)
+
+	switch {
+	case len(c.Failed) > 0 && s.StopOnFail:
+		s.stop(fmt.Sprintf("failure in cycle %d", c.N))
+	case s.MaxCycles > 0 && len(s.Cycles) >= s.MaxCycles:
+		s.stop(fmt.Sprintf("%d cycles completed", len(s.Cycles)))
+	case s.Duration > 0 && time.Since(s.StartedAt) >= s.Duration:
+		s.stop(fmt.Sprintf("duration %v elapsed", s.Duration))
+	default:
+		s.CycleStart = time.Now()
+		return true
+	}
+	return false
+}
+
+// stop завершает soak-прогон и сохраняет его в журнал
+func (s *SoakRun) stop(reason string) {
+	s.StopReason = reason
+	s.done = true
+	bareLog.Printf("Soak finished: %s", reason)
+	runJournal.setSoak(s)
+}
+
+// snapshot – копия для журнала, который сохраняется и из горутин тестов
+func (s *SoakRun) snapshot() *SoakRun {
+	c := *s
+	c.Cycles = append([]SoakCycle(nil), s.Cycles...)
+	c.Stats = make([]*SoakStat, len(s.Stats))
+	for i, st := range s.Stats {
+		copied := *st
+		c.Stats[i] = &copied
+	}
+	return &c
+}
+
+func (s *SoakRun) failedCycles() int {
+	n := 0
+	for _, c := range s.Cycles {
+		if len(c.Failed) > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// soakScripts – тесты второго и следующих циклов: всё, кроме reboot_required
+func soakScripts() ([]*BgScript, []*IntScript) {
+	var bgs []*BgScript
+	for idx, sc := range globalConfig.BackgroundScripts {
+		if !sc.RebootRequired {
+			bgs = append(bgs, newBgScript(sc, idx))
+		}
+	}
+	var ints []*IntScript
+	for idx, sc := range globalConfig.InteractiveScripts {
+		if !sc.RebootRequired {
+			ints = append(ints, newIntScript(sc, idx))
+		}
+	}
+	return bgs, ints
+}
+
+// countable – есть ли среди тестов такие, что влияют на результат цикла
+func countable(bgs []*BgScript, ints []*IntScript) bool {
+	for _, b := range bgs {
+		if !b.Info {
+			return true
+		}
+	}
+	for _, i := range ints {
+		if !i.Info {
+			return true
+		}
+	}
+	return false
+}
+
+// nextSoakCycle пересоздаёт тесты из конфига (с учётом фильтра) и запускает
+// новый цикл. Если повторять нечего, soak-прогон останавливается и
+// возвращается false.
+func nextSoakCycle(m *model) bool {
+	bgs, ints := soakScripts()
+	bgs, ints = filterScripts(runFilter, bgs, ints)
+	if !countable(bgs, ints) {
+		soak.stop("no tests to repeat: only reboot_required and informational tests are selected")
+		return false
+	}
+	m.bgScripts, m.intScripts = bgs, ints
+	m.outputTiles = []outputTile{}
+	m.selectedTileIdx = 0
+	m.rebootStage = false
+	runJournal.startSoakCycle(soak)
+	launchScripts(m.bgScripts, m.intScripts, notifyFor(m.bgScripts, m.intScripts))
+	return true
+}
+
+func (s *SoakRun) progress() string {
+	cycle := len(s.Cycles)
+	if !s.done {
+		cycle++
+	}
+	text := fmt.Sprintf("SOAK cycle %d", cycle)
+	if s.MaxCycles > 0 {
+		text += fmt.Sprintf("/%d", s.MaxCycles)
+	}
+	text += fmt.Sprintf(" | elapsed %v", time.Since(s.StartedAt).Truncate(time.Second))
+	if s.Duration > 0 {
+		text += fmt.Sprintf("/%v", s.Duration)
+	}
+	text += fmt.Sprintf(" | failed cycles: %d", s.failedCycles())
+	if s.done {
+		text += " | stopped: " + s.StopReason
+	}
+	return text
+}
+
+// failureRates – тесты с падениями, по убыванию доли падений
+func (s *SoakRun) failureRates() []string {
+	var stats []*SoakStat
+	for _, st := range s.Stats {
+		if st.Failures > 0 {
+			stats = append(stats, st)
+		}
+	}
+	sort.SliceStable(stats, func(a, b int) bool {
+		return stats[a].Failures*stats[b].Runs > stats[b].Failures*stats[a].Runs
+	})
+	var lines []string
+	for _, st := range stats {
+		lines = append(lines, fmt.Sprintf("  %s: %d/%d failed (%.0f%%)", st.Path, st.Failures, st.Runs, 100*float64(st.Failures)/float64(st.Runs)))
+	}
+	return lines
+}
+
+// soakLine – счётчик циклов и доля падений для левой панели и финального экрана
+func soakLine() string {
+	if soak == nil {
+		return ""
+	}
+	lines := []string{focusStyle.Render(soak.progress())}
+	if rates := soak.failureRates(); len(rates) > 0 {
+		lines = append(lines, failedStyle.Render(strings.Join(rates, "\n")))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io"
+	"log"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNextSoakCycleNothingToRepeat(t *testing.T) {
+	oldCfg, oldLog, oldSoak, oldJournal := globalConfig, bareLog, soak, runJournal
+	t.Cleanup(func() { globalConfig, bareLog, soak, runJournal = oldCfg, oldLog, oldSoak, oldJournal })
+	bareLog = log.New(io.Discard, "", 0)
+	runJournal = newJournal(filepath.Join(t.TempDir(), journalFile))
+	globalConfig = &Config{
+		BackgroundScripts: []ScriptConfig{
+			{Path: "./reboot_check", Type: "binary", RebootRequired: true},
+			{Path: "./sensors", Type: "script, info"},
+		},
+	}
+	soak = newSoakRun(3, 0, false)
+
+	m := model{}
+	if nextSoakCycle(&m) {
+		t.Fatal("a cycle without countable tests was started")
+	}
+	if !soak.done || soak.StopReason == "" {
+		t.Fatalf("soak not stopped: done %v, reason %q", soak.done, soak.StopReason)
+	}
+	if runJournal.Soak == nil || runJournal.Soak.StopReason != soak.StopReason {
+		t.Errorf("stop reason not saved in the journal: %+v", runJournal.Soak)
+	}
+}
+
+func TestSoakJournalResume(t *testing.T) {
+	oldLog := bareLog
+	t.Cleanup(func() { bareLog = oldLog })
+	bareLog = log.New(io.Discard, "", 0)
+
+	path := filepath.Join(t.TempDir(), journalFile)
+	j := newJournal(path)
+	s := newSoakRun(5, time.Hour, true)
+	s.Cycles = []SoakCycle{{N: 1, Failed: []string{"./mem"}, Results: []SoakResult{{Key: "bg:./mem", Status: "FAILED", Code: 1}}}}
+	s.stat("bg:./mem", "./mem").Runs = 1
+	j.record("bg:./mem", "./mem", StatusPassed, 0, time.Second)
+	j.startSoakCycle(s)
+	// Статистика в журнале – копия, дальнейшие изменения её не трогают
+	s.Stats[0].Runs = 7
+
+	loaded, err := loadJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Soak == nil || len(loaded.Soak.Cycles) != 1 || loaded.Soak.MaxCycles != 5 || loaded.Soak.StopOnFail {
+		t.Fatalf("soak not restored: %+v", loaded.Soak)
+	}
+	if len(loaded.Soak.Stats) != 1 || loaded.Soak.Stats[0].Runs != 1 {
+		t.Errorf("stats not restored: %+v", loaded.Soak.Stats)
+	}
+	if len(loaded.Tests) != 0 {
+		t.Errorf("results of the previous cycle kept: %v", loaded.Tests)
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+
+	"crycaller/internal/dmi"
+	"crycaller/internal/unitrules"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// ================= UNIT IDENTITY =================
+// Перед прогоном оператор сканирует штрих-коды изделия (SN, IO SN, MAC).
+// Строки классифицируются по общей таблице правил unit_rules.json – той же,
+// что использует serial_to_uefi. Значения передаются тестам через окружение
+// и попадают в отчёт.
+
+type UnitIdentity struct {
+	mutex   sync.Mutex
+	product string
+	values  map[string]string
+	env     []string
+}
+
+var (
+	unit      = &UnitIdentity{}
+	unitRules *unitrules.Table
+)
+
+func (u *UnitIdentity) Set(product string, values map[string]string, env []string) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	u.product = product
+	u.values = values
+	u.env = env
+}
+
+func (u *UnitIdentity) Known() bool {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	return len(u.values) > 0
+}
+
+func (u *UnitIdentity) Product() string {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	return u.product
+}
+
+func (u *UnitIdentity) Values() map[string]string {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	out := make(map[string]string, len(u.values))
+	for k, v := range u.values {
+		out[k] = v
+	}
+	return out
+}
+
+func (u *UnitIdentity) Env() []string {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	return append([]string(nil), u.env...)
+}
+
+// restoreUnit восстанавливает идентификацию изделия из журнала (env пересчитывается по правилам)
+func restoreUnit(product string, values map[string]string) {
+	if len(values) == 0 {
+		return
+	}
+	var env []string
+	if unitRules != nil {
+		if p, ok := unitRules.Product(product); ok {
+			env = p.Env(values)
+		}
+	}
+	unit.Set(product, values, env)
+}
+
+// detectProduct находит продукт по правилам match из unit_rules.json.
+// Второе значение – имя продукта из DMI, для сообщения, если правила не подошли
+func detectProduct() (*unitrules.Product, string) {
+	outputs := map[string]string{}
+	lookup := func(dmiType, key string) (string, bool) {
+		out, ok := outputs[dmiType]
+		if !ok {
+			raw, err := exec.Command("dmidecode", "-t", dmiType).Output()
+			if err != nil {
+				bareLog.Printf("dmidecode -t %s failed: %v", dmiType, err)
+			}
+			out = string(raw)
+			outputs[dmiType] = out
+		}
+		return dmi.Value(out, key)
+	}
+	name, _ := lookup(unitrules.DMISystem, "Product Name")
+	p, _ := unitRules.Detect(lookup)
+	return p, name
+}
+
+// beginRun выбирает стартовый экран (оператор, изделие, фильтр). Когда они
+// пройдены, тесты запускает startRunMsg (см. startCmd) – модель здесь может
+// быть копией, которую программа ещё не видит.
+func beginRun(m model) model {
+	if globalConfig.AskOperator && identity.Operator() == "" {
+		m.mode = modeOperator
+		m.returnMode = modeMain
+		m.pendingLaunch = true
+		return m
+	}
+	if globalConfig.AskUnit && !unit.Known() {
+		m.mode = modeUnit
+		m.pendingLaunch = true
+		return m
+	}
+	if globalConfig.AskFilter && !m.filterPicked {
+		m.mode = modeFilter
+		m.pendingLaunch = true
+		return m
+	}
+	m.mode = modeMain
+	m.pendingLaunch = true
+	return m
+}
+
+// startRunMsg запускает тесты после стартовых экранов
+type startRunMsg struct{}
+
+// startCmd отправляет startRunMsg, если стартовые экраны пройдены и тесты ещё не запущены
+func startCmd(m model) tea.Cmd {
+	if m.mode != modeMain || !m.pendingLaunch {
+		return nil
+	}
+	return func() tea.Msg { return startRunMsg{} }
+}
+
+// ================= UNIT SCREEN =================
+func handleUnitKey(m model, msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyEnter:
+		input := strings.TrimSpace(m.unitInput)
+		m.unitInput = ""
+		if input == "" {
+			return m, nil
+		}
+		if m.unitProduct == nil {
+			// Продукт не определён по DMI – пробуем узнать его по первому штрих-коду
+			p, ok := unitRules.Infer(input)
+			if !ok {
+				m.unitMsg = fmt.Sprintf("Cannot determine product from %q", input)
+				return m, nil
+			}
+			m.unitProduct = p
+		}
+		field, ok := m.unitProduct.Classify(input, m.unitValues)
+		if !ok {
+			m.unitMsg = fmt.Sprintf("%q does not match any expected format", input)
+			if err := m.unitProduct.Reject(input, m.unitValues); err != nil {
+				m.unitMsg = "Rejected: " + err.Error()
+			}
+			return m, nil
+		}
+		m.unitValues[field] = input
+		m.unitMsg = fmt.Sprintf("%s accepted: %s", field, input)
+		if m.unitProduct.Complete(m.unitValues) {
+			unit.Set(m.unitProduct.Name, m.unitValues, m.unitProduct.Env(m.unitValues))
+			runJournal.setUnit(m.unitProduct.Name, m.unitValues)
+			bareLog.Printf("Unit identified: %s %v", m.unitProduct.Name, m.unitValues)
+			m = beginRun(m)
+			return m, startCmd(m)
+		}
+		return m, nil
+	case tea.KeyBackspace:
+		if r := []rune(m.unitInput); len(r) > 0 {
+			m.unitInput = string(r[:len(r)-1])
+		}
+		return m, nil
+	case tea.KeyEsc:
+		m.quitting = true
+		return m, tea.Quit
+	case tea.KeyCtrlW:
+		// Сброс введённых значений
+		m.unitValues = map[string]string{}
+		m.unitMsg = "Cleared"
+		return m, nil
+	case tea.KeyRunes, tea.KeySpace:
+		m.unitInput += string(msg.Runes)
+		return m, nil
+	}
+	return m, nil
+}
+
+func renderUnitScreen(m model) string {
+	clear := "\033[2J\033[H"
+	lines := []string{
+		asciiBannerMain(),
+		identityLine(),
+		"",
+		asciiSep("UNIT IDENTIFICATION"),
+	}
+	if m.unitProduct == nil {
+		lines = append(lines, "Product: (unknown, will be inferred from the first scan)")
+	} else {
+		lines = append(lines, "Product: "+m.unitProduct.Name)
+		for _, f := range m.unitProduct.Fields {
+			if v, ok := m.unitValues[f.Name]; ok {
+				lines = append(lines, passedStyle.Render("[x]")+fmt.Sprintf(" %-5s %s", f.Name, v))
+			} else {
+				lines = append(lines, fmt.Sprintf("[ ] %-5s expected: %s", f.Name, f.Pattern))
+			}
+		}
+	}
+	if m.unitMsg != "" {
+		lines = append(lines, "", m.unitMsg)
+	}
+	lines = append(lines,
+		"",
+		"Scan a barcode or type a value and press [Enter]:",
+		focusStyle.Render("> "+m.unitInput+"_"),
+		footerStyle.Render("\nPress [ctrl+w] to clear scanned values | Press [ESC] or [ctrl+q] to quit"),
+	)
+	return clear + mainBorder.Render(lipgloss.NewStyle().Width(m.width-4).Render(strings.Join(lines, "\n")))
+}
+
+// unitLine – строка с идентификацией изделия для левой панели
+func unitLine() string {
+	values := unit.Values()
+	if len(values) == 0 {
+		return ""
+	}
+	var keys []string
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		parts = append(parts, k+"="+values[k])
+	}
+	return fmt.Sprintf("Unit: %s %s", unit.Product(), strings.Join(parts, " "))
+}
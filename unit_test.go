@@ -0,0 +1,120 @@
+package main
+
+import (
+	"io"
+	"log"
+	"sync"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// messages runs cmd and the commands of a tea.Batch and returns what they
+// send within a short time; ticks come too late to be collected.
+func messages(cmd tea.Cmd) []tea.Msg {
+	if cmd == nil {
+		return nil
+	}
+	out := make(chan tea.Msg, 16)
+	var run func(c tea.Cmd)
+	run = func(c tea.Cmd) {
+		go func() {
+			msg := c()
+			if batch, ok := msg.(tea.BatchMsg); ok {
+				for _, sub := range batch {
+					if sub != nil {
+						run(sub)
+					}
+				}
+				return
+			}
+			out <- msg
+		}()
+	}
+	run(cmd)
+
+	var msgs []tea.Msg
+	timeout := time.After(100 * time.Millisecond)
+	for {
+		select {
+		case msg := <-out:
+			msgs = append(msgs, msg)
+		case <-timeout:
+			return msgs
+		}
+	}
+}
+
+func startsRun(cmd tea.Cmd) bool {
+	for _, msg := range messages(cmd) {
+		if _, ok := msg.(startRunMsg); ok {
+			return true
+		}
+	}
+	return false
+}
+
+var progOnce sync.Once
+
+// testModel sets up the globals the start screens use
+func testModel(t *testing.T, cfg Config) model {
+	t.Helper()
+	oldCfg, oldID, oldLog := globalConfig, identity, bareLog
+	t.Cleanup(func() { globalConfig, identity, bareLog = oldCfg, oldID, oldLog })
+	globalConfig = &cfg
+	identity = &Identity{}
+	bareLog = log.New(io.Discard, "", 0)
+
+	m := model{mode: modeMain, unitValues: map[string]string{}, filterState: map[string]int{}, finalSelected: map[string]bool{}}
+	// notifyFor шлёт сообщения в программу; остановленная программа их отбрасывает
+	progOnce.Do(func() {
+		prog = tea.NewProgram(m, tea.WithInput(nil), tea.WithOutput(io.Discard))
+		prog.Kill()
+	})
+	return m
+}
+
+func TestBeginRunOperatorScreen(t *testing.T) {
+	m := beginRun(testModel(t, Config{AskOperator: true}))
+	if m.mode != modeOperator || !m.pendingLaunch {
+		t.Fatalf("mode %v pendingLaunch %v, want the operator screen", m.mode, m.pendingLaunch)
+	}
+	if startsRun(m.Init()) {
+		t.Fatal("Init starts the tests before the operator is entered")
+	}
+
+	for _, r := range "op-7" {
+		next, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+		m = next.(model)
+	}
+	next, cmd := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = next.(model)
+	if identity.Operator() != "op-7" || m.mode != modeMain {
+		t.Fatalf("operator %q mode %v after enter", identity.Operator(), m.mode)
+	}
+	if !startsRun(cmd) {
+		t.Fatal("entering the operator does not start the tests")
+	}
+
+	next, _ = m.Update(startRunMsg{})
+	if m = next.(model); m.pendingLaunch {
+		t.Fatal("startRunMsg did not launch the tests")
+	}
+}
+
+func TestBeginRunWithoutStartScreens(t *testing.T) {
+	m := beginRun(testModel(t, Config{}))
+	if m.mode != modeMain {
+		t.Fatalf("mode %v, want main", m.mode)
+	}
+	if !startsRun(m.Init()) {
+		t.Fatal("Init does not start the tests")
+	}
+	// Повторный startRunMsg тесты второй раз не запускает
+	next, _ := m.Update(startRunMsg{})
+	m = next.(model)
+	if next, _ = m.Update(startRunMsg{}); next.(model).pendingLaunch {
+		t.Fatal("pendingLaunch set again")
+	}
+}
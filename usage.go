@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ================= RESOURCE USAGE =================
+// Пока тест работает, раз в usageInterval опрашивается /proc по всем
+// процессам его сессии (pty.Start делает тест лидером новой сессии).
+// Счётчики CPU и IO родителя включают уже собранных (wait) потомков,
+// поэтому сумма по живым процессам не считает их дважды. После выхода
+// главного процесса оставшиеся в сессии процессы считаются утечкой.
+
+const (
+	usageInterval = time.Second
+	clockTicks    = 100 // USER_HZ, в Linux всегда 100
+)
+
+type ResourceUsage struct {
+	CPUTime    time.Duration `json:"cpu_time_ns"`
+	PeakRSS    int64         `json:"peak_rss_bytes"`
+	ReadBytes  int64         `json:"read_bytes"`
+	WriteBytes int64         `json:"write_bytes"`
+	PeakProcs  int           `json:"peak_procs"`
+	Leaked     []int         `json:"leaked_pids,omitempty"` // живы после выхода главного процесса
+}
+
+type procSample struct {
+	cpu   time.Duration
+	rss   int64
+	read  int64
+	write int64
+	procs int
+}
+
+type usageTracker struct {
+	sid   int
+	mutex sync.Mutex
+	usage ResourceUsage
+	done  chan struct{}
+	wg    sync.WaitGroup
+}
+
+func startUsageTracker(pid int) *usageTracker {
+	t := &usageTracker{sid: pid, done: make(chan struct{})}
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		ticker := time.NewTicker(usageInterval)
+		defer ticker.Stop()
+		for {
+			t.sample()
+			select {
+			case <-t.done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return t
+}
+
+func (t *usageTracker) sample() {
+	s := sampleSession(t.sid)
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if s.cpu > t.usage.CPUTime {
+		t.usage.CPUTime = s.cpu
+	}
+	if s.rss > t.usage.PeakRSS {
+		t.usage.PeakRSS = s.rss
+	}
+	if s.read > t.usage.ReadBytes {
+		t.usage.ReadBytes = s.read
+	}
+	if s.write > t.usage.WriteBytes {
+		t.usage.WriteBytes = s.write
+	}
+	if s.procs > t.usage.PeakProcs {
+		t.usage.PeakProcs = s.procs
+	}
+}
+
+// stop завершает опрос после cmd.Wait, дополняет данные из rusage
+// главного процесса и ищет оставшиеся процессы сессии
+func (t *usageTracker) stop(state *os.ProcessState) ResourceUsage {
+	close(t.done)
+	t.wg.Wait()
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if state != nil {
+		if ru, ok := state.SysUsage().(*syscall.Rusage); ok {
+			cpu := time.Duration(ru.Utime.Nano() + ru.Stime.Nano())
+			if cpu > t.usage.CPUTime {
+				t.usage.CPUTime = cpu
+			}
+			if rss := ru.Maxrss * 1024; rss > t.usage.PeakRSS {
+				t.usage.PeakRSS = rss
+			}
+		}
+	}
+	t.usage.Leaked = sessionPids(t.sid)
+	return t.usage
+}
+
+// sessionPids возвращает PID всех живых процессов сессии sid
+func sessionPids(sid int) []int {
+	var pids []int
+	entries, _ := os.ReadDir("/proc")
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		fields, err := readProcStat(pid)
+		if err != nil || len(fields) < 4 || fields[3] != strconv.Itoa(sid) || fields[0] == "Z" {
+			continue
+		}
+		pids = append(pids, pid)
+	}
+	return pids
+}
+
+func sampleSession(sid int) procSample {
+	var s procSample
+	for _, pid := range sessionPids(sid) {
+		fields, err := readProcStat(pid)
+		if err != nil || len(fields) < 22 {
+			continue
+		}
+		s.procs++
+		// utime, stime, cutime, cstime (поля 14-17 в /proc/<pid>/stat)
+		var ticks int64
+		for _, f := range fields[11:15] {
+			v, _ := strconv.ParseInt(f, 10, 64)
+			ticks += v
+		}
+		s.cpu += time.Duration(ticks) * time.Second / clockTicks
+		pages, _ := strconv.ParseInt(fields[21], 10, 64)
+		s.rss += pages * int64(os.Getpagesize())
+		read, write := readProcIO(pid)
+		s.read += read
+		s.write += write
+	}
+	return s
+}
+
+// readProcStat возвращает поля /proc/<pid>/stat начиная с state (поле 3):
+// имя процесса в скобках может содержать пробелы, поэтому режем по последней ')'
+func readProcStat(pid int) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return nil, err
+	}
+	idx := strings.LastIndexByte(string(data), ')')
+	if idx < 0 {
+		return nil, fmt.Errorf("malformed stat for %d", pid)
+	}
+	return strings.Fields(string(data[idx+1:])), nil
+}
+
+// readProcIO читает read_bytes/write_bytes (реальные обращения к диску)
+func readProcIO(pid int) (int64, int64) {
+	f, err := os.Open(filepath.Join("/proc", strconv.Itoa(pid), "io"))
+	if err != nil {
+		return 0, 0
+	}
+	defer f.Close()
+	var read, write int64
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, val, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		n, _ := strconv.ParseInt(strings.TrimSpace(val), 10, 64)
+		switch key {
+		case "read_bytes":
+			read = n
+		case "write_bytes":
+			write = n
+		}
+	}
+	return read, write
+}
+
+// formatBytes: 1536 -> "1.5K"
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%c", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,20 @@
+package main
+
+import "crycaller/describe"
+
+var describeFlag = describe.Flag()
+
+var manifest = describe.Manifest{
+	Name:        "usb_test",
+	Description: "Curses USB port tester: learns port groups and checks that a drive was inserted into each selected group",
+	Curses:      true,
+	Keys: []describe.Key{
+		{Key: "1-5", Description: "main menu: learn, edit, delete, check, select groups"},
+		{Key: "q/Esc", Description: "leave the current mode"},
+	},
+	ExitCodes: []describe.Exit{
+		{Code: 0, Meaning: "check finished or program closed"},
+		{Code: 1, Meaning: "curses or configuration error"},
+	},
+	Example: "-T",
+}
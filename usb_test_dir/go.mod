@@ -2,4 +2,9 @@ module usb_test
 
 go 1.23.2
 
-require github.com/rthornton128/goncurses v0.0.0-20240804152857-da6485a3b6d7
+require (
+	crycaller v0.0.0-00010101000000-000000000000
+	github.com/rthornton128/goncurses v0.0.0-20240804152857-da6485a3b6d7
+)
+
+replace crycaller => ../
@@ -17,6 +17,8 @@ import (
 	"time"
 
 	gc "github.com/rthornton128/goncurses"
+
+	"crycaller/describe"
 )
 
 func init() {
@@ -54,6 +56,10 @@ type USBDevice struct {
 func main() {
 	flag.Parse()
 
+	if *describeFlag {
+		describe.Print(manifest)
+	}
+
 	// Если задан режим отображения USB (-d), то не запускаем curses,
 	// а выводим список устройств в стандартный вывод.
 	if *displayMode {
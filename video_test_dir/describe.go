@@ -0,0 +1,19 @@
+package main
+
+import "crycaller/describe"
+
+var describeFlag = describe.Flag()
+
+var manifest = describe.Manifest{
+	Name:        "video_test",
+	Description: "Checks video ports from video_cfg.json: ports marked test must be connected and confirmed by the operator, the rest must exist",
+	Keys: []describe.Key{
+		{Key: "y", Description: "output on the port is visible"},
+		{Key: "n", Description: "no output on the port (test fails)"},
+	},
+	ExitCodes: []describe.Exit{
+		{Code: 0, Meaning: "all ports passed (or info/setup mode finished)"},
+		{Code: 1, Meaning: "port not connected, missing or not confirmed"},
+	},
+	Example: "-c",
+}
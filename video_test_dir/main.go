@@ -14,6 +14,8 @@ import (
 	"strings"
 
 	"golang.org/x/term"
+
+	"crycaller/describe"
 )
 
 // Константы и типы
@@ -339,6 +341,10 @@ func main() {
 
 	flag.Parse()
 
+	if *describeFlag {
+		describe.Print(manifest)
+	}
+
 	// Если нет флагов, вывести количество портов.
 	if len(os.Args) == 1 {
 		countPorts()